@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/sarwanazhar/chatappbackend/model"
+	"github.com/sarwanazhar/chatappbackend/repository"
+)
+
+// exportFormat is bumped whenever userExport changes incompatibly.
+const exportFormat = 1
+
+// userExport is the JSON document written by export and read by import.
+// The password hash is included so a restored account keeps working.
+type userExport struct {
+	Format     int          `json:"format"`
+	ExportedAt time.Time    `json:"exportedAt"`
+	User       exportedUser `json:"user"`
+	Chats      []model.Chat `json:"chats"`
+}
+
+type exportedUser struct {
+	ID            string    `json:"id"`
+	Email         string    `json:"email"`
+	PasswordHash  string    `json:"passwordHash"`
+	Disabled      bool      `json:"disabled"`
+	EmailVerified bool      `json:"emailVerified"`
+	CreatedAt     time.Time `json:"createdAt"`
+}
+
+func exportUser(ctx context.Context, e *env, args []string) error {
+	fs := flags("export")
+	email := fs.String("email", "", "email address")
+	out := fs.String("out", "", "output file (default stdout)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	user, err := findUser(ctx, e, *email)
+	if err != nil {
+		return err
+	}
+	chats, err := e.repos.Chats.ListByUser(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		f, err := os.OpenFile(*out, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	err = enc.Encode(userExport{
+		Format:     exportFormat,
+		ExportedAt: time.Now().UTC(),
+		User: exportedUser{
+			ID:            user.ID.Hex(),
+			Email:         user.Email,
+			PasswordHash:  user.Password,
+			Disabled:      user.Disabled,
+			EmailVerified: user.EmailVerified,
+			CreatedAt:     user.CreatedAt,
+		},
+		Chats: chats,
+	})
+	if err != nil {
+		return err
+	}
+	e.logger.Info("✅ exported user", "user_id", user.ID.Hex(), "chats", len(chats))
+	return nil
+}
+
+func importUser(ctx context.Context, e *env, args []string) error {
+	fs := flags("import")
+	in := fs.String("in", "", "export file to read")
+	email := fs.String("email", "", "import into this account instead of the exported email")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *in == "" {
+		return errors.New("-in is required")
+	}
+
+	data, err := os.ReadFile(*in)
+	if err != nil {
+		return err
+	}
+	var exp userExport
+	if err := json.Unmarshal(data, &exp); err != nil {
+		return fmt.Errorf("parsing %s: %w", *in, err)
+	}
+	if exp.Format != exportFormat {
+		return fmt.Errorf("%s has export format %d, expected %d", *in, exp.Format, exportFormat)
+	}
+	if *email == "" {
+		*email = exp.User.Email
+	}
+	address, err := normalizeEmail(e, *email)
+	if err != nil {
+		return err
+	}
+	exported, _ := normalizeEmail(e, exp.User.Email)
+
+	user, err := e.repos.Users.FindByEmail(ctx, emailKey(e, address))
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		reg, err := e.repos.Register(ctx, &model.User{
+			Email:         address,
+			EmailKey:      emailKey(e, address),
+			Password:      exp.User.PasswordHash,
+			EmailVerified: exp.User.EmailVerified && address == exported,
+		})
+		if err != nil {
+			return err
+		}
+		user = reg.User
+		// The export carries the user's own chats, so drop the empty default one.
+		if len(exp.Chats) > 0 {
+			if err := e.repos.Chats.DeleteOwned(ctx, reg.Chat.ID, user.ID); err != nil {
+				return err
+			}
+		}
+		if exp.User.Disabled {
+			if err := e.repos.Users.SetDisabled(ctx, user.ID, true); err != nil {
+				return err
+			}
+		}
+		fmt.Printf("✅ created user %s (%s)\n", user.ID.Hex(), user.Email)
+	case err != nil:
+		return err
+	}
+
+	n, err := e.repos.Chats.Import(ctx, user.ID, exp.Chats)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("✅ imported %d chats into %s\n", n, user.Email)
+	return nil
+}
@@ -0,0 +1,134 @@
+// Command chatadmin performs operator tasks against the backend's database
+// using the same configuration and repository layer as the server.
+//
+//	chatadmin [config flags] <command> [command flags]
+//
+// Run `chatadmin help` for the list of commands.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"text/tabwriter"
+
+	"github.com/sarwanazhar/chatappbackend/config"
+	"github.com/sarwanazhar/chatappbackend/database"
+	"github.com/sarwanazhar/chatappbackend/logging"
+	"github.com/sarwanazhar/chatappbackend/repository"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// env is what every command gets to work with.
+type env struct {
+	cfg    *config.Config
+	db     *mongo.Database
+	repos  *repository.Repositories
+	logger *slog.Logger
+}
+
+type command struct {
+	name string
+	args string
+	help string
+	run  func(ctx context.Context, e *env, args []string) error
+}
+
+var commands = []command{
+	{"create-user", "-email E [-password P]", "register a user (random password if omitted)", createUser},
+	{"disable-user", "-email E", "block logins for a user", setDisabled(true)},
+	{"enable-user", "-email E", "allow logins again", setDisabled(false)},
+	{"set-role", "-email E -role R", "make a user an admin, support or plain user", setRole},
+	{"reset-password", "-email E [-password P]", "set a new password (random if omitted) and sign the user out", resetPassword},
+	{"disable-mfa", "-email E", "turn off two-factor for a user who lost their authenticator", disableMFA},
+	{"list-chats", "-email E", "list a user's chats", listChats},
+	{"export", "-email E [-out FILE]", "write a user's account and chats as JSON", exportUser},
+	{"import", "-in FILE [-email E]", "restore an export, creating the user if needed", importUser},
+	{"normalize-emails", "", "rewrite stored emails in normalized form and recompute their lookup keys; run after changing auth.fold_plus_addresses", normalizeEmails},
+	{"migrate", "[up|status]", "apply or list database migrations", migrate},
+	{"rebuild-indexes", "", "drop and recreate every application index", rebuildIndexes},
+	{"stats", "[-top N] [-json]", "print usage statistics", stats},
+}
+
+func main() {
+	if len(os.Args) < 2 || os.Args[1] == "help" {
+		usage()
+		return
+	}
+
+	cfg, args, err := config.LoadCommand("chatadmin", os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		usage()
+		return
+	}
+	if err != nil {
+		fail(err)
+	}
+	if len(args) == 0 {
+		usage()
+		return
+	}
+
+	var cmd *command
+	for i := range commands {
+		if commands[i].name == args[0] {
+			cmd = &commands[i]
+		}
+	}
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", args[0])
+		usage()
+		os.Exit(2)
+	}
+
+	// Diagnostics go to stderr so exports can be piped from stdout.
+	logger := logging.New(os.Stderr, cfg.Log.LoggingOptions())
+	slog.SetDefault(logger)
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	client, err := database.ConnectMongo(ctx, cfg.Mongo)
+	if err != nil {
+		fail(err)
+	}
+	defer client.Disconnect(context.Background())
+
+	db := client.Database(cfg.Mongo.Database)
+	e := &env{
+		cfg:    cfg,
+		db:     db,
+		repos:  repository.New(db, cfg.Mongo.OperationTimeout),
+		logger: logger,
+	}
+	if err := cmd.run(ctx, e, args[1:]); err != nil {
+		fail(fmt.Errorf("%s: %w", cmd.name, err))
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: chatadmin [config flags] <command> [command flags]")
+	fmt.Fprintln(os.Stderr, "\ncommands:")
+	w := tabwriter.NewWriter(os.Stderr, 0, 0, 2, ' ', 0)
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %s %s\t%s\n", c.name, c.args, c.help)
+	}
+	w.Flush()
+	fmt.Fprintln(os.Stderr, "\nconfig flags and environment variables are the same as the server's; see chatadmin -h")
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, "❌", err)
+	os.Exit(1)
+}
+
+// flags returns a flag set for a command whose parse errors are returned
+// rather than exiting.
+func flags(name string) *flag.FlagSet {
+	return flag.NewFlagSet("chatadmin "+name, flag.ContinueOnError)
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/sarwanazhar/chatappbackend/migrations"
+)
+
+func migrate(ctx context.Context, e *env, args []string) error {
+	action := "up"
+	if len(args) > 0 {
+		action = args[0]
+	}
+	switch action {
+	case "up":
+		if err := migrations.Run(ctx, e.db, e.logger, time.Minute); err != nil {
+			return err
+		}
+		fmt.Println("✅ migrations up to date")
+		return nil
+	case "status":
+		statuses, err := migrations.List(ctx, e.db)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tAPPLIED\tDESCRIPTION")
+		for _, s := range statuses {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = s.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\n", s.Version, applied, s.Description)
+		}
+		return w.Flush()
+	default:
+		return fmt.Errorf("unknown action %q, use up or status", action)
+	}
+}
+
+func rebuildIndexes(ctx context.Context, e *env, args []string) error {
+	if err := migrations.RebuildIndexes(ctx, e.db); err != nil {
+		return err
+	}
+	fmt.Println("✅ indexes rebuilt")
+	return nil
+}
+
+func stats(ctx context.Context, e *env, args []string) error {
+	fs := flags("stats")
+	top := fs.Int("top", 10, "number of most active users to list")
+	asJSON := fs.Bool("json", false, "print JSON instead of a table")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	usage, err := e.repos.Usage(ctx, *top)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(usage)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "users\t%d\n", usage.Users)
+	fmt.Fprintf(w, "disabled users\t%d\n", usage.DisabledUsers)
+	fmt.Fprintf(w, "new users (7d)\t%d\n", usage.NewUsers7d)
+	fmt.Fprintf(w, "chats\t%d\n", usage.Chats)
+	fmt.Fprintf(w, "active chats (24h)\t%d\n", usage.ActiveChats24h)
+	fmt.Fprintf(w, "messages\t%d\n", usage.Messages)
+	if len(usage.TopUsers) > 0 {
+		fmt.Fprintln(w, "\nTOP USERS\tCHATS\tMESSAGES")
+		for _, u := range usage.TopUsers {
+			fmt.Fprintf(w, "%s\t%d\t%d\n", u.UserID.Hex(), u.Chats, u.Messages)
+		}
+	}
+	return w.Flush()
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/sarwanazhar/chatappbackend/libs"
+	"github.com/sarwanazhar/chatappbackend/model"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func createUser(ctx context.Context, e *env, args []string) error {
+	fs := flags("create-user")
+	email := fs.String("email", "", "email address")
+	password := fs.String("password", "", "password; a random one is printed when empty")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *email == "" {
+		return errors.New("-email is required")
+	}
+	address, err := normalizeEmail(e, *email)
+	if err != nil {
+		return err
+	}
+
+	pw, generated, err := passwordOrRandom(*password)
+	if err != nil {
+		return err
+	}
+	if err := checkNewPassword(e, pw, address); err != nil {
+		return err
+	}
+	hash, err := libs.NewPasswordHasher(e.cfg.Password).Hash(pw)
+	if err != nil {
+		return err
+	}
+
+	// The operator vouches for the address, so it starts out verified
+	reg, err := e.repos.Register(ctx, &model.User{Email: address, EmailKey: emailKey(e, address), Password: hash, EmailVerified: true})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("✅ created user %s (%s)\n", reg.User.ID.Hex(), address)
+	if generated {
+		fmt.Printf("password: %s\n", pw)
+	}
+	return nil
+}
+
+func setDisabled(disabled bool) func(context.Context, *env, []string) error {
+	name, verb := "enable-user", "enabled"
+	if disabled {
+		name, verb = "disable-user", "disabled"
+	}
+	return func(ctx context.Context, e *env, args []string) error {
+		fs := flags(name)
+		email := fs.String("email", "", "email address")
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+		user, err := findUser(ctx, e, *email)
+		if err != nil {
+			return err
+		}
+		if err := e.repos.Users.SetDisabled(ctx, user.ID, disabled); err != nil {
+			return err
+		}
+		fmt.Printf("✅ %s user %s (%s)\n", verb, user.ID.Hex(), user.Email)
+		return nil
+	}
+}
+
+func setRole(ctx context.Context, e *env, args []string) error {
+	fs := flags("set-role")
+	email := fs.String("email", "", "email address")
+	role := fs.String("role", "", "one of "+strings.Join(model.Roles, ", "))
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if !slices.Contains(model.Roles, *role) {
+		return fmt.Errorf("-role must be one of %s", strings.Join(model.Roles, ", "))
+	}
+	user, err := findUser(ctx, e, *email)
+	if err != nil {
+		return err
+	}
+	if err := e.repos.Users.SetRole(ctx, user.ID, *role); err != nil {
+		return err
+	}
+	fmt.Printf("✅ %s is now %s\n", user.Email, *role)
+	return nil
+}
+
+func resetPassword(ctx context.Context, e *env, args []string) error {
+	fs := flags("reset-password")
+	email := fs.String("email", "", "email address")
+	password := fs.String("password", "", "new password; a random one is printed when empty")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	user, err := findUser(ctx, e, *email)
+	if err != nil {
+		return err
+	}
+
+	pw, generated, err := passwordOrRandom(*password)
+	if err != nil {
+		return err
+	}
+	if err := checkNewPassword(e, pw, user.Email); err != nil {
+		return err
+	}
+	hash, err := libs.NewPasswordHasher(e.cfg.Password).Hash(pw)
+	if err != nil {
+		return err
+	}
+	if err := e.repos.Users.SetPassword(ctx, user.ID, hash); err != nil {
+		return err
+	}
+	fmt.Printf("✅ password reset for %s\n", user.Email)
+	if generated {
+		fmt.Printf("password: %s\n", pw)
+	}
+	return nil
+}
+
+func disableMFA(ctx context.Context, e *env, args []string) error {
+	fs := flags("disable-mfa")
+	email := fs.String("email", "", "email address")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	user, err := findUser(ctx, e, *email)
+	if err != nil {
+		return err
+	}
+	if !user.MFAEnabled() {
+		return fmt.Errorf("%s has no two-factor authentication", user.Email)
+	}
+	if err := e.repos.Users.DisableMFA(ctx, user.ID); err != nil {
+		return err
+	}
+	fmt.Printf("✅ two-factor authentication disabled for %s\n", user.Email)
+	return nil
+}
+
+func listChats(ctx context.Context, e *env, args []string) error {
+	fs := flags("list-chats")
+	email := fs.String("email", "", "email address")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	user, err := findUser(ctx, e, *email)
+	if err != nil {
+		return err
+	}
+	chats, err := e.repos.Chats.ListByUser(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tTITLE\tMESSAGES\tUPDATED")
+	for _, chat := range chats {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\n", chat.ID.Hex(), chat.Title, len(chat.Messages), chat.UpdatedAt.Format(time.RFC3339))
+	}
+	return w.Flush()
+}
+
+func findUser(ctx context.Context, e *env, email string) (*model.User, error) {
+	if email == "" {
+		return nil, errors.New("-email is required")
+	}
+	// Addresses that normalization rejects, and so have no key, can still
+	// be found as typed
+	var user *model.User
+	address, err := normalizeEmail(e, email)
+	if err != nil {
+		user, err = e.repos.Users.FindByStoredEmail(ctx, email)
+	} else {
+		user, err = e.repos.Users.FindByEmail(ctx, emailKey(e, address))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", email, err)
+	}
+	return user, nil
+}
+
+// normalizeEmail returns email as the server stores it.
+func normalizeEmail(e *env, email string) (string, error) {
+	address, err := libs.NormalizeEmail(email)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", email, err)
+	}
+	return address, nil
+}
+
+// emailKey returns what the server looks a normalized address up under.
+func emailKey(e *env, address string) string {
+	return libs.EmailKey(address, e.cfg.Auth.FoldPlusAddresses)
+}
+
+// checkNewPassword holds passwords the operator picks to the same policy
+// as users'.
+func checkNewPassword(e *env, password, email string) error {
+	problem, err := libs.NewPasswordPolicy(e.cfg.Password).Check("password", password, email)
+	if err != nil {
+		return fmt.Errorf("checking breached passwords: %w", err)
+	}
+	if problem != nil {
+		return errors.New(problem.Message)
+	}
+	return nil
+}
+
+func normalizeEmails(ctx context.Context, e *env, args []string) error {
+	report, err := e.repos.Users.NormalizeEmails(ctx, libs.NormalizeEmail, func(email string) string {
+		return emailKey(e, email)
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("✅ normalized %d users\n", report.Changed)
+	if len(report.Conflicts) > 0 {
+		fmt.Println("these already have another account at their normalized address, resolve them by hand:")
+		printUsers(ctx, e, report.Conflicts)
+	}
+	if len(report.Invalid) > 0 {
+		fmt.Println("these have an address that isn't valid, change it by hand:")
+		printUsers(ctx, e, report.Invalid)
+	}
+	return nil
+}
+
+// printUsers lists ids with each user's current address.
+func printUsers(ctx context.Context, e *env, ids []primitive.ObjectID) {
+	for _, id := range ids {
+		user, err := e.repos.Users.FindByID(ctx, id.Hex())
+		if err != nil {
+			fmt.Printf("  %s\n", id.Hex())
+			continue
+		}
+		fmt.Printf("  %s  %s\n", id.Hex(), user.Email)
+	}
+}
+
+// passwordOrRandom returns pw, or a random 16-character password when pw is
+// empty along with generated=true so the caller can show it once.
+func passwordOrRandom(pw string) (string, bool, error) {
+	if pw != "" {
+		return pw, false, nil
+	}
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", false, err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), true, nil
+}
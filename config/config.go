@@ -0,0 +1,485 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config is every tunable the server reads at startup. Values are layered:
+// defaults, then the optional config file, then environment, then flags.
+type Config struct {
+	Server    ServerConfig
+	Mongo     MongoConfig
+	Auth      AuthConfig
+	Password  PasswordConfig
+	AI        AIConfig
+	Search    SearchConfig
+	RateLimit RateLimitConfig
+	Log       LogConfig
+	Mail      MailConfig
+	SSO       SSOConfig
+	Lockout   LockoutConfig
+	PoW       PoWConfig
+	Account   AccountConfig
+	Export    ExportConfig
+}
+
+type ServerConfig struct {
+	Port            string
+	ShutdownTimeout time.Duration
+	// TrustedProxies are the proxy addresses or CIDRs whose X-Forwarded-For
+	// header is believed when finding the client IP. Empty trusts none, so
+	// the client IP is the connection's remote address.
+	TrustedProxies []string
+	// PublicURL is this server's public origin, used in links that point
+	// at the API itself, such as data export downloads.
+	PublicURL string
+}
+
+type MongoConfig struct {
+	URI            string
+	Database       string
+	ConnectTimeout time.Duration
+	// OperationTimeout bounds a single query issued by a handler.
+	OperationTimeout time.Duration
+	// AutoMigrate applies pending migrations when the server starts.
+	AutoMigrate bool
+}
+
+type AuthConfig struct {
+	// JWTSecret signs emailed links and encrypts the stored signing keys.
+	// Access tokens are signed with those keys, not with it.
+	JWTSecret string
+	TokenTTL  time.Duration
+	// SigningAlgorithm is RS256 or EdDSA, for keys created from now on.
+	SigningAlgorithm string
+	// KeyRotation is how long one key signs access tokens before the next
+	// takes over.
+	KeyRotation time.Duration
+	// AcceptHS256 accepts access tokens signed with JWTSecret, as issued
+	// before signing keys existed, provided they carry exp and iat. The
+	// oldest such tokens have neither and are refused regardless.
+	AcceptHS256 bool
+	// RequireVerifiedEmail blocks chat routes until the user has clicked
+	// the link in their verification email.
+	RequireVerifiedEmail bool
+	// VerifyEmailURL is the frontend page that receives ?token= from the
+	// verification email and posts it to /v1/auth/verify-email.
+	VerifyEmailURL  string
+	VerificationTTL time.Duration
+	// ResetPasswordURL is the frontend page that receives ?token= from the
+	// password reset email and posts it with the new password.
+	ResetPasswordURL string
+	ResetTokenTTL    time.Duration
+	// ChangeEmailURL is the frontend page that receives ?token= from the
+	// email sent to a new address and posts it to /v1/auth/confirm-email.
+	ChangeEmailURL string
+	// FoldPlusAddresses treats name+tag@example.com as the same account as
+	// name@example.com, so one mailbox can't hold several accounts through
+	// plus addressing. Only the lookup key is folded; mail goes to the
+	// address as given. Changing it needs `chatadmin normalize-emails`.
+	FoldPlusAddresses bool
+}
+
+// PasswordConfig is the policy for new passwords and their hashes. Stored
+// hashes record how they were made, so a hashing change applies to new
+// passwords at once and to existing ones as their owners next log in.
+type PasswordConfig struct {
+	MinLength int
+	// BreachedList is a local copy of the Pwned Passwords list, a directory
+	// of range files or one sorted file, that new passwords must not be in.
+	// Empty skips the check.
+	BreachedList string
+	// Algorithm is argon2id or bcrypt.
+	Algorithm string
+	// Argon2Memory is in KiB.
+	Argon2Memory  int
+	Argon2Time    int
+	Argon2Threads int
+	BcryptCost    int
+}
+
+type AIConfig struct {
+	APIKey      string
+	ChatModel   string
+	RouterModel string
+	// GenerationTimeout bounds a whole /chat/message request, stream included.
+	GenerationTimeout time.Duration
+	RouterTimeout     time.Duration
+	HistoryMessages   int
+}
+
+type SearchConfig struct {
+	Enabled    bool
+	Timeout    time.Duration
+	MaxResults int
+}
+
+type RateLimitConfig struct {
+	Requests int
+	Window   time.Duration
+}
+
+type LogConfig struct {
+	Level  string
+	Format string
+	Redact bool
+}
+
+type MailConfig struct {
+	// Driver is smtp, file (one .eml per message in FileDir) or log.
+	Driver string
+	From   string
+
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+	// SMTPTLS is starttls, tls (implicit, usually port 465) or none.
+	SMTPTLS string
+
+	FileDir string
+	Timeout time.Duration
+	// Workers bounds how many background emails, such as verification
+	// resends and security notices, are sent at once; emails beyond it are
+	// dropped.
+	Workers int
+}
+
+// SSOConfig enables sign-in through external identity providers. A
+// provider is enabled by setting its client ID.
+type SSOConfig struct {
+	// CallbackBaseURL is this server's public origin; providers send the
+	// browser back to <CallbackBaseURL>/v1/auth/sso/<provider>/callback.
+	CallbackBaseURL string
+	// RedirectURL is the frontend page that receives #token= (or #error=)
+	// once a provider login finishes.
+	RedirectURL string
+	Timeout     time.Duration
+
+	GoogleClientID     string
+	GoogleClientSecret string
+	GitHubClientID     string
+	GitHubClientSecret string
+
+	// OIDCIssuer, OIDCClientID and OIDCClientSecret configure any other
+	// OpenID Connect provider (Keycloak, Dex, a local mock) under OIDCName.
+	OIDCName         string
+	OIDCIssuer       string
+	OIDCClientID     string
+	OIDCClientSecret string
+}
+
+// LockoutConfig slows down password guessing. Failed logins are counted
+// per email address and per client IP.
+type LockoutConfig struct {
+	Enabled bool
+	// After BackoffAfter failures for one email, every further failure makes
+	// the next attempt wait BackoffBase, doubling each time.
+	BackoffAfter int
+	BackoffBase  time.Duration
+	// AccountThreshold failures for one email, or IPThreshold from one IP,
+	// lock logins for Duration.
+	AccountThreshold int
+	IPThreshold      int
+	Duration         time.Duration
+	// Window is how long a failure is remembered.
+	Window time.Duration
+	// Notify emails the account owner when their account gets locked.
+	Notify bool
+}
+
+// PoWConfig makes clients spend CPU on a proof-of-work challenge before
+// registering, and before logging in once the email or IP has recent
+// failed logins, to slow down scripts without a third-party captcha.
+type PoWConfig struct {
+	Enabled bool
+	// Difficulty is how many leading zero bits a solution's SHA-256 needs;
+	// each extra bit doubles the expected work.
+	Difficulty    int
+	MaxDifficulty int
+	// LoadThreshold is the register and login requests per minute above
+	// which difficulty rises one bit per doubling, up to MaxDifficulty.
+	LoadThreshold int
+	// LoginAfter failed logins for an email or IP make login need a
+	// solution. They are counted over Lockout.Window even with lockout off.
+	LoginAfter int
+	TTL        time.Duration
+}
+
+// AccountConfig governs accounts users delete themselves.
+type AccountConfig struct {
+	// DeletionGrace is how long a deleted account can still be restored
+	// before it and its data are removed for good.
+	DeletionGrace time.Duration
+	// PurgeInterval is how often the server removes accounts whose grace
+	// period has ended.
+	PurgeInterval time.Duration
+}
+
+// ExportConfig governs personal data exports.
+type ExportConfig struct {
+	// LinkTTL is how long a finished export can be downloaded.
+	LinkTTL time.Duration
+	// Timeout bounds one export from request to finished file, waiting for
+	// a worker included; a job running longer counts as failed and the
+	// user can ask again.
+	Timeout time.Duration
+	// Workers is how many exports the server builds at once.
+	Workers int
+}
+
+// Default returns the built-in configuration, matching the values that
+// used to be hard-coded.
+func Default() *Config {
+	return &Config{
+		Server: ServerConfig{
+			Port:            "8080",
+			ShutdownTimeout: 10 * time.Second,
+			PublicURL:       "http://localhost:8080",
+		},
+		Mongo: MongoConfig{
+			Database:         "chatApp",
+			ConnectTimeout:   10 * time.Second,
+			OperationTimeout: 5 * time.Second,
+			AutoMigrate:      true,
+		},
+		Auth: AuthConfig{
+			TokenTTL:         24 * time.Hour,
+			SigningAlgorithm: "RS256",
+			KeyRotation:      30 * 24 * time.Hour,
+			AcceptHS256:      false,
+			VerifyEmailURL:   "http://localhost:3000/verify-email",
+			VerificationTTL:  48 * time.Hour,
+			ResetPasswordURL: "http://localhost:3000/reset-password",
+			ResetTokenTTL:    time.Hour,
+			ChangeEmailURL:   "http://localhost:3000/confirm-email",
+		},
+		Password: PasswordConfig{
+			MinLength:     8,
+			Algorithm:     "argon2id",
+			Argon2Memory:  19 * 1024,
+			Argon2Time:    2,
+			Argon2Threads: 1,
+			BcryptCost:    10,
+		},
+		AI: AIConfig{
+			ChatModel:         "gemini-2.5-flash-lite",
+			RouterModel:       "gemini-2.5-flash-lite",
+			GenerationTimeout: 40 * time.Second,
+			RouterTimeout:     8 * time.Second,
+			HistoryMessages:   6,
+		},
+		Search: SearchConfig{
+			Enabled:    true,
+			Timeout:    8 * time.Second,
+			MaxResults: 5,
+		},
+		RateLimit: RateLimitConfig{
+			Requests: 30,
+			Window:   time.Minute,
+		},
+		Log: LogConfig{
+			Level:  "info",
+			Format: "json",
+			Redact: true,
+		},
+		Mail: MailConfig{
+			Driver:   "log",
+			From:     "ChatApp <no-reply@localhost>",
+			SMTPPort: 587,
+			SMTPTLS:  "starttls",
+			FileDir:  "mail",
+			Timeout:  10 * time.Second,
+			Workers:  4,
+		},
+		SSO: SSOConfig{
+			CallbackBaseURL: "http://localhost:8080",
+			RedirectURL:     "http://localhost:3000/auth/callback",
+			Timeout:         10 * time.Second,
+			OIDCName:        "oidc",
+		},
+		Lockout: LockoutConfig{
+			Enabled:          true,
+			BackoffAfter:     3,
+			BackoffBase:      time.Second,
+			AccountThreshold: 10,
+			IPThreshold:      100,
+			Duration:         15 * time.Minute,
+			Window:           time.Hour,
+			Notify:           true,
+		},
+		PoW: PoWConfig{
+			Difficulty:    18,
+			MaxDifficulty: 24,
+			LoadThreshold: 120,
+			LoginAfter:    3,
+			TTL:           5 * time.Minute,
+		},
+		Account: AccountConfig{
+			DeletionGrace: 7 * 24 * time.Hour,
+			PurgeInterval: time.Hour,
+		},
+		Export: ExportConfig{
+			LinkTTL: 24 * time.Hour,
+			Timeout: 10 * time.Minute,
+			Workers: 2,
+		},
+	}
+}
+
+// Validate reports every problem at once so a misconfigured deploy fails
+// with the full list instead of one error per restart.
+func (c *Config) Validate() error {
+	var errs []error
+	if c.Mongo.URI == "" {
+		errs = append(errs, errors.New("mongo.uri (MONGODB_URI) is required"))
+	}
+	if c.Mongo.Database == "" {
+		errs = append(errs, errors.New("mongo.database (MONGODB_DATABASE) must not be empty"))
+	}
+	if c.Auth.JWTSecret == "" {
+		errs = append(errs, errors.New("auth.jwt_secret (JWT_SECRET) is required"))
+	}
+	if c.Auth.SigningAlgorithm != "RS256" && c.Auth.SigningAlgorithm != "EdDSA" {
+		errs = append(errs, fmt.Errorf("auth.signing_algorithm (JWT_ALGORITHM) %q must be RS256 or EdDSA", c.Auth.SigningAlgorithm))
+	}
+	if c.Auth.KeyRotation < 24*time.Hour {
+		errs = append(errs, errors.New("auth.key_rotation (JWT_KEY_ROTATION) must be at least 24h"))
+	}
+	if c.Password.MinLength < 1 || c.Password.MinLength > 128 {
+		errs = append(errs, errors.New("password.min_length (PASSWORD_MIN_LENGTH) must be between 1 and 128"))
+	}
+	if c.Password.BreachedList != "" {
+		if _, err := os.Stat(c.Password.BreachedList); err != nil {
+			errs = append(errs, fmt.Errorf("password.breached_list (PASSWORD_BREACHED_LIST): %w", err))
+		}
+	}
+	if c.Password.Algorithm != "argon2id" && c.Password.Algorithm != "bcrypt" {
+		errs = append(errs, fmt.Errorf("password.algorithm (PASSWORD_ALGORITHM) %q must be argon2id or bcrypt", c.Password.Algorithm))
+	}
+	if c.Password.Argon2Time < 1 || c.Password.Argon2Threads < 1 || c.Password.Argon2Threads > 255 || c.Password.Argon2Memory < 8*c.Password.Argon2Threads {
+		errs = append(errs, errors.New("password.argon2_time must be at least 1, password.argon2_threads 1 to 255, and password.argon2_memory at least 8 KiB per thread"))
+	}
+	if c.Password.BcryptCost < 4 || c.Password.BcryptCost > 31 {
+		errs = append(errs, errors.New("password.bcrypt_cost must be between 4 and 31"))
+	}
+	if port, err := strconv.Atoi(c.Server.Port); err != nil || port < 1 || port > 65535 {
+		errs = append(errs, fmt.Errorf("server.port (PORT) %q is not a valid port", c.Server.Port))
+	}
+	for _, proxy := range c.Server.TrustedProxies {
+		if _, _, err := net.ParseCIDR(proxy); err != nil && net.ParseIP(proxy) == nil {
+			errs = append(errs, fmt.Errorf("server.trusted_proxies (TRUSTED_PROXIES) %q is not an IP or CIDR", proxy))
+		}
+	}
+	if c.AI.ChatModel == "" || c.AI.RouterModel == "" {
+		errs = append(errs, errors.New("ai.chat_model and ai.router_model must not be empty"))
+	}
+	if c.AI.HistoryMessages < 0 {
+		errs = append(errs, errors.New("ai.history_messages must not be negative"))
+	}
+	if c.Search.MaxResults < 1 {
+		errs = append(errs, errors.New("search.max_results must be at least 1"))
+	}
+	switch c.Mail.Driver {
+	case "smtp":
+		if c.Mail.SMTPHost == "" {
+			errs = append(errs, errors.New("mail.smtp_host (SMTP_HOST) is required with the smtp driver"))
+		}
+		if c.Mail.SMTPTLS != "starttls" && c.Mail.SMTPTLS != "tls" && c.Mail.SMTPTLS != "none" {
+			errs = append(errs, fmt.Errorf("mail.smtp_tls (SMTP_TLS) %q must be starttls, tls or none", c.Mail.SMTPTLS))
+		}
+	case "file", "log":
+	default:
+		errs = append(errs, fmt.Errorf("mail.driver (MAIL_DRIVER) %q must be smtp, file or log", c.Mail.Driver))
+	}
+	if c.Mail.From == "" {
+		errs = append(errs, errors.New("mail.from (MAIL_FROM) must not be empty"))
+	}
+	if c.Mail.Workers < 1 {
+		errs = append(errs, errors.New("mail.workers (MAIL_WORKERS) must be at least 1"))
+	}
+	if c.SSO.OIDCClientID != "" && c.SSO.OIDCIssuer == "" {
+		errs = append(errs, errors.New("sso.oidc_issuer (OIDC_ISSUER) is required with OIDC_CLIENT_ID"))
+	}
+	if !ssoName.MatchString(c.SSO.OIDCName) || c.SSO.OIDCName == "google" || c.SSO.OIDCName == "github" {
+		errs = append(errs, fmt.Errorf("sso.oidc_name (OIDC_NAME) %q must be lowercase letters, digits or dashes and not google or github", c.SSO.OIDCName))
+	}
+	if c.Lockout.BackoffAfter < 0 || c.Lockout.AccountThreshold < 1 || c.Lockout.IPThreshold < 1 {
+		errs = append(errs, errors.New("lockout.backoff_after must not be negative and the lockout thresholds must be at least 1"))
+	}
+	if c.PoW.Difficulty < 1 || c.PoW.MaxDifficulty < c.PoW.Difficulty || c.PoW.MaxDifficulty > 32 {
+		errs = append(errs, errors.New("pow.difficulty must be at least 1 and at most pow.max_difficulty, which must be at most 32"))
+	}
+	if c.PoW.LoadThreshold < 1 || c.PoW.LoginAfter < 1 {
+		errs = append(errs, errors.New("pow.load_threshold and pow.login_after must be at least 1"))
+	}
+	if c.Export.Workers < 1 {
+		errs = append(errs, errors.New("export.workers must be at least 1"))
+	}
+	if c.RateLimit.Requests < 1 {
+		errs = append(errs, errors.New("rate_limit.requests must be at least 1"))
+	}
+
+	for name, d := range map[string]time.Duration{
+		"server.shutdown_timeout": c.Server.ShutdownTimeout,
+		"mongo.connect_timeout":   c.Mongo.ConnectTimeout,
+		"mongo.operation_timeout": c.Mongo.OperationTimeout,
+		"auth.token_ttl":          c.Auth.TokenTTL,
+		"auth.verification_ttl":   c.Auth.VerificationTTL,
+		"auth.reset_token_ttl":    c.Auth.ResetTokenTTL,
+		"mail.timeout":            c.Mail.Timeout,
+		"sso.timeout":             c.SSO.Timeout,
+		"lockout.backoff_base":    c.Lockout.BackoffBase,
+		"lockout.duration":        c.Lockout.Duration,
+		"lockout.window":          c.Lockout.Window,
+		"pow.ttl":                 c.PoW.TTL,
+		"account.deletion_grace":  c.Account.DeletionGrace,
+		"account.purge_interval":  c.Account.PurgeInterval,
+		"export.link_ttl":         c.Export.LinkTTL,
+		"export.timeout":          c.Export.Timeout,
+		"ai.generation_timeout":   c.AI.GenerationTimeout,
+		"ai.router_timeout":       c.AI.RouterTimeout,
+		"search.timeout":          c.Search.Timeout,
+		"rate_limit.window":       c.RateLimit.Window,
+	} {
+		if d <= 0 {
+			errs = append(errs, fmt.Errorf("%s must be positive", name))
+		}
+	}
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.Log.Level)); err != nil {
+		errs = append(errs, fmt.Errorf("log.level %q is not a valid level", c.Log.Level))
+	}
+	if f := strings.ToLower(c.Log.Format); f != "json" && f != "text" {
+		errs = append(errs, fmt.Errorf("log.format %q must be json or text", c.Log.Format))
+	}
+
+	return errors.Join(errs...)
+}
+
+// ssoName keeps provider names safe to use in URL paths.
+var ssoName = regexp.MustCompile(`^[a-z0-9-]+$`)
+
+// Warnings lists settings that are legal but probably unintended.
+func (c *Config) Warnings() []string {
+	var warnings []string
+	if c.AI.APIKey == "" {
+		warnings = append(warnings, "GEMINI_API_KEY is empty, chat replies will fail and search routing is disabled")
+	}
+	if len(c.Auth.JWTSecret) < 32 {
+		warnings = append(warnings, "JWT_SECRET is shorter than 32 bytes, consider a longer random secret")
+	}
+	if c.Auth.RequireVerifiedEmail && c.Mail.Driver != "smtp" {
+		warnings = append(warnings, "REQUIRE_VERIFIED_EMAIL is on but MAIL_DRIVER is not smtp, verification emails won't reach users")
+	}
+	return warnings
+}
@@ -0,0 +1,330 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/goccy/go-yaml"
+	"github.com/joho/godotenv"
+	"github.com/pelletier/go-toml/v2"
+	"github.com/sarwanazhar/chatappbackend/logging"
+)
+
+// setting ties one Config field to its file key, environment variable and
+// flag. The flag name is the file key with dots and underscores as dashes.
+type setting struct {
+	key   string
+	env   string
+	usage string
+	set   func(string) error
+}
+
+func (s setting) flagName() string {
+	return strings.NewReplacer(".", "-", "_", "-").Replace(s.key)
+}
+
+func (c *Config) settings() []setting {
+	return []setting{
+		{"server.port", "PORT", "HTTP listen port", stringVar(&c.Server.Port)},
+		{"server.shutdown_timeout", "SHUTDOWN_TIMEOUT", "grace period for in-flight requests on shutdown", durationVar(&c.Server.ShutdownTimeout)},
+		{"server.trusted_proxies", "TRUSTED_PROXIES", "comma-separated proxy IPs or CIDRs allowed to set X-Forwarded-For", listVar(&c.Server.TrustedProxies)},
+		{"server.public_url", "PUBLIC_URL", "public origin of this server, for links to the API", stringVar(&c.Server.PublicURL)},
+
+		{"mongo.uri", "MONGODB_URI", "MongoDB connection string", stringVar(&c.Mongo.URI)},
+		{"mongo.database", "MONGODB_DATABASE", "MongoDB database name", stringVar(&c.Mongo.Database)},
+		{"mongo.connect_timeout", "MONGODB_CONNECT_TIMEOUT", "timeout for the initial connection", durationVar(&c.Mongo.ConnectTimeout)},
+		{"mongo.operation_timeout", "MONGODB_OPERATION_TIMEOUT", "timeout for a single query", durationVar(&c.Mongo.OperationTimeout)},
+		{"mongo.auto_migrate", "MONGODB_AUTO_MIGRATE", "apply pending migrations on startup", boolVar(&c.Mongo.AutoMigrate)},
+
+		{"auth.jwt_secret", "JWT_SECRET", "secret used to sign emailed links and encrypt signing keys", stringVar(&c.Auth.JWTSecret)},
+		{"auth.token_ttl", "JWT_TTL", "access token lifetime", durationVar(&c.Auth.TokenTTL)},
+		{"auth.signing_algorithm", "JWT_ALGORITHM", "access token signature algorithm, RS256 or EdDSA", stringVar(&c.Auth.SigningAlgorithm)},
+		{"auth.key_rotation", "JWT_KEY_ROTATION", "how long one key signs access tokens before the next takes over", durationVar(&c.Auth.KeyRotation)},
+		{"auth.accept_hs256", "JWT_ACCEPT_HS256", "accept access tokens signed with JWT_SECRET that carry exp and iat, during an upgrade", boolVar(&c.Auth.AcceptHS256)},
+		{"auth.require_verified_email", "REQUIRE_VERIFIED_EMAIL", "block chat routes until the email is verified", boolVar(&c.Auth.RequireVerifiedEmail)},
+		{"auth.verify_email_url", "VERIFY_EMAIL_URL", "frontend page linked from verification emails", stringVar(&c.Auth.VerifyEmailURL)},
+		{"auth.verification_ttl", "VERIFICATION_TTL", "lifetime of an email verification link", durationVar(&c.Auth.VerificationTTL)},
+		{"auth.reset_password_url", "RESET_PASSWORD_URL", "frontend page linked from password reset emails", stringVar(&c.Auth.ResetPasswordURL)},
+		{"auth.reset_token_ttl", "RESET_TOKEN_TTL", "lifetime of a password reset link", durationVar(&c.Auth.ResetTokenTTL)},
+		{"auth.change_email_url", "CHANGE_EMAIL_URL", "frontend page linked from email change confirmations", stringVar(&c.Auth.ChangeEmailURL)},
+		{"auth.fold_plus_addresses", "EMAIL_FOLD_PLUS", "treat name+tag@example.com as the same account as name@example.com; run chatadmin normalize-emails after changing it", boolVar(&c.Auth.FoldPlusAddresses)},
+
+		{"password.min_length", "PASSWORD_MIN_LENGTH", "fewest characters a new password may have", intVar(&c.Password.MinLength)},
+		{"password.breached_list", "PASSWORD_BREACHED_LIST", "Pwned Passwords range directory or sorted hash file new passwords must not be in", stringVar(&c.Password.BreachedList)},
+		{"password.algorithm", "PASSWORD_ALGORITHM", "hash for new passwords, argon2id or bcrypt", stringVar(&c.Password.Algorithm)},
+		{"password.argon2_memory", "PASSWORD_ARGON2_MEMORY", "argon2id memory in KiB", intVar(&c.Password.Argon2Memory)},
+		{"password.argon2_time", "PASSWORD_ARGON2_TIME", "argon2id passes over memory", intVar(&c.Password.Argon2Time)},
+		{"password.argon2_threads", "PASSWORD_ARGON2_THREADS", "argon2id parallelism", intVar(&c.Password.Argon2Threads)},
+		{"password.bcrypt_cost", "PASSWORD_BCRYPT_COST", "bcrypt cost", intVar(&c.Password.BcryptCost)},
+
+		{"lockout.enabled", "LOCKOUT_ENABLED", "throttle and lock out repeated failed logins", boolVar(&c.Lockout.Enabled)},
+		{"lockout.backoff_after", "LOCKOUT_BACKOFF_AFTER", "failed logins for an email before each attempt must wait", intVar(&c.Lockout.BackoffAfter)},
+		{"lockout.backoff_base", "LOCKOUT_BACKOFF_BASE", "first wait after backoff starts, doubling per failure", durationVar(&c.Lockout.BackoffBase)},
+		{"lockout.account_threshold", "LOCKOUT_ACCOUNT_THRESHOLD", "failed logins for an email that lock it", intVar(&c.Lockout.AccountThreshold)},
+		{"lockout.ip_threshold", "LOCKOUT_IP_THRESHOLD", "failed logins from an IP that lock it", intVar(&c.Lockout.IPThreshold)},
+		{"lockout.duration", "LOCKOUT_DURATION", "how long a lockout lasts", durationVar(&c.Lockout.Duration)},
+		{"lockout.window", "LOCKOUT_WINDOW", "how long a failed login is remembered", durationVar(&c.Lockout.Window)},
+		{"lockout.notify", "LOCKOUT_NOTIFY", "email users when their account is locked", boolVar(&c.Lockout.Notify)},
+
+		{"pow.enabled", "POW_ENABLED", "require a proof-of-work solution to register, and to log in after failures", boolVar(&c.PoW.Enabled)},
+		{"pow.difficulty", "POW_DIFFICULTY", "leading zero bits a solution needs", intVar(&c.PoW.Difficulty)},
+		{"pow.max_difficulty", "POW_MAX_DIFFICULTY", "difficulty ceiling under load", intVar(&c.PoW.MaxDifficulty)},
+		{"pow.load_threshold", "POW_LOAD_THRESHOLD", "register and login requests per minute before difficulty rises", intVar(&c.PoW.LoadThreshold)},
+		{"pow.login_after", "POW_LOGIN_AFTER", "failed logins for an email or IP before login needs a solution", intVar(&c.PoW.LoginAfter)},
+		{"pow.ttl", "POW_TTL", "lifetime of a challenge", durationVar(&c.PoW.TTL)},
+
+		{"account.deletion_grace", "ACCOUNT_DELETION_GRACE", "how long a deleted account can be restored", durationVar(&c.Account.DeletionGrace)},
+		{"account.purge_interval", "ACCOUNT_PURGE_INTERVAL", "how often accounts past their grace period are removed", durationVar(&c.Account.PurgeInterval)},
+
+		{"export.link_ttl", "EXPORT_LINK_TTL", "how long a finished data export can be downloaded", durationVar(&c.Export.LinkTTL)},
+		{"export.timeout", "EXPORT_TIMEOUT", "time limit for one data export, waiting for a worker included", durationVar(&c.Export.Timeout)},
+		{"export.workers", "EXPORT_WORKERS", "data exports built at once", intVar(&c.Export.Workers)},
+
+		{"ai.api_key", "GEMINI_API_KEY", "Google Gemini API key", stringVar(&c.AI.APIKey)},
+		{"ai.chat_model", "GEMINI_CHAT_MODEL", "model answering chat messages", stringVar(&c.AI.ChatModel)},
+		{"ai.router_model", "GEMINI_ROUTER_MODEL", "model deciding whether to search", stringVar(&c.AI.RouterModel)},
+		{"ai.generation_timeout", "GENERATION_TIMEOUT", "timeout for a whole chat message request", durationVar(&c.AI.GenerationTimeout)},
+		{"ai.router_timeout", "ROUTER_TIMEOUT", "timeout for the search routing call", durationVar(&c.AI.RouterTimeout)},
+		{"ai.history_messages", "HISTORY_MESSAGES", "previous messages sent as context", intVar(&c.AI.HistoryMessages)},
+
+		{"search.enabled", "SEARCH_ENABLED", "allow web search", boolVar(&c.Search.Enabled)},
+		{"search.timeout", "SEARCH_TIMEOUT", "web search timeout", durationVar(&c.Search.Timeout)},
+		{"search.max_results", "SEARCH_MAX_RESULTS", "web results injected into the prompt", intVar(&c.Search.MaxResults)},
+
+		{"rate_limit.requests", "RATE_LIMIT_REQUESTS", "requests allowed per window", intVar(&c.RateLimit.Requests)},
+		{"rate_limit.window", "RATE_LIMIT_WINDOW", "rate limit window", durationVar(&c.RateLimit.Window)},
+
+		{"log.level", "LOG_LEVEL", "debug, info, warn or error", stringVar(&c.Log.Level)},
+		{"log.format", "LOG_FORMAT", "json or text", stringVar(&c.Log.Format)},
+		{"log.redact", "LOG_REDACT", "mask emails, passwords and prompts in logs", boolVar(&c.Log.Redact)},
+
+		{"mail.driver", "MAIL_DRIVER", "smtp, file or log", stringVar(&c.Mail.Driver)},
+		{"mail.from", "MAIL_FROM", "sender address of outgoing mail", stringVar(&c.Mail.From)},
+		{"mail.smtp_host", "SMTP_HOST", "SMTP server host", stringVar(&c.Mail.SMTPHost)},
+		{"mail.smtp_port", "SMTP_PORT", "SMTP server port", intVar(&c.Mail.SMTPPort)},
+		{"mail.smtp_username", "SMTP_USERNAME", "SMTP username, empty for no auth", stringVar(&c.Mail.SMTPUsername)},
+		{"mail.smtp_password", "SMTP_PASSWORD", "SMTP password", stringVar(&c.Mail.SMTPPassword)},
+		{"mail.smtp_tls", "SMTP_TLS", "starttls, tls or none", stringVar(&c.Mail.SMTPTLS)},
+		{"mail.file_dir", "MAIL_FILE_DIR", "directory the file driver writes .eml files to", stringVar(&c.Mail.FileDir)},
+		{"mail.timeout", "MAIL_TIMEOUT", "timeout for sending one message", durationVar(&c.Mail.Timeout)},
+		{"mail.workers", "MAIL_WORKERS", "background emails sent at once; more are dropped", intVar(&c.Mail.Workers)},
+
+		{"sso.callback_base_url", "SSO_CALLBACK_BASE_URL", "public origin of this server, used in provider callback URLs", stringVar(&c.SSO.CallbackBaseURL)},
+		{"sso.redirect_url", "SSO_REDIRECT_URL", "frontend page receiving the token after a provider login", stringVar(&c.SSO.RedirectURL)},
+		{"sso.timeout", "SSO_TIMEOUT", "timeout for calls to identity providers", durationVar(&c.SSO.Timeout)},
+		{"sso.google_client_id", "GOOGLE_CLIENT_ID", "Google OAuth client ID, empty to disable", stringVar(&c.SSO.GoogleClientID)},
+		{"sso.google_client_secret", "GOOGLE_CLIENT_SECRET", "Google OAuth client secret", stringVar(&c.SSO.GoogleClientSecret)},
+		{"sso.github_client_id", "GITHUB_CLIENT_ID", "GitHub OAuth app client ID, empty to disable", stringVar(&c.SSO.GitHubClientID)},
+		{"sso.github_client_secret", "GITHUB_CLIENT_SECRET", "GitHub OAuth app client secret", stringVar(&c.SSO.GitHubClientSecret)},
+		{"sso.oidc_name", "OIDC_NAME", "provider name for the custom OpenID Connect issuer", stringVar(&c.SSO.OIDCName)},
+		{"sso.oidc_issuer", "OIDC_ISSUER", "custom OpenID Connect issuer URL", stringVar(&c.SSO.OIDCIssuer)},
+		{"sso.oidc_client_id", "OIDC_CLIENT_ID", "client ID at the custom issuer, empty to disable", stringVar(&c.SSO.OIDCClientID)},
+		{"sso.oidc_client_secret", "OIDC_CLIENT_SECRET", "client secret at the custom issuer", stringVar(&c.SSO.OIDCClientSecret)},
+	}
+}
+
+// Load builds the configuration from args (usually os.Args[1:]). A .env file
+// in the working directory is loaded first when present; real environment
+// variables always win over it.
+func Load(args []string) (*Config, error) {
+	cfg, _, err := LoadCommand("chatappbackend", args)
+	return cfg, err
+}
+
+// LoadCommand is Load for binaries that take positional arguments after the
+// config flags, e.g. `chatadmin -config c.yaml stats`. It returns those
+// arguments untouched.
+func LoadCommand(name string, args []string) (*Config, []string, error) {
+	if err := godotenv.Load(); err == nil {
+		slog.Info("✅ .env loaded")
+	}
+
+	cfg := Default()
+	settings := cfg.settings()
+
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	configFile := fs.String("config", os.Getenv("CONFIG_FILE"), "path to a YAML or TOML config file")
+	flagValues := make(map[string]*string, len(settings))
+	for _, s := range settings {
+		flagValues[s.key] = fs.String(s.flagName(), "", fmt.Sprintf("%s (env %s)", s.usage, s.env))
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	if *configFile != "" {
+		values, err := readFile(*configFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := apply(settings, func(s setting) (string, bool) {
+			v, ok := values[s.key]
+			delete(values, s.key)
+			return v, ok
+		}, "file"); err != nil {
+			return nil, nil, err
+		}
+		if len(values) > 0 {
+			unknown := make([]string, 0, len(values))
+			for k := range values {
+				unknown = append(unknown, k)
+			}
+			sort.Strings(unknown)
+			return nil, nil, fmt.Errorf("config file %s: unknown keys %s", *configFile, strings.Join(unknown, ", "))
+		}
+	}
+
+	if err := apply(settings, func(s setting) (string, bool) {
+		return os.LookupEnv(s.env)
+	}, "env"); err != nil {
+		return nil, nil, err
+	}
+
+	visited := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { visited[f.Name] = true })
+	if err := apply(settings, func(s setting) (string, bool) {
+		if !visited[s.flagName()] {
+			return "", false
+		}
+		return *flagValues[s.key], true
+	}, "flag"); err != nil {
+		return nil, nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, nil, fmt.Errorf("invalid configuration:\n%w", err)
+	}
+	return cfg, fs.Args(), nil
+}
+
+// LoggingOptions converts the log section for logging.New.
+func (l LogConfig) LoggingOptions() logging.Options {
+	var level slog.Level
+	_ = level.UnmarshalText([]byte(l.Level))
+	return logging.Options{Level: level, Format: strings.ToLower(l.Format), Redact: l.Redact}
+}
+
+func apply(settings []setting, lookup func(setting) (string, bool), source string) error {
+	var errs []error
+	for _, s := range settings {
+		v, ok := lookup(s)
+		if !ok {
+			continue
+		}
+		if err := s.set(v); err != nil {
+			errs = append(errs, fmt.Errorf("%s %s: %w", source, s.key, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// readFile decodes a YAML or TOML file and flattens nested tables into
+// dotted keys, e.g. {mongo: {uri: ...}} becomes "mongo.uri".
+func readFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading config file: %w", err)
+	}
+
+	raw := map[string]any{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &raw)
+	case ".toml":
+		err = toml.Unmarshal(data, &raw)
+	default:
+		return nil, fmt.Errorf("config file %s: unsupported extension, use .yaml, .yml or .toml", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parsing config file %s: %w", path, err)
+	}
+
+	values := map[string]string{}
+	flatten("", raw, values)
+	return values, nil
+}
+
+// flatten turns nested tables into dotted keys with string values, the
+// form the environment and flags use; a list becomes comma-separated.
+func flatten(prefix string, in map[string]any, out map[string]string) {
+	for k, v := range in {
+		key := k
+		if prefix != "" {
+			key = prefix + "." + k
+		}
+		switch v := v.(type) {
+		case map[string]any:
+			flatten(key, v, out)
+		case []any:
+			items := make([]string, len(v))
+			for i, item := range v {
+				items[i] = fmt.Sprint(item)
+			}
+			out[key] = strings.Join(items, ",")
+		default:
+			out[key] = fmt.Sprint(v)
+		}
+	}
+}
+
+func stringVar(p *string) func(string) error {
+	return func(v string) error {
+		*p = v
+		return nil
+	}
+}
+
+func durationVar(p *time.Duration) func(string) error {
+	return func(v string) error {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return err
+		}
+		*p = d
+		return nil
+	}
+}
+
+func intVar(p *int) func(string) error {
+	return func(v string) error {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return err
+		}
+		*p = n
+		return nil
+	}
+}
+
+// listVar reads a comma-separated list, ignoring blanks around items.
+func listVar(p *[]string) func(string) error {
+	return func(v string) error {
+		var items []string
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		*p = items
+		return nil
+	}
+}
+
+func boolVar(p *bool) func(string) error {
+	return func(v string) error {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return err
+		}
+		*p = b
+		return nil
+	}
+}
@@ -0,0 +1,361 @@
+package controlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/chatappbackend/libs"
+	"github.com/sarwanazhar/chatappbackend/logging"
+	"github.com/sarwanazhar/chatappbackend/mail"
+	"github.com/sarwanazhar/chatappbackend/model"
+	"github.com/sarwanazhar/chatappbackend/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const changeEmailPurpose = "change_email"
+
+// reauthWindow is how recently a user without a password must have signed
+// in to change their account.
+const reauthWindow = 10 * time.Minute
+
+// ChangePassword replaces the signed-in user's password and signs out every
+// other session. It needs json
+// {"currentPassword": "", "newPassword": "", "code": ""} and answers with a
+// fresh token for this client.
+func (a *App) ChangePassword(c *gin.Context) {
+	var body ChangePasswordRequest
+	if err := c.ShouldBindJSON(&body); err != nil {
+		libs.RespondError(c, libs.CodeInvalidRequest, "Invalid request body")
+		return
+	}
+	user, ok := a.currentUser(c)
+	if !ok || !a.confirmIdentity(c, user, body.CurrentPassword, body.Code) {
+		return
+	}
+
+	ctx := c.Request.Context()
+	logger := logging.FromContext(ctx)
+
+	if problem := a.checkNewPassword(ctx, "newPassword", body.NewPassword, user.Email); problem != nil {
+		libs.RespondInvalid(c, problem.Message, *problem)
+		return
+	}
+
+	hashedPassword, err := a.Passwords.Hash(body.NewPassword)
+	if err != nil {
+		logger.Error("failed to hash password", "error", err)
+		libs.RespondError(c, libs.CodeInternal, "Internal server error. Please try again later.")
+		return
+	}
+	if err := a.Repos.Users.SetPassword(ctx, user.ID, hashedPassword); err != nil {
+		logger.Error("failed to change password", "user_id", user.ID.Hex(), "error", err)
+		libs.RespondError(c, libs.CodeInternal, "Internal server error. Please try again later.")
+		return
+	}
+	logger.Info("password changed", "user_id", user.ID.Hex())
+	a.sendNotice(ctx, user, mail.PasswordChanged(user.Email))
+
+	// SetPassword ended every session, this one included
+	token, err := a.startSession(c, user)
+	if err != nil {
+		logger.Error("failed to start session", "user_id", user.ID.Hex(), "error", err)
+		libs.RespondError(c, libs.CodeInternal, "Could not generate token")
+		return
+	}
+	c.JSON(http.StatusOK, newLoginResponse(token, user))
+}
+
+// ChangeEmail emails a confirmation link to a new address. The account
+// keeps its current address until the link is opened. It needs json
+// {"email": "", "password": "", "code": ""}.
+func (a *App) ChangeEmail(c *gin.Context) {
+	var body ChangeEmailRequest
+	if err := c.ShouldBindJSON(&body); err != nil {
+		libs.RespondError(c, libs.CodeInvalidRequest, "Email is required")
+		return
+	}
+	email, problem := a.normalizeEmail("email", body.Email)
+	if problem != nil {
+		libs.RespondInvalid(c, problem.Message, *problem)
+		return
+	}
+	user, ok := a.currentUser(c)
+	if !ok || !a.confirmIdentity(c, user, body.Password, body.Code) {
+		return
+	}
+	if email == user.Email {
+		libs.RespondError(c, libs.CodeInvalidRequest, "That is already your email address")
+		return
+	}
+
+	ctx := c.Request.Context()
+	logger := logging.FromContext(ctx)
+
+	// Another address of this same account, e.g. a different +tag, only
+	// changes where mail goes
+	var taken bool
+	var err error
+	if key := a.emailKey(email); key != a.emailKey(user.Email) {
+		taken, err = a.Repos.Users.EmailExists(ctx, key)
+	}
+	if err != nil {
+		logger.Error("failed to check email existence", "error", err)
+		libs.RespondError(c, libs.CodeInternal, "Internal server error. Please try again later.")
+		return
+	}
+	if taken {
+		libs.RespondError(c, libs.CodeEmailTaken, "This email address is already registered.")
+		return
+	}
+
+	if err := a.sendEmailChange(ctx, user, email); err != nil {
+		logger.Error("failed to send email change confirmation", "user_id", user.ID.Hex(), "error", err)
+		libs.RespondError(c, libs.CodeInternal, "Internal server error. Please try again later.")
+		return
+	}
+	logger.Info("email change requested", "user_id", user.ID.Hex())
+	c.JSON(http.StatusAccepted, InfoResponse{Message: "Open the link we sent to " + email + " to finish the change"})
+}
+
+// ConfirmEmailChange consumes the token from an email change confirmation
+// and switches the account to the new address. It needs json {"token": ""}.
+func (a *App) ConfirmEmailChange(c *gin.Context) {
+	var body VerifyEmailRequest
+	if err := c.ShouldBindJSON(&body); err != nil {
+		libs.RespondError(c, libs.CodeInvalidRequest, "Token is required")
+		return
+	}
+
+	ctx := c.Request.Context()
+	logger := logging.FromContext(ctx)
+
+	token, err := libs.ParseLinkToken(a.Config.Auth.JWTSecret, changeEmailPurpose, body.Token)
+	if errors.Is(err, libs.ErrLinkTokenExpired) {
+		libs.RespondError(c, libs.CodeLinkExpired, "This confirmation link has expired, request the change again")
+		return
+	}
+	if err != nil {
+		libs.RespondError(c, libs.CodeLinkInvalid, "This confirmation link is invalid")
+		return
+	}
+
+	userID, err := a.Repos.Tokens.Consume(ctx, token.NonceHash(), changeEmailPurpose)
+	if errors.Is(err, repository.ErrNotFound) || (err == nil && userID.Hex() != token.Subject) {
+		libs.RespondError(c, libs.CodeLinkInvalid, "This confirmation link was already used or replaced by a newer one")
+		return
+	}
+	if err != nil {
+		logger.Error("failed to consume email change token", "error", err)
+		libs.RespondError(c, libs.CodeInternal, "Internal server error. Please try again later.")
+		return
+	}
+
+	user, err := a.Repos.Users.FindByID(ctx, userID.Hex())
+	if errors.Is(err, repository.ErrNotFound) || (err == nil && user.PendingEmail == "") {
+		libs.RespondError(c, libs.CodeLinkInvalid, "This confirmation link is invalid")
+		return
+	}
+	if err != nil {
+		logger.Error("failed to load user", "user_id", userID.Hex(), "error", err)
+		libs.RespondError(c, libs.CodeInternal, "Internal server error. Please try again later.")
+		return
+	}
+
+	oldEmail, newEmail := user.Email, user.PendingEmail
+	err = a.Repos.Users.ChangeEmail(ctx, user.ID, newEmail, a.emailKey(newEmail))
+	if errors.Is(err, repository.ErrDuplicate) {
+		libs.RespondError(c, libs.CodeEmailTaken, "This email address is already registered.")
+		return
+	}
+	if errors.Is(err, repository.ErrNotFound) {
+		libs.RespondError(c, libs.CodeLinkInvalid, "This confirmation link is invalid")
+		return
+	}
+	if err != nil {
+		logger.Error("failed to change email", "user_id", user.ID.Hex(), "error", err)
+		libs.RespondError(c, libs.CodeInternal, "Internal server error. Please try again later.")
+		return
+	}
+	logger.Info("email changed", "user_id", user.ID.Hex())
+	a.sendNotice(ctx, user, mail.EmailChanged(oldEmail, newEmail))
+
+	c.JSON(http.StatusOK, InfoResponse{Message: "Email address changed"})
+}
+
+// ScheduleDeletion deletes the signed-in user's account, with their chats,
+// API keys and sessions, once the grace period has passed. Until then the
+// account works as before and the deletion can be cancelled. It needs json
+// {"password": "", "code": ""}.
+func (a *App) ScheduleDeletion(c *gin.Context) {
+	var body DeleteAccountRequest
+	if err := c.ShouldBindJSON(&body); err != nil {
+		libs.RespondError(c, libs.CodeInvalidRequest, "Invalid request body")
+		return
+	}
+	user, ok := a.currentUser(c)
+	if !ok || !a.confirmIdentity(c, user, body.Password, body.Code) {
+		return
+	}
+	// Asking again doesn't push the date back
+	if user.DeleteAt != nil {
+		c.JSON(http.StatusAccepted, AccountDeletionResponse{DeleteAt: *user.DeleteAt})
+		return
+	}
+
+	ctx := c.Request.Context()
+	deleteAt := time.Now().Add(a.Config.Account.DeletionGrace).UTC()
+	if err := a.Repos.Users.ScheduleDeletion(ctx, user.ID, &deleteAt); err != nil {
+		logging.FromContext(ctx).Error("failed to schedule deletion", "user_id", user.ID.Hex(), "error", err)
+		libs.RespondError(c, libs.CodeInternal, "Internal server error. Please try again later.")
+		return
+	}
+	logging.FromContext(ctx).Info("account deletion scheduled", "user_id", user.ID.Hex(), "delete_at", deleteAt)
+	if err := a.Repos.Tokens.RevokeAll(ctx, user.ID, exportPurpose); err != nil {
+		logging.FromContext(ctx).Error("failed to revoke export links", "user_id", user.ID.Hex(), "error", err)
+	}
+	a.sendNotice(ctx, user, mail.DeletionScheduled(user.Email, deleteAt))
+
+	c.JSON(http.StatusAccepted, AccountDeletionResponse{DeleteAt: deleteAt})
+}
+
+// CancelDeletion keeps the signed-in user's account after all.
+func (a *App) CancelDeletion(c *gin.Context) {
+	user, ok := a.currentUser(c)
+	if !ok {
+		return
+	}
+	if user.DeleteAt != nil {
+		err := a.Repos.Users.ScheduleDeletion(c.Request.Context(), user.ID, nil)
+		if errors.Is(err, repository.ErrNotFound) {
+			libs.RespondError(c, libs.CodeUserNotFound, "This account is already being deleted")
+			return
+		}
+		if err != nil {
+			logging.FromContext(c.Request.Context()).Error("failed to cancel deletion", "user_id", user.ID.Hex(), "error", err)
+			libs.RespondError(c, libs.CodeInternal, "Internal server error. Please try again later.")
+			return
+		}
+		logging.FromContext(c.Request.Context()).Info("account deletion cancelled", "user_id", user.ID.Hex())
+	}
+	c.JSON(http.StatusOK, InfoResponse{Message: "Your account will not be deleted"})
+}
+
+// PurgeDeletedAccounts removes accounts whose grace period has ended, every
+// account.purge_interval, until ctx is done.
+func (a *App) PurgeDeletedAccounts(ctx context.Context) {
+	ticker := time.NewTicker(a.Config.Account.PurgeInterval)
+	defer ticker.Stop()
+	for {
+		n, err := a.Repos.PurgeDeleted(ctx, time.Now())
+		if err != nil {
+			a.Logger.Error("failed to purge deleted accounts", "purged", n, "error", err)
+		} else if n > 0 {
+			a.Logger.Info("deleted accounts purged", "purged", n)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// confirmIdentity guards account changes against a borrowed session. It
+// asks for the password again, with the same throttling as login; an
+// account without one (created through SSO) must instead have signed in
+// within reauthWindow. With 2FA on, code must be a TOTP or recovery code
+// too. It has already responded when it returns false.
+func (a *App) confirmIdentity(c *gin.Context, user *model.User, password, code string) bool {
+	ctx := c.Request.Context()
+	if wait, _ := a.loginStatus(ctx, a.emailKey(user.Email), c.ClientIP()); wait > 0 {
+		respondLoginWait(c, wait)
+		return false
+	}
+
+	if user.Password == "" {
+		if !a.recentlySignedIn(c, user) {
+			libs.RespondError(c, libs.CodeReauthRequired, "Sign in again to confirm this change")
+			return false
+		}
+	} else if !a.checkPassword(ctx, user, password) {
+		a.loginFailed(ctx, a.emailKey(user.Email), c.ClientIP(), user)
+		libs.RespondError(c, libs.CodePasswordIncorrect, "Current password is incorrect")
+		return false
+	}
+
+	if !user.MFAEnabled() {
+		return true
+	}
+	if code == "" {
+		libs.RespondError(c, libs.CodeMFACodeRequired, "Enter a code from your authenticator app")
+		return false
+	}
+	ok, err := a.checkSecondFactor(ctx, user, code, true)
+	if err != nil {
+		logging.FromContext(ctx).Error("failed to check mfa code", "user_id", user.ID.Hex(), "error", err)
+		libs.RespondError(c, libs.CodeInternal, "Internal server error. Please try again later.")
+		return false
+	}
+	if !ok {
+		a.loginFailed(ctx, a.emailKey(user.Email), c.ClientIP(), user)
+		libs.RespondError(c, libs.CodeMFACodeInvalid, "Invalid authentication code")
+		return false
+	}
+	return true
+}
+
+// recentlySignedIn reports whether the request's session started within
+// reauthWindow.
+func (a *App) recentlySignedIn(c *gin.Context, user *model.User) bool {
+	sessionID, err := primitive.ObjectIDFromHex(c.GetString("sessionId"))
+	if err != nil {
+		return false
+	}
+	session, err := a.Repos.Sessions.FindOwned(c.Request.Context(), sessionID, user.ID)
+	if err != nil {
+		return false
+	}
+	return time.Since(session.CreatedAt) < reauthWindow
+}
+
+// sendEmailChange records email as the user's pending address and sends it
+// a fresh confirmation link. Links sent earlier stop working.
+func (a *App) sendEmailChange(ctx context.Context, user *model.User, email string) error {
+	cfg := a.Config.Auth
+	raw, token, err := libs.SignLinkToken(cfg.JWTSecret, changeEmailPurpose, user.ID.Hex(), cfg.VerificationTTL)
+	if err != nil {
+		return err
+	}
+	if err := a.Repos.Users.SetPendingEmail(ctx, user.ID, email); err != nil {
+		return err
+	}
+	if err := a.Repos.Tokens.RevokeAll(ctx, user.ID, changeEmailPurpose); err != nil {
+		return err
+	}
+	if err := a.Repos.Tokens.Issue(ctx, token.NonceHash(), changeEmailPurpose, user.ID, token.ExpiresAt); err != nil {
+		return err
+	}
+
+	link, err := withToken(cfg.ChangeEmailURL, raw)
+	if err != nil {
+		return err
+	}
+	if err := a.Mailer.Send(ctx, mail.ConfirmEmailChange(email, link, cfg.VerificationTTL)); err != nil {
+		return fmt.Errorf("sending mail: %w", err)
+	}
+	return nil
+}
+
+// sendNotice emails msg about user's account through the mail workers; the
+// change it reports has already happened.
+func (a *App) sendNotice(ctx context.Context, user *model.User, msg mail.Message) {
+	a.mailInBackground(ctx, "account notice", func(ctx context.Context) {
+		if err := a.Mailer.Send(ctx, msg); err != nil {
+			logging.FromContext(ctx).Error("failed to send account notice", "user_id", user.ID.Hex(), "subject", msg.Subject, "error", err)
+		}
+	})
+}
@@ -0,0 +1,233 @@
+package controlers
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/chatappbackend/libs"
+	"github.com/sarwanazhar/chatappbackend/logging"
+	"github.com/sarwanazhar/chatappbackend/model"
+	"github.com/sarwanazhar/chatappbackend/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// staffKey holds the signed-in staff member once RequirePermission passed.
+const staffKey = "staff"
+
+// Page sizes for the user search.
+const (
+	defaultUsersPage = 50
+	maxUsersPage     = 200
+)
+
+// RequirePermission lets the request through only if the signed-in user's
+// role grants perm. It runs after JWTMiddleware.
+func (a *App) RequirePermission(perm string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := a.currentUser(c)
+		if !ok {
+			return
+		}
+		if !libs.HasPermission(user.RoleName(), perm) {
+			libs.RespondError(c, libs.CodePermissionDenied, "You don't have permission to do this")
+			return
+		}
+		c.Set(staffKey, user)
+		c.Next()
+	}
+}
+
+// ListUsers searches users by email. It takes ?q=, ?offset= and ?limit=.
+func (a *App) ListUsers(c *gin.Context) {
+	offset, ok := queryInt(c, "offset", 0, 0, math.MaxInt32)
+	if !ok {
+		return
+	}
+	limit, ok := queryInt(c, "limit", defaultUsersPage, 1, maxUsersPage)
+	if !ok {
+		return
+	}
+
+	users, total, err := a.Repos.Users.Search(c.Request.Context(), c.Query("q"), offset, limit)
+	if err != nil {
+		logging.FromContext(c.Request.Context()).Error("failed to search users", "error", err)
+		libs.RespondError(c, libs.CodeInternal, "Internal server error. Please try again later.")
+		return
+	}
+
+	resp := AdminUserListResponse{Users: make([]AdminUserResponse, len(users)), Total: total, Offset: offset, Limit: limit}
+	for i := range users {
+		resp.Users[i] = newAdminUserResponse(&users[i])
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// GetUser returns one user with their chat and message counts.
+func (a *App) GetUser(c *gin.Context) {
+	user, ok := a.adminTarget(c)
+	if !ok {
+		return
+	}
+	usage, err := a.Repos.UsageOf(c.Request.Context(), user.ID)
+	if err != nil {
+		logging.FromContext(c.Request.Context()).Error("failed to load usage", "user_id", user.ID.Hex(), "error", err)
+		libs.RespondError(c, libs.CodeInternal, "Internal server error. Please try again later.")
+		return
+	}
+	c.JSON(http.StatusOK, AdminUserDetailResponse{User: newAdminUserResponse(user), Usage: *usage})
+}
+
+// SetUserDisabled returns the handler that disables or re-enables a user.
+// A disabled user's tokens and API keys stop working on their next request.
+func (a *App) SetUserDisabled(disabled bool) gin.HandlerFunc {
+	action := "enable_user"
+	if disabled {
+		action = "disable_user"
+	}
+	return func(c *gin.Context) {
+		user, ok := a.manageableTarget(c)
+		if !ok {
+			return
+		}
+		if err := a.Repos.Users.SetDisabled(c.Request.Context(), user.ID, disabled); err != nil {
+			a.respondAdminError(c, action, user, err)
+			return
+		}
+		a.logAdminAction(c, action, user)
+
+		user.Disabled = disabled
+		c.JSON(http.StatusOK, newAdminUserResponse(user))
+	}
+}
+
+// SetUserRole changes a user's role. It needs json {"role": "support"}.
+func (a *App) SetUserRole(c *gin.Context) {
+	var body SetRoleRequest
+	if err := c.ShouldBindJSON(&body); err != nil {
+		libs.RespondError(c, libs.CodeInvalidRequest, "Role is required")
+		return
+	}
+	if !slices.Contains(model.Roles, body.Role) {
+		libs.RespondError(c, libs.CodeInvalidRequest, "Unknown role "+body.Role)
+		return
+	}
+
+	user, ok := a.manageableTarget(c)
+	if !ok {
+		return
+	}
+	if err := a.Repos.Users.SetRole(c.Request.Context(), user.ID, body.Role); err != nil {
+		a.respondAdminError(c, "set_role", user, err)
+		return
+	}
+	a.logAdminAction(c, "set_role", user, "role", body.Role)
+
+	user.Role = body.Role
+	c.JSON(http.StatusOK, newAdminUserResponse(user))
+}
+
+// DeleteUser removes a user with their chats, API keys, sessions and tokens.
+func (a *App) DeleteUser(c *gin.Context) {
+	user, ok := a.manageableTarget(c)
+	if !ok {
+		return
+	}
+	if err := a.Repos.DeleteUser(c.Request.Context(), user.ID); err != nil {
+		a.respondAdminError(c, "delete_user", user, err)
+		return
+	}
+	a.logAdminAction(c, "delete_user", user)
+	c.JSON(http.StatusOK, InfoResponse{Message: "User deleted"})
+}
+
+// GetUsage returns service-wide usage. It takes ?top= for the number of
+// most active users to list.
+func (a *App) GetUsage(c *gin.Context) {
+	top, ok := queryInt(c, "top", 10, 0, 100)
+	if !ok {
+		return
+	}
+	stats, err := a.Repos.Usage(c.Request.Context(), int(top))
+	if err != nil {
+		logging.FromContext(c.Request.Context()).Error("failed to collect usage", "error", err)
+		libs.RespondError(c, libs.CodeInternal, "Internal server error. Please try again later.")
+		return
+	}
+	c.JSON(http.StatusOK, stats)
+}
+
+// adminTarget loads the user named by the :id path parameter. It has
+// already responded when ok is false.
+func (a *App) adminTarget(c *gin.Context) (*model.User, bool) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		libs.RespondError(c, libs.CodeInvalidRequest, "Invalid user ID format")
+		return nil, false
+	}
+	user, err := a.Repos.Users.FindByID(c.Request.Context(), id.Hex())
+	if errors.Is(err, repository.ErrNotFound) {
+		libs.RespondError(c, libs.CodeUserNotFound, "User not found")
+		return nil, false
+	}
+	if err != nil {
+		logging.FromContext(c.Request.Context()).Error("failed to load user", "user_id", id.Hex(), "error", err)
+		libs.RespondError(c, libs.CodeInternal, "Internal server error. Please try again later.")
+		return nil, false
+	}
+	return user, true
+}
+
+// manageableTarget is adminTarget for changes. Staff can't change their own
+// account this way, and only admins can change other staff accounts.
+func (a *App) manageableTarget(c *gin.Context) (*model.User, bool) {
+	user, ok := a.adminTarget(c)
+	if !ok {
+		return nil, false
+	}
+	staff := c.MustGet(staffKey).(*model.User)
+	if user.ID == staff.ID {
+		libs.RespondError(c, libs.CodeInvalidRequest, "You can't change your own account here")
+		return nil, false
+	}
+	if libs.IsStaff(user.RoleName()) && staff.RoleName() != model.RoleAdmin {
+		libs.RespondError(c, libs.CodePermissionDenied, "Only admins can change staff accounts")
+		return nil, false
+	}
+	return user, true
+}
+
+// respondAdminError answers a failed change to user.
+func (a *App) respondAdminError(c *gin.Context, action string, user *model.User, err error) {
+	if errors.Is(err, repository.ErrNotFound) {
+		libs.RespondError(c, libs.CodeUserNotFound, "User not found")
+		return
+	}
+	logging.FromContext(c.Request.Context()).Error("admin action failed", "action", action, "user_id", user.ID.Hex(), "error", err)
+	libs.RespondError(c, libs.CodeInternal, "Internal server error. Please try again later.")
+}
+
+// logAdminAction records who changed which account, as the audit trail.
+func (a *App) logAdminAction(c *gin.Context, action string, user *model.User, attrs ...any) {
+	staff := c.MustGet(staffKey).(*model.User)
+	attrs = append([]any{"action", action, "staff_id", staff.ID.Hex(), "user_id", user.ID.Hex()}, attrs...)
+	logging.FromContext(c.Request.Context()).Info("admin action", attrs...)
+}
+
+// queryInt reads an optional integer query parameter within [lo, hi]. It
+// has already responded when ok is false.
+func queryInt(c *gin.Context, name string, def, lo, hi int64) (int64, bool) {
+	raw, present := c.GetQuery(name)
+	if !present {
+		return def, true
+	}
+	n, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || n < lo || n > hi {
+		libs.RespondError(c, libs.CodeInvalidRequest, name+" must be a number from "+strconv.FormatInt(lo, 10)+" to "+strconv.FormatInt(hi, 10))
+		return 0, false
+	}
+	return n, true
+}
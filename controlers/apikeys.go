@@ -0,0 +1,131 @@
+package controlers
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/chatappbackend/libs"
+	"github.com/sarwanazhar/chatappbackend/logging"
+	"github.com/sarwanazhar/chatappbackend/model"
+	"github.com/sarwanazhar/chatappbackend/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// maxAPIKeys caps keys per user so a leaked session can't mint thousands.
+const maxAPIKeys = 25
+
+// ListAPIKeys returns the signed-in user's keys, without the keys themselves.
+func (a *App) ListAPIKeys(c *gin.Context) {
+	user, ok := a.currentUser(c)
+	if !ok {
+		return
+	}
+	keys, err := a.Repos.APIKeys.ListByUser(c.Request.Context(), user.ID)
+	if err != nil {
+		logging.FromContext(c.Request.Context()).Error("failed to list api keys", "user_id", user.ID.Hex(), "error", err)
+		libs.RespondError(c, libs.CodeInternal, "Internal server error. Please try again later.")
+		return
+	}
+
+	resp := APIKeyListResponse{APIKeys: make([]APIKeyResponse, len(keys))}
+	for i := range keys {
+		resp.APIKeys[i] = newAPIKeyResponse(&keys[i])
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// CreateAPIKey issues a key. It needs json
+// {"name": "", "scopes": ["chats:read"], "expiresAt": "2027-01-01T00:00:00Z"}
+// with expiresAt optional. The key is in this response only.
+func (a *App) CreateAPIKey(c *gin.Context) {
+	var body CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&body); err != nil {
+		libs.RespondError(c, libs.CodeInvalidRequest, "Name and scopes are required")
+		return
+	}
+	if len(body.Scopes) == 0 {
+		libs.RespondError(c, libs.CodeInvalidRequest, "At least one scope is required")
+		return
+	}
+	for _, scope := range body.Scopes {
+		if !slices.Contains(libs.Scopes, scope) {
+			libs.RespondError(c, libs.CodeInvalidRequest, "Unknown scope "+scope)
+			return
+		}
+	}
+	if body.ExpiresAt != nil && !body.ExpiresAt.After(time.Now()) {
+		libs.RespondError(c, libs.CodeInvalidRequest, "expiresAt must be in the future")
+		return
+	}
+
+	user, ok := a.currentUser(c)
+	if !ok {
+		return
+	}
+	logger := logging.FromContext(c.Request.Context())
+
+	count, err := a.Repos.APIKeys.CountByUser(c.Request.Context(), user.ID)
+	if err != nil {
+		logger.Error("failed to count api keys", "user_id", user.ID.Hex(), "error", err)
+		libs.RespondError(c, libs.CodeInternal, "Internal server error. Please try again later.")
+		return
+	}
+	if count >= maxAPIKeys {
+		libs.RespondError(c, libs.CodeAPIKeyLimit, "Revoke an API key before creating another")
+		return
+	}
+
+	raw, prefix, hash, err := libs.NewAPIKey()
+	if err != nil {
+		logger.Error("failed to generate api key", "error", err)
+		libs.RespondError(c, libs.CodeInternal, "Internal server error. Please try again later.")
+		return
+	}
+	slices.Sort(body.Scopes)
+	key := &model.APIKey{
+		UserID:    user.ID,
+		Name:      body.Name,
+		Prefix:    prefix,
+		Hash:      hash,
+		Scopes:    slices.Compact(body.Scopes),
+		ExpiresAt: body.ExpiresAt,
+	}
+	if err := a.Repos.APIKeys.Create(c.Request.Context(), key); err != nil {
+		logger.Error("failed to create api key", "user_id", user.ID.Hex(), "error", err)
+		libs.RespondError(c, libs.CodeInternal, "Internal server error. Please try again later.")
+		return
+	}
+	logger.Info("api key created", "user_id", user.ID.Hex(), "api_key_id", key.ID.Hex(), "scopes", key.Scopes)
+
+	c.Header("Location", "/v1/me/api-keys/"+key.ID.Hex())
+	c.JSON(http.StatusCreated, APIKeyCreatedResponse{Key: raw, APIKey: newAPIKeyResponse(key)})
+}
+
+// DeleteAPIKey revokes a key immediately.
+func (a *App) DeleteAPIKey(c *gin.Context) {
+	keyID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		libs.RespondError(c, libs.CodeInvalidRequest, "Invalid API key ID format")
+		return
+	}
+	user, ok := a.currentUser(c)
+	if !ok {
+		return
+	}
+
+	err = a.Repos.APIKeys.DeleteOwned(c.Request.Context(), keyID, user.ID)
+	if errors.Is(err, repository.ErrNotFound) {
+		libs.RespondError(c, libs.CodeAPIKeyNotFound, "API key not found")
+		return
+	}
+	if err != nil {
+		logging.FromContext(c.Request.Context()).Error("failed to delete api key", "api_key_id", keyID.Hex(), "error", err)
+		libs.RespondError(c, libs.CodeInternal, "Internal server error. Please try again later.")
+		return
+	}
+	logging.FromContext(c.Request.Context()).Info("api key revoked", "user_id", user.ID.Hex(), "api_key_id", keyID.Hex())
+	c.JSON(http.StatusOK, InfoResponse{Message: "API key revoked"})
+}
@@ -0,0 +1,75 @@
+package controlers
+
+import (
+	"context"
+	"iter"
+	"log/slog"
+	"time"
+
+	"github.com/sarwanazhar/chatappbackend/config"
+	"github.com/sarwanazhar/chatappbackend/libs"
+	"github.com/sarwanazhar/chatappbackend/mail"
+	"github.com/sarwanazhar/chatappbackend/repository"
+	"github.com/sarwanazhar/chatappbackend/sso"
+	"google.golang.org/genai"
+)
+
+// LLM answers chat messages and decides whether they need a web search.
+type LLM interface {
+	Model() string
+	DecideSearch(ctx context.Context, prompt string) string
+	GenerateStream(ctx context.Context, contents []*genai.Content, cfg *genai.GenerateContentConfig) iter.Seq2[*genai.GenerateContentResponse, error]
+}
+
+// WebSearcher returns search results formatted for a system instruction,
+// or "" when nothing useful was found.
+type WebSearcher interface {
+	SearchInternet(ctx context.Context, query string) string
+}
+
+// App owns everything the HTTP handlers need. Handlers are methods on it,
+// so several independent instances can live in one process.
+type App struct {
+	Config *config.Config
+	Repos  *repository.Repositories
+	LLM    LLM
+	Search WebSearcher
+	Mailer mail.Mailer
+	// SSO are the enabled identity providers by name.
+	SSO    sso.Providers
+	Logger *slog.Logger
+	// Keys sign and verify access tokens; LoadSigningKeys fills it.
+	Keys *libs.KeyRing
+	// Passwords hashes and checks passwords under the configured policy.
+	Passwords *libs.PasswordHasher
+	// PasswordPolicy decides which new passwords are accepted.
+	PasswordPolicy *libs.PasswordPolicy
+
+	// authLoad counts register and login requests to scale the
+	// proof-of-work difficulty.
+	authLoad *libs.LoadMeter
+	// exportSlots bounds how many data exports are built at once.
+	exportSlots chan struct{}
+	// mailSlots bounds how many background emails are sent at once.
+	mailSlots chan struct{}
+}
+
+func NewApp(cfg *config.Config, repos *repository.Repositories, llm LLM, search WebSearcher, mailer mail.Mailer, providers sso.Providers, logger *slog.Logger) *App {
+	return &App{
+		Config: cfg,
+		Repos:  repos,
+		LLM:    llm,
+		Search: search,
+		Mailer: mailer,
+		SSO:    providers,
+		Logger: logger,
+		Keys:   libs.NewKeyRing(),
+
+		Passwords:      libs.NewPasswordHasher(cfg.Password),
+		PasswordPolicy: libs.NewPasswordPolicy(cfg.Password),
+
+		authLoad:    libs.NewLoadMeter(time.Minute),
+		exportSlots: make(chan struct{}, cfg.Export.Workers),
+		mailSlots:   make(chan struct{}, cfg.Mail.Workers),
+	}
+}
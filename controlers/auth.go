@@ -0,0 +1,112 @@
+package controlers
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/sarwanazhar/chatappbackend/libs"
+	"github.com/sarwanazhar/chatappbackend/logging"
+	"github.com/sarwanazhar/chatappbackend/model"
+	"github.com/sarwanazhar/chatappbackend/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// errAccountDisabled rejects every credential of a disabled account, so
+// disabling takes effect on the next request rather than at token expiry.
+var errAccountDisabled = &libs.AuthError{Code: libs.CodeAccountDisabled, Message: "This account has been disabled"}
+
+// CheckToken implements libs.Authenticator. It refuses tokens for users
+// that no longer exist or are disabled, tokens issued before the user's
+// sessions were revoked, e.g. by a password reset, and tokens whose own
+// session was signed out.
+func (a *App) CheckToken(ctx context.Context, userID string, claims jwt.MapClaims) error {
+	user, err := a.Repos.Users.FindByID(ctx, userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return &libs.AuthError{Code: libs.CodeInvalidToken, Message: "Invalid token"}
+	}
+	if err != nil {
+		return err
+	}
+	if user.Disabled {
+		return errAccountDisabled
+	}
+
+	if user.TokensRevokedAt != nil {
+		issuedAt, err := claims.GetIssuedAt()
+		if err != nil || issuedAt == nil {
+			return &libs.AuthError{Code: libs.CodeInvalidToken, Message: "Invalid token claims"}
+		}
+		// iat only has second precision, so compare whole seconds: a token
+		// issued by a login right after the reset must keep working
+		if issuedAt.Unix() < user.TokensRevokedAt.Unix() {
+			return &libs.AuthError{Code: libs.CodeTokenRevoked, Message: "Session ended, sign in again"}
+		}
+	}
+	return a.checkSession(ctx, user, claims)
+}
+
+// checkSession refuses a token whose session is gone. Tokens signed before
+// sessions were recorded carry no sid and can't be signed out one by one;
+// they are only honoured while auth.accept_hs256 lets the legacy tokens in,
+// and the JWT middleware has already made sure they expire.
+func (a *App) checkSession(ctx context.Context, user *model.User, claims jwt.MapClaims) error {
+	raw, present := claims["sid"]
+	if !present {
+		if a.Config.Auth.AcceptHS256 {
+			return nil
+		}
+		return &libs.AuthError{Code: libs.CodeTokenRevoked, Message: "Session ended, sign in again"}
+	}
+	sid, _ := raw.(string)
+	sessionID, err := primitive.ObjectIDFromHex(sid)
+	if err != nil {
+		return &libs.AuthError{Code: libs.CodeInvalidToken, Message: "Invalid token claims"}
+	}
+	session, err := a.Repos.Sessions.FindOwned(ctx, sessionID, user.ID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return &libs.AuthError{Code: libs.CodeTokenRevoked, Message: "Session ended, sign in again"}
+	}
+	if err != nil {
+		return err
+	}
+
+	// Bookkeeping only; a failed write shouldn't fail the request
+	if err := a.Repos.Sessions.Touch(ctx, session.ID); err != nil {
+		logging.FromContext(ctx).Warn("failed to record session use", "session_id", session.ID.Hex(), "error", err)
+	}
+	return nil
+}
+
+// CheckAPIKey implements libs.Authenticator. Keys survive password resets
+// like any other integration credential; they end by revocation or expiry.
+func (a *App) CheckAPIKey(ctx context.Context, key string) (string, []string, error) {
+	apiKey, err := a.Repos.APIKeys.FindByHash(ctx, libs.HashAPIKey(key))
+	if errors.Is(err, repository.ErrNotFound) {
+		return "", nil, &libs.AuthError{Code: libs.CodeInvalidToken, Message: "Invalid API key"}
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	if apiKey.ExpiresAt != nil && time.Now().After(*apiKey.ExpiresAt) {
+		return "", nil, &libs.AuthError{Code: libs.CodeTokenExpired, Message: "API key expired"}
+	}
+
+	user, err := a.Repos.Users.FindByID(ctx, apiKey.UserID.Hex())
+	if errors.Is(err, repository.ErrNotFound) {
+		return "", nil, &libs.AuthError{Code: libs.CodeInvalidToken, Message: "Invalid API key"}
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	if user.Disabled {
+		return "", nil, errAccountDisabled
+	}
+
+	// Bookkeeping only; a failed write shouldn't fail the request
+	if err := a.Repos.APIKeys.Touch(ctx, apiKey.ID); err != nil {
+		logging.FromContext(ctx).Warn("failed to record api key use", "api_key_id", apiKey.ID.Hex(), "error", err)
+	}
+	return apiKey.UserID.Hex(), apiKey.Scopes, nil
+}
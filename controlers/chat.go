@@ -2,182 +2,253 @@ package controlers
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
-	"os"
-	"sort"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/sarwanazhar/chatappbackend/database"
 	"github.com/sarwanazhar/chatappbackend/libs"
+	"github.com/sarwanazhar/chatappbackend/logging"
+	"github.com/sarwanazhar/chatappbackend/metrics"
 	"github.com/sarwanazhar/chatappbackend/model"
-	"go.mongodb.org/mongo-driver/bson"
+	"github.com/sarwanazhar/chatappbackend/repository"
+	"github.com/sarwanazhar/chatappbackend/tracing"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/v2/mongo/options"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"google.golang.org/genai"
 )
 
-func CreateChat(c *gin.Context) {
+// CreateChat starts an empty chat. The v1 route accepts an optional
+// {"title": ""}; the legacy route sends no body.
+func (a *App) CreateChat(c *gin.Context) {
+	var body CreateChatRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&body); err != nil {
+			libs.RespondError(c, libs.CodeInvalidRequest, "Invalid chat title")
+			return
+		}
+	}
+	if body.Title == "" {
+		body.Title = "new chat"
+	}
+
 	userID := c.GetString("userId")
 
-	user, err := libs.FindUserByID(userID)
+	user, err := a.Repos.Users.FindByID(c.Request.Context(), userID)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		libs.RespondError(c, libs.CodeUserNotFound, "User not found")
 		return
 	}
 
-	chat := model.Chat{
-		ID:        primitive.NewObjectID(),
-		UserID:    user.ID,
-		Title:     "new chat",
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
+	chat, err := a.Repos.Chats.Create(c.Request.Context(), user.ID, body.Title)
+	if err != nil {
+		libs.RespondError(c, libs.CodeInternal, "failed to create chat")
+		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+	c.Header("Location", "/v1/chats/"+chat.ID.Hex())
+	c.JSON(http.StatusCreated, ChatCreatedResponse{Message: "chat created", ChatID: chat.ID.Hex()})
+}
 
-	_, err = database.GetCollection("chatApp", "chat").InsertOne(ctx, chat)
+// GetChatByID returns one of the caller's chats with its messages.
+func (a *App) GetChatByID(c *gin.Context) {
+	user, chatID, ok := a.ownedChatRequest(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	chat, err := a.Repos.Chats.FindOwned(c.Request.Context(), chatID, user.ID)
+	if errors.Is(err, repository.ErrNotFound) {
+		libs.RespondError(c, libs.CodeChatNotFound, "Chat not found")
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create chat"})
+		logging.FromContext(c.Request.Context()).Error("failed to fetch chat", "chat_id", chatID.Hex(), "error", err)
+		libs.RespondError(c, libs.CodeInternal, "failed to fetch chat")
 		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{
-		"message": "chat created",
-		"chatId":  chat.ID.Hex(),
-	})
+	c.JSON(http.StatusOK, ChatResponse{Chat: chat})
 }
 
-func DeleteChat(c *gin.Context) {
-	type Body struct {
-		ChatId string `json:"chat_id"`
+// UpdateChat renames a chat; it needs json {"title": ""}.
+func (a *App) UpdateChat(c *gin.Context) {
+	var body UpdateChatRequest
+	if err := c.ShouldBindJSON(&body); err != nil || body.Title == "" {
+		libs.RespondError(c, libs.CodeInvalidRequest, "Title is required")
+		return
 	}
 
-	var body Body
-	if err := c.ShouldBindJSON(&body); err != nil || body.ChatId == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "ChatId is required"})
+	user, chatID, ok := a.ownedChatRequest(c, c.Param("id"))
+	if !ok {
 		return
 	}
 
-	userID := c.GetString("userId")
-
-	user, err := libs.FindUserByID(userID)
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+	chat, err := a.Repos.Chats.Rename(c.Request.Context(), chatID, user.ID, body.Title)
+	if errors.Is(err, repository.ErrNotFound) {
+		libs.RespondError(c, libs.CodeChatNotFound, "Chat not found")
 		return
 	}
-
-	chatObjID, err := primitive.ObjectIDFromHex(body.ChatId)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ChatId"})
+		logging.FromContext(c.Request.Context()).Error("failed to rename chat", "chat_id", chatID.Hex(), "error", err)
+		libs.RespondError(c, libs.CodeInternal, "failed to update chat")
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+	c.JSON(http.StatusOK, ChatResponse{Chat: chat})
+}
 
-	filter := bson.M{"_id": chatObjID, "user_id": user.ID}
+// ownedChatRequest resolves the caller and parses rawChatID, writing the
+// error response itself when either fails.
+func (a *App) ownedChatRequest(c *gin.Context, rawChatID string) (*model.User, primitive.ObjectID, bool) {
+	user, err := a.Repos.Users.FindByID(c.Request.Context(), c.GetString("userId"))
+	if err != nil {
+		libs.RespondError(c, libs.CodeUserNotFound, "User not found")
+		return nil, primitive.NilObjectID, false
+	}
 
-	// Attempt to delete the chat
-	res, err := database.GetCollection("chatApp", "chat").DeleteOne(ctx, filter)
+	chatID, err := primitive.ObjectIDFromHex(rawChatID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete chat"})
+		libs.RespondError(c, libs.CodeInvalidRequest, "Invalid ChatId")
+		return nil, primitive.NilObjectID, false
+	}
+	return user, chatID, true
+}
+
+// DeleteChat removes a chat. The v1 route takes the chat from the path;
+// the legacy route needs json {"chat_id": ""}.
+func (a *App) DeleteChat(c *gin.Context) {
+	chatID := c.Param("id")
+	if chatID == "" {
+		var body LegacyDeleteChatRequest
+		if err := c.ShouldBindJSON(&body); err != nil {
+			libs.RespondError(c, libs.CodeInvalidRequest, "ChatId is required")
+			return
+		}
+		chatID = body.ChatID
+	}
+
+	user, chatObjID, ok := a.ownedChatRequest(c, chatID)
+	if !ok {
 		return
 	}
 
-	if res.DeletedCount == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Chat not found or not owned by user"})
+	// Attempt to delete the chat
+	err := a.Repos.Chats.DeleteOwned(c.Request.Context(), chatObjID, user.ID)
+	if errors.Is(err, repository.ErrNotFound) {
+		libs.RespondError(c, libs.CodeChatNotFound, "Chat not found or not owned by user")
+		return
+	}
+	if err != nil {
+		libs.RespondError(c, libs.CodeInternal, "Failed to delete chat")
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Chat deleted successfully"})
+	c.JSON(http.StatusOK, InfoResponse{Message: "Chat deleted successfully"})
 }
 
-func GetChat(c *gin.Context) {
+// GetChat lists the caller's chats, newest first.
+func (a *App) GetChat(c *gin.Context) {
 	userID := c.GetString("userId")
 
-	user, err := libs.FindUserByID(userID)
+	user, err := a.Repos.Users.FindByID(c.Request.Context(), userID)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		libs.RespondError(c, libs.CodeUserNotFound, "User not found")
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	filter := bson.M{"user_id": user.ID}
-	opts := options.Find().SetSort(bson.M{"created_at": -1})
-
-	cursor, err := database.GetCollection("chatApp", "chat").Find(ctx, filter, opts)
+	chats, err := a.Repos.Chats.ListByUser(c.Request.Context(), user.ID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch chats"})
+		logging.FromContext(c.Request.Context()).Error("failed to list chats", "error", err)
+		libs.RespondError(c, libs.CodeInternal, "failed to fetch chats")
 		return
 	}
-	defer cursor.Close(ctx)
 
-	var chats []model.Chat
-	if err := cursor.All(ctx, &chats); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to decode chats"})
+	c.JSON(http.StatusOK, ChatListResponse{Chats: chats})
+}
+
+// CreateMessage streams the model's reply to a prompt as server-sent events.
+// The v1 route takes the chat from the path and needs json {"prompt": ""};
+// the legacy route also needs "chat_id" in the body.
+func (a *App) CreateMessage(c *gin.Context) {
+	var body LegacyMessageRequest
+	var err error
+	if id := c.Param("id"); id != "" {
+		var req MessageRequest
+		err = c.ShouldBindJSON(&req)
+		body = LegacyMessageRequest{ChatID: id, Prompt: req.Prompt}
+	} else {
+		err = c.ShouldBindJSON(&body)
+	}
+	if err != nil {
+		libs.RespondError(c, libs.CodeInvalidRequest, "ChatId and Prompt are required")
 		return
 	}
 
-	for i := range chats {
-		sort.Slice(chats[i].Messages, func(a, b int) bool {
-			return chats[i].Messages[a].CreatedAt.Before(chats[i].Messages[b].CreatedAt)
-		})
-	}
+	cfg := a.Config
 
-	c.JSON(http.StatusOK, gin.H{"chats": chats})
-}
-func CreateMessage(c *gin.Context) {
-	type Body struct {
-		ChatId string `json:"chat_id"`
-		Prompt string `json:"prompt"`
-	}
+	// The generation must outlive a client disconnect so the reply still gets
+	// saved, so keep the request's trace but drop its cancellation.
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(c.Request.Context()), cfg.AI.GenerationTimeout)
+	defer cancel()
 
-	var body Body
-	if err := c.ShouldBindJSON(&body); err != nil || body.ChatId == "" || body.Prompt == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "ChatId and Prompt are required"})
+	userID := c.GetString("userId")
+	spanCtx, span := tracing.Start(ctx, "message.auth_lookup")
+	user, err := a.Repos.Users.FindByID(spanCtx, userID)
+	tracing.End(span, err)
+	if err != nil {
+		libs.RespondError(c, libs.CodeUserNotFound, "User not found")
 		return
 	}
 
-	userID := c.GetString("userId")
-	user, err := libs.FindUserByID(userID)
+	objID, err := primitive.ObjectIDFromHex(body.ChatID)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		libs.RespondError(c, libs.CodeInvalidRequest, "Invalid ChatId")
 		return
 	}
 
-	objID, err := primitive.ObjectIDFromHex(body.ChatId)
+	spanCtx, span = tracing.Start(ctx, "message.chat_fetch")
+	chat, err := a.Repos.Chats.FindOwned(spanCtx, objID, user.ID)
+	tracing.End(span, err)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ChatId"})
+		libs.RespondError(c, libs.CodeChatNotFound, "Chat not found")
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 40*time.Second)
-	defer cancel()
-
-	filter := bson.M{"_id": objID, "user_id": user.ID}
-	var chat model.Chat
-	if err := database.GetCollection("chatApp", "chat").FindOne(ctx, filter).Decode(&chat); err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Chat not found"})
+	// Refuse before storing the prompt so the chat doesn't collect unanswered messages
+	if cfg.AI.APIKey == "" {
+		libs.RespondError(c, libs.CodeLLMUnavailable, "The AI model is not configured")
 		return
 	}
 
 	// Save user message
 	userMessage := model.Message{Role: "user", Content: body.Prompt, CreatedAt: time.Now()}
-	_, _ = database.GetCollection("chatApp", "chat").UpdateOne(ctx, filter, bson.M{
-		"$push": bson.M{"messages": userMessage}, "$set": bson.M{"updated_at": time.Now()},
-	})
+	spanCtx, span = tracing.Start(ctx, "message.persist_prompt")
+	err = a.Repos.Chats.AppendMessage(spanCtx, objID, user.ID, userMessage)
+	tracing.End(span, err)
+	if err != nil {
+		logging.FromContext(ctx).Error("failed to save prompt", "chat_id", body.ChatID, "error", err)
+	}
 
 	// Agent decision & optional web search
-	decision := libs.DecideSearch(body.Prompt)
-	fmt.Println(decision)
+	spanCtx, span = tracing.Start(ctx, "message.route")
+	decision := "NO_SEARCH"
+	if cfg.Search.Enabled {
+		decision = a.LLM.DecideSearch(spanCtx, body.Prompt)
+	}
+	span.SetAttributes(attribute.String("search.decision", decision))
+	span.End()
+	logger := logging.FromContext(ctx)
+	logger.Debug("search routing decided", "chat_id", body.ChatID, "decision", decision)
 	var systemInstruction string
 	if decision == "SEARCH" {
-		webResult := libs.SearchInternet(body.Prompt)
+		spanCtx, span = tracing.Start(ctx, "message.search")
+		webResult := a.Search.SearchInternet(spanCtx, body.Prompt)
+		span.SetAttributes(attribute.Bool("search.has_results", webResult != ""))
+		span.End()
 		if webResult != "" {
 			systemInstruction = fmt.Sprintf(
 				"You are a helpful assistant. Use the following information from the internet to answer the user's question. Do not make up details and include relevant info only:\n%s",
@@ -186,10 +257,10 @@ func CreateMessage(c *gin.Context) {
 
 		}
 	}
-	fmt.Println(systemInstruction)
+	logger.Debug("system instruction built", "chat_id", body.ChatID, "system_instruction", systemInstruction)
 
 	// Build contents + config
-	contents, config := libs.BuildGenaiContents(chat.Messages, systemInstruction)
+	contents, genConfig := libs.BuildGenaiContents(chat.Messages, systemInstruction, cfg.AI.HistoryMessages)
 
 	// Ensure the *current* user prompt is included as the last content so model replies to it.
 	// Convert current prompt to genai contents and append
@@ -204,32 +275,38 @@ func CreateMessage(c *gin.Context) {
 	c.Writer.Header().Set("Connection", "keep-alive")
 	c.Writer.Flush()
 
-	apiKey := os.Getenv("GEMINI_API_KEY")
-	if apiKey == "" {
-		fmt.Fprintf(c.Writer, "data: %s\n\n", `{"error":"AI API key not set"}`)
-		return
-	}
-
-	client, err := genai.NewClient(ctx, &genai.ClientConfig{
-		APIKey:  apiKey,
-		Backend: genai.BackendGeminiAPI,
-	})
-	if err != nil {
-		fmt.Fprintf(c.Writer, "data: %s\n\n", `{"error":"Failed to init AI client"}`)
-		return
-	}
+	metrics.ActiveStreams.Inc()
+	defer metrics.ActiveStreams.Dec()
 
 	// Stream from model
-	stream := client.Models.GenerateContentStream(ctx, "gemini-2.5-flash-lite", contents, config)
+	modelName := a.LLM.Model()
+	streamStart := time.Now()
+	spanCtx, span = tracing.Start(ctx, "message.generate", trace.WithAttributes(attribute.String("gen_ai.request.model", modelName)))
+	stream := a.LLM.GenerateStream(spanCtx, contents, genConfig)
 
 	fullResponse := ""
-	for chunk, streamErr := range stream {
-		if streamErr != nil {
-			// send error event to client
-			fmt.Fprintf(c.Writer, "event: error\ndata: %q\n\n", streamErr.Error())
-			c.Writer.Flush()
+	outcome := "success"
+	firstChunk := true
+	var tokens int32
+	var streamErr error
+	for chunk, err := range stream {
+		if err != nil {
+			streamErr = err
+			outcome = "error"
+			logger.Error("generation stream failed", "chat_id", body.ChatID, "model", modelName, "error", err)
+			// send error event to client; the upstream error stays in the log
+			writeEvent(c.Writer, "error", libs.NewErrorResponse(c, libs.CodeLLMUnavailable, "The AI model failed to respond"))
 			break
 		}
+		if firstChunk {
+			span.AddEvent("first_token")
+			metrics.TimeToFirstToken.WithLabelValues(modelName).Observe(time.Since(streamStart).Seconds())
+			firstChunk = false
+		}
+		// usage metadata is cumulative, the last chunk carries the total
+		if chunk.UsageMetadata != nil {
+			tokens = chunk.UsageMetadata.CandidatesTokenCount
+		}
 		text := ""
 		if len(chunk.Candidates) > 0 {
 			for _, p := range chunk.Candidates[0].Content.Parts {
@@ -237,17 +314,35 @@ func CreateMessage(c *gin.Context) {
 			}
 		}
 		fullResponse += text
-		fmt.Fprintf(c.Writer, "data: %s\n\n", fmt.Sprintf(`{"delta":%q}`, text))
-		c.Writer.Flush()
+		writeEvent(c.Writer, "", DeltaEvent{Delta: text})
 	}
 
+	metrics.GenerationDuration.WithLabelValues(modelName, outcome).Observe(time.Since(streamStart).Seconds())
+	metrics.TokensGenerated.WithLabelValues(modelName).Add(float64(tokens))
+	span.SetAttributes(attribute.Int("gen_ai.usage.output_tokens", int(tokens)))
+	tracing.End(span, streamErr)
+
 	// Save AI response
 	aiMessage := model.Message{Role: "model", Content: fullResponse, CreatedAt: time.Now()}
-	_, _ = database.GetCollection("chatApp", "chat").UpdateOne(ctx, filter, bson.M{
-		"$push": bson.M{"messages": aiMessage}, "$set": bson.M{"updated_at": time.Now()},
-	})
+	spanCtx, span = tracing.Start(ctx, "message.persist_reply")
+	err = a.Repos.Chats.AppendMessage(spanCtx, objID, user.ID, aiMessage)
+	tracing.End(span, err)
+	if err != nil {
+		logger.Error("failed to save reply", "chat_id", body.ChatID, "error", err)
+	}
 
 	// done
 	fmt.Fprintf(c.Writer, "event: done\ndata: \"end\"\n\n")
 	c.Writer.Flush()
 }
+
+// writeEvent sends one server-sent event with data encoded as JSON; an empty
+// name sends an unnamed (default "message") event.
+func writeEvent(w gin.ResponseWriter, name string, data any) {
+	payload, _ := json.Marshal(data)
+	if name != "" {
+		fmt.Fprintf(w, "event: %s\n", name)
+	}
+	fmt.Fprintf(w, "data: %s\n\n", payload)
+	w.Flush()
+}
@@ -0,0 +1,274 @@
+package controlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/chatappbackend/export"
+	"github.com/sarwanazhar/chatappbackend/libs"
+	"github.com/sarwanazhar/chatappbackend/logging"
+	"github.com/sarwanazhar/chatappbackend/mail"
+	"github.com/sarwanazhar/chatappbackend/model"
+	"github.com/sarwanazhar/chatappbackend/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const exportPurpose = "export"
+
+// RequestExport starts building a ZIP of everything stored about the
+// signed-in user. The user is emailed a download link when it is ready,
+// and can poll GetExport meanwhile. While one export is being built,
+// asking again returns it rather than starting another.
+func (a *App) RequestExport(c *gin.Context) {
+	user, ok := a.currentUser(c)
+	if !ok {
+		return
+	}
+	ctx := c.Request.Context()
+	logger := logging.FromContext(ctx)
+
+	job, err := a.Repos.Exports.FindPending(ctx, user.ID, time.Now().Add(-a.Config.Export.Timeout))
+	if errors.Is(err, repository.ErrNotFound) {
+		job = &model.Export{UserID: user.ID, ExpiresAt: time.Now().Add(a.Config.Export.Timeout + a.Config.Export.LinkTTL)}
+		err = a.Repos.Exports.Create(ctx, job)
+		if err == nil {
+			logger.Info("export requested", "user_id", user.ID.Hex(), "export_id", job.ID.Hex())
+			go a.buildExport(context.WithoutCancel(ctx), job)
+		}
+	}
+	if err != nil {
+		logger.Error("failed to start export", "user_id", user.ID.Hex(), "error", err)
+		libs.RespondError(c, libs.CodeInternal, "Internal server error. Please try again later.")
+		return
+	}
+
+	c.Header("Location", "/v1/me/exports/"+job.ID.Hex())
+	c.JSON(http.StatusAccepted, a.newExportResponse(job))
+}
+
+// GetExport reports an export's progress, with a download URL once it is
+// ready. The URL takes the same Authorization header; only the emailed link
+// works without one.
+func (a *App) GetExport(c *gin.Context) {
+	exportID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		libs.RespondError(c, libs.CodeInvalidRequest, "Invalid export ID format")
+		return
+	}
+	user, ok := a.currentUser(c)
+	if !ok {
+		return
+	}
+
+	job, err := a.Repos.Exports.FindOwned(c.Request.Context(), exportID, user.ID)
+	if errors.Is(err, repository.ErrNotFound) {
+		libs.RespondError(c, libs.CodeExportNotFound, "Export not found")
+		return
+	}
+	if err != nil {
+		logging.FromContext(c.Request.Context()).Error("failed to load export", "export_id", exportID.Hex(), "error", err)
+		libs.RespondError(c, libs.CodeInternal, "Internal server error. Please try again later.")
+		return
+	}
+	c.JSON(http.StatusOK, a.newExportResponse(job))
+}
+
+// DownloadExport sends a ready export's ZIP. It takes ?token= from the
+// emailed link instead of an Authorization header, so the link works
+// straight from an email or a browser, once.
+func (a *App) DownloadExport(c *gin.Context) {
+	token, err := libs.ParseLinkToken(a.Config.Auth.JWTSecret, exportPurpose, c.Query("token"))
+	if errors.Is(err, libs.ErrLinkTokenExpired) {
+		libs.RespondError(c, libs.CodeLinkExpired, "This download link has expired, request a new export")
+		return
+	}
+	if err != nil {
+		libs.RespondError(c, libs.CodeLinkInvalid, "This download link is invalid")
+		return
+	}
+	exportID, err := primitive.ObjectIDFromHex(token.Subject)
+	if err != nil {
+		libs.RespondError(c, libs.CodeLinkInvalid, "This download link is invalid")
+		return
+	}
+
+	ctx := c.Request.Context()
+	logger := logging.FromContext(ctx)
+	userID, err := a.Repos.Tokens.Consume(ctx, token.NonceHash(), exportPurpose)
+	if errors.Is(err, repository.ErrNotFound) {
+		libs.RespondError(c, libs.CodeLinkInvalid, "This download link was already used, sign in to download the export again")
+		return
+	}
+	if err != nil {
+		logger.Error("failed to consume export token", "error", err)
+		libs.RespondError(c, libs.CodeInternal, "Internal server error. Please try again later.")
+		return
+	}
+
+	job, err := a.Repos.Exports.FindOwned(ctx, exportID, userID)
+	if errors.Is(err, repository.ErrNotFound) || (err == nil && job.Status != model.ExportReady) {
+		libs.RespondError(c, libs.CodeExportNotFound, "Export not found")
+		return
+	}
+	if err != nil {
+		logger.Error("failed to load export", "export_id", exportID.Hex(), "error", err)
+		libs.RespondError(c, libs.CodeInternal, "Internal server error. Please try again later.")
+		return
+	}
+	a.sendExportFile(c, job)
+}
+
+// DownloadOwnExport sends the signed-in user's ready export's ZIP.
+func (a *App) DownloadOwnExport(c *gin.Context) {
+	exportID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		libs.RespondError(c, libs.CodeInvalidRequest, "Invalid export ID format")
+		return
+	}
+	user, ok := a.currentUser(c)
+	if !ok {
+		return
+	}
+
+	job, err := a.Repos.Exports.FindOwned(c.Request.Context(), exportID, user.ID)
+	if errors.Is(err, repository.ErrNotFound) || (err == nil && job.Status != model.ExportReady) {
+		libs.RespondError(c, libs.CodeExportNotFound, "Export not found")
+		return
+	}
+	if err != nil {
+		logging.FromContext(c.Request.Context()).Error("failed to load export", "export_id", exportID.Hex(), "error", err)
+		libs.RespondError(c, libs.CodeInternal, "Internal server error. Please try again later.")
+		return
+	}
+	a.sendExportFile(c, job)
+}
+
+// sendExportFile streams job's ZIP as the response.
+func (a *App) sendExportFile(c *gin.Context, job *model.Export) {
+	ctx := c.Request.Context()
+	logger := logging.FromContext(ctx)
+
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", `attachment; filename="chatapp-export-`+job.CreatedAt.UTC().Format("2006-01-02")+`.zip"`)
+	c.Header("Content-Length", strconv.FormatInt(job.Size, 10))
+	c.Header("Cache-Control", "no-store")
+	c.Status(http.StatusOK)
+	if err := a.Repos.Exports.WriteFile(ctx, job, c.Writer); err != nil {
+		// Headers are gone; all that's left is to cut the download short
+		logger.Error("failed to send export", "export_id", job.ID.Hex(), "error", err)
+		c.Abort()
+		return
+	}
+	logger.Info("export downloaded", "user_id", job.UserID.Hex(), "export_id", job.ID.Hex())
+}
+
+// buildExport gathers the user's data into job's ZIP and emails them the
+// link, waiting for a free export slot first. The wait counts towards
+// Export.Timeout: RequestExport stops returning a job that old, so one
+// still queued by then is failed rather than built alongside its retry.
+func (a *App) buildExport(ctx context.Context, job *model.Export) {
+	ctx, cancel := context.WithTimeout(ctx, a.Config.Export.Timeout)
+	defer cancel()
+	logger := logging.FromContext(ctx).With("user_id", job.UserID.Hex(), "export_id", job.ID.Hex())
+
+	select {
+	case a.exportSlots <- struct{}{}:
+		defer func() { <-a.exportSlots }()
+	case <-ctx.Done():
+		logger.Warn("export workers busy, giving up", "waited", a.Config.Export.Timeout)
+		a.failExport(ctx, job)
+		return
+	}
+	start := time.Now()
+
+	user, err := a.writeExport(ctx, job)
+	if err != nil {
+		logger.Error("export failed", "error", err)
+		a.failExport(ctx, job)
+		return
+	}
+	logger.Info("export ready", "size", job.Size, "duration", time.Since(start))
+
+	link, err := a.issueExportLink(ctx, job)
+	if err == nil {
+		err = a.Mailer.Send(ctx, mail.ExportReady(user.Email, link, time.Until(job.ExpiresAt).Round(time.Hour)))
+	}
+	if err != nil {
+		// The user can still download it by polling the export
+		logger.Error("failed to send export email", "error", err)
+	}
+}
+
+// failExport marks job failed, even once ctx has run out.
+func (a *App) failExport(ctx context.Context, job *model.Export) {
+	if err := a.Repos.Exports.Fail(context.WithoutCancel(ctx), job.ID); err != nil {
+		logging.FromContext(ctx).Error("failed to mark export failed", "export_id", job.ID.Hex(), "error", err)
+	}
+}
+
+// writeExport builds and stores job's ZIP and returns the user it is for.
+func (a *App) writeExport(ctx context.Context, job *model.Export) (*model.User, error) {
+	user, err := a.Repos.Users.FindByID(ctx, job.UserID.Hex())
+	if err != nil {
+		return nil, err
+	}
+	bundle := &export.Bundle{ExportedAt: time.Now(), User: user}
+	if bundle.Chats, err = a.Repos.Chats.ListByUser(ctx, user.ID); err != nil {
+		return nil, err
+	}
+	// Oldest first, so the numbered files read in order
+	slices.Reverse(bundle.Chats)
+	if bundle.Usage, err = a.Repos.UsageOf(ctx, user.ID); err != nil {
+		return nil, err
+	}
+	if bundle.APIKeys, err = a.Repos.APIKeys.ListByUser(ctx, user.ID); err != nil {
+		return nil, err
+	}
+	if bundle.Sessions, err = a.Repos.Sessions.ListByUser(ctx, user.ID, time.Time{}); err != nil {
+		return nil, err
+	}
+
+	file := a.Repos.Exports.NewFile(ctx, job, time.Now().Add(a.Config.Export.LinkTTL))
+	if err := export.Write(file, bundle); err != nil {
+		return nil, err
+	}
+	if err := file.Complete(); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// issueExportLink returns the emailed download link of a ready export. It
+// works once, until the export expires, or until the password is reset or
+// the account's deletion is scheduled.
+func (a *App) issueExportLink(ctx context.Context, job *model.Export) (string, error) {
+	raw, token, err := libs.SignLinkToken(a.Config.Auth.JWTSecret, exportPurpose, job.ID.Hex(), time.Until(job.ExpiresAt))
+	if err != nil {
+		return "", err
+	}
+	if err := a.Repos.Tokens.Issue(ctx, token.NonceHash(), exportPurpose, job.UserID, token.ExpiresAt); err != nil {
+		return "", err
+	}
+	return withToken(a.Config.Server.PublicURL+"/v1/exports/download", raw)
+}
+
+func (a *App) newExportResponse(job *model.Export) ExportResponse {
+	resp := ExportResponse{ID: job.ID.Hex(), Status: job.Status, CreatedAt: job.CreatedAt}
+	switch {
+	case job.Status == model.ExportReady:
+		resp.CompletedAt = job.CompletedAt
+		resp.Size = job.Size
+		expiresAt := job.ExpiresAt
+		resp.ExpiresAt = &expiresAt
+		resp.DownloadURL = a.Config.Server.PublicURL + "/v1/me/exports/" + job.ID.Hex() + "/download"
+	case job.Status == model.ExportPending && time.Since(job.CreatedAt) > a.Config.Export.Timeout:
+		// The server building it went away; a new request starts over
+		resp.Status = model.ExportFailed
+	}
+	return resp
+}
@@ -0,0 +1,139 @@
+package controlers
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/chatappbackend/libs"
+	"github.com/sarwanazhar/chatappbackend/logging"
+	"github.com/sarwanazhar/chatappbackend/mail"
+	"github.com/sarwanazhar/chatappbackend/model"
+)
+
+// Failed logins are counted under the email that was typed, not the user
+// ID, so unknown addresses are throttled exactly like real ones.
+func accountAttemptKey(email string) string {
+	return "email:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipAttemptKey(ip string) string {
+	return "ip:" + ip
+}
+
+// countsFailures reports whether failed logins are recorded: lockout acts
+// on them, and so does proof of work even when lockout is off.
+func (a *App) countsFailures() bool {
+	return a.Config.Lockout.Enabled || a.Config.PoW.Enabled
+}
+
+// loginStatus returns how long a login as email from ip must wait (zero
+// means it may go ahead) and the larger of the two recent failure counts.
+// Bookkeeping errors let the login through rather than locking everyone
+// out while the database struggles.
+func (a *App) loginStatus(ctx context.Context, email, ip string) (time.Duration, int) {
+	if !a.countsFailures() {
+		return 0, 0
+	}
+	var wait time.Duration
+	var failures int
+	for _, key := range []string{accountAttemptKey(email), ipAttemptKey(ip)} {
+		attempt, err := a.Repos.LoginAttempts.Get(ctx, key)
+		if err != nil {
+			logging.FromContext(ctx).Error("failed to check login attempts", "error", err)
+			continue
+		}
+		wait = max(wait, time.Until(attempt.BlockedUntil))
+		if time.Since(attempt.LastFailureAt) < a.Config.Lockout.Window {
+			failures = max(failures, attempt.Failures)
+		}
+	}
+	return wait, failures
+}
+
+// loginFailed records a wrong password or code typed for email from ip.
+// user is the account behind email, nil if there is none; its owner is
+// emailed when this failure locks it.
+func (a *App) loginFailed(ctx context.Context, email, ip string, user *model.User) {
+	cfg := a.Config.Lockout
+	if !a.countsFailures() {
+		return
+	}
+	logger := logging.FromContext(ctx)
+	accountDelay, ipDelay := a.accountDelay, a.ipDelay
+	if !cfg.Enabled {
+		// Only counted, for proof of work
+		accountDelay, ipDelay = noDelay, noDelay
+	}
+
+	account, err := a.Repos.LoginAttempts.Fail(ctx, accountAttemptKey(email), cfg.Window, accountDelay)
+	if err != nil {
+		logger.Error("failed to record login failure", "error", err)
+	} else if cfg.Enabled && account.Failures == cfg.AccountThreshold {
+		logger.Warn("account locked", "email", email, "failures", account.Failures, "until", account.BlockedUntil)
+		if user != nil && cfg.Notify {
+			a.notifyLocked(ctx, user)
+		}
+	}
+
+	byIP, err := a.Repos.LoginAttempts.Fail(ctx, ipAttemptKey(ip), cfg.Window, ipDelay)
+	if err != nil {
+		logger.Error("failed to record login failure", "error", err)
+	} else if cfg.Enabled && byIP.Failures == cfg.IPThreshold {
+		logger.Warn("client ip locked", "ip", ip, "failures", byIP.Failures, "until", byIP.BlockedUntil)
+	}
+}
+
+// loginSucceeded forgets the failures for email. Failures from the IP are
+// kept: one good account mustn't reset the count for guessing others.
+func (a *App) loginSucceeded(ctx context.Context, email string) {
+	if !a.countsFailures() {
+		return
+	}
+	if err := a.Repos.LoginAttempts.Reset(ctx, accountAttemptKey(email)); err != nil {
+		logging.FromContext(ctx).Error("failed to reset login attempts", "error", err)
+	}
+}
+
+// accountDelay backs off exponentially after BackoffAfter failures and
+// locks the email at AccountThreshold.
+func (a *App) accountDelay(failures int) time.Duration {
+	cfg := a.Config.Lockout
+	if failures >= cfg.AccountThreshold {
+		return cfg.Duration
+	}
+	if failures <= cfg.BackoffAfter {
+		return 0
+	}
+	wait := float64(cfg.BackoffBase) * math.Pow(2, float64(failures-cfg.BackoffAfter-1))
+	if wait >= float64(cfg.Duration) {
+		return cfg.Duration
+	}
+	return time.Duration(wait)
+}
+
+// ipDelay only locks: a shared address (an office, a carrier NAT) has many
+// honest typos, so it isn't slowed down before the threshold.
+func (a *App) ipDelay(failures int) time.Duration {
+	if failures >= a.Config.Lockout.IPThreshold {
+		return a.Config.Lockout.Duration
+	}
+	return 0
+}
+
+func noDelay(int) time.Duration { return 0 }
+
+func (a *App) notifyLocked(ctx context.Context, user *model.User) {
+	a.sendNotice(ctx, user, mail.AccountLocked(user.Email, a.Config.Lockout.Duration))
+}
+
+// respondLoginWait refuses a throttled login, telling the client when to
+// retry.
+func respondLoginWait(c *gin.Context, wait time.Duration) {
+	seconds := int(math.Ceil(wait.Seconds()))
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	libs.RespondError(c, libs.CodeTooManyAttempts, "Too many failed sign-ins, try again in "+strconv.Itoa(seconds)+" seconds")
+}
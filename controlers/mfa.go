@@ -0,0 +1,327 @@
+package controlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/chatappbackend/libs"
+	"github.com/sarwanazhar/chatappbackend/logging"
+	"github.com/sarwanazhar/chatappbackend/model"
+	"github.com/sarwanazhar/chatappbackend/repository"
+)
+
+const (
+	mfaChallengePurpose = "mfa_challenge"
+	// mfaChallengeTTL is how long the user has to type a code after
+	// getting the password right.
+	mfaChallengeTTL = 5 * time.Minute
+	// totpIssuer labels the account in authenticator apps.
+	totpIssuer        = "ChatApp"
+	recoveryCodeCount = 10
+)
+
+// VerifyMFA is the second login step. It needs json
+// {"mfaToken": "", "code": ""} where code is a TOTP or recovery code.
+func (a *App) VerifyMFA(c *gin.Context) {
+	var body MFALoginRequest
+	if err := c.ShouldBindJSON(&body); err != nil {
+		libs.RespondError(c, libs.CodeInvalidRequest, "MFA token and code are required")
+		return
+	}
+
+	ctx := c.Request.Context()
+	logger := logging.FromContext(ctx)
+
+	challenge, err := libs.ParseLinkToken(a.Config.Auth.JWTSecret, mfaChallengePurpose, body.MFAToken)
+	if err != nil {
+		libs.RespondError(c, libs.CodeMFAChallenge, "This sign-in attempt has expired, sign in again")
+		return
+	}
+	user, err := a.Repos.Users.FindByID(ctx, challenge.Subject)
+	if err != nil || !user.MFAEnabled() {
+		libs.RespondError(c, libs.CodeMFAChallenge, "This sign-in attempt has expired, sign in again")
+		return
+	}
+
+	// Codes are guessable too, so they count against the same limits as
+	// passwords
+	if wait, _ := a.loginStatus(ctx, a.emailKey(user.Email), c.ClientIP()); wait > 0 {
+		logger.Info("login rejected", "user_id", user.ID.Hex(), "reason", "throttled")
+		respondLoginWait(c, wait)
+		return
+	}
+
+	ok, err := a.checkSecondFactor(ctx, user, body.Code, true)
+	if err != nil {
+		logger.Error("failed to check mfa code", "user_id", user.ID.Hex(), "error", err)
+		libs.RespondError(c, libs.CodeInternal, "Internal server error. Please try again later.")
+		return
+	}
+	if !ok {
+		a.loginFailed(ctx, a.emailKey(user.Email), c.ClientIP(), user)
+		logger.Info("login rejected", "user_id", user.ID.Hex(), "reason", "wrong_mfa_code")
+		libs.RespondError(c, libs.CodeMFACodeInvalid, "Invalid authentication code")
+		return
+	}
+
+	// Consumed only after a good code so a typo doesn't end the attempt
+	if _, err := a.Repos.Tokens.Consume(ctx, challenge.NonceHash(), mfaChallengePurpose); err != nil {
+		if !errors.Is(err, repository.ErrNotFound) {
+			logger.Error("failed to consume mfa challenge", "error", err)
+		}
+		libs.RespondError(c, libs.CodeMFAChallenge, "This sign-in attempt has expired, sign in again")
+		return
+	}
+	if user.Disabled {
+		libs.RespondError(c, libs.CodeAccountDisabled, "This account has been disabled")
+		return
+	}
+	a.loginSucceeded(ctx, a.emailKey(user.Email))
+
+	token, err := a.startSession(c, user)
+	if err != nil {
+		logger.Error("failed to start session", "user_id", user.ID.Hex(), "error", err)
+		libs.RespondError(c, libs.CodeInternal, "Could not generate token")
+		return
+	}
+	c.JSON(http.StatusOK, newLoginResponse(token, user))
+}
+
+// EnrollTOTP starts 2FA setup and returns the secret to add to an
+// authenticator app. Nothing changes for logins until ConfirmTOTP.
+func (a *App) EnrollTOTP(c *gin.Context) {
+	user, ok := a.currentUser(c)
+	if !ok {
+		return
+	}
+	if user.MFAEnabled() {
+		libs.RespondError(c, libs.CodeMFAAlreadyEnabled, "Two-factor authentication is already on")
+		return
+	}
+
+	logger := logging.FromContext(c.Request.Context())
+	secret, err := libs.NewTOTPSecret()
+	if err != nil {
+		logger.Error("failed to generate totp secret", "error", err)
+		libs.RespondError(c, libs.CodeInternal, "Internal server error. Please try again later.")
+		return
+	}
+	sealed, err := libs.SealTOTPSecret(a.Config.Auth.JWTSecret, secret)
+	if err != nil {
+		logger.Error("failed to seal totp secret", "error", err)
+		libs.RespondError(c, libs.CodeInternal, "Internal server error. Please try again later.")
+		return
+	}
+	err = a.Repos.Users.StartMFAEnrollment(c.Request.Context(), user.ID, sealed)
+	if errors.Is(err, repository.ErrNotFound) {
+		libs.RespondError(c, libs.CodeMFAAlreadyEnabled, "Two-factor authentication is already on")
+		return
+	}
+	if err != nil {
+		logger.Error("failed to store totp secret", "user_id", user.ID.Hex(), "error", err)
+		libs.RespondError(c, libs.CodeInternal, "Internal server error. Please try again later.")
+		return
+	}
+
+	c.JSON(http.StatusOK, TOTPEnrollmentResponse{
+		Secret: secret,
+		URI:    libs.TOTPURI(totpIssuer, user.Email, secret),
+	})
+}
+
+// ConfirmTOTP turns 2FA on once the user proves their app produces codes,
+// and returns the recovery codes. They are shown only this once.
+// It needs json {"code": ""}.
+func (a *App) ConfirmTOTP(c *gin.Context) {
+	var body MFACodeRequest
+	if err := c.ShouldBindJSON(&body); err != nil {
+		libs.RespondError(c, libs.CodeInvalidRequest, "Code is required")
+		return
+	}
+	user, ok := a.currentUser(c)
+	if !ok {
+		return
+	}
+	if user.MFAEnabled() {
+		libs.RespondError(c, libs.CodeMFAAlreadyEnabled, "Two-factor authentication is already on")
+		return
+	}
+	if user.MFA == nil {
+		libs.RespondError(c, libs.CodeMFANotEnabled, "Start enrollment first")
+		return
+	}
+
+	ctx := c.Request.Context()
+	logger := logging.FromContext(ctx)
+	// Guessed codes count against the login limits, as in VerifyMFA
+	if wait, _ := a.loginStatus(ctx, a.emailKey(user.Email), c.ClientIP()); wait > 0 {
+		respondLoginWait(c, wait)
+		return
+	}
+	secret, err := libs.OpenTOTPSecret(a.Config.Auth.JWTSecret, user.MFA.Secret)
+	if err != nil {
+		logger.Error("failed to open totp secret", "user_id", user.ID.Hex(), "error", err)
+		libs.RespondError(c, libs.CodeMFANotEnabled, "Start enrollment again")
+		return
+	}
+	step, ok := libs.ValidateTOTP(secret, body.Code, time.Now())
+	if !ok {
+		a.loginFailed(ctx, a.emailKey(user.Email), c.ClientIP(), user)
+		libs.RespondError(c, libs.CodeMFACodeInvalid, "Invalid authentication code")
+		return
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		logger.Error("failed to generate recovery codes", "error", err)
+		libs.RespondError(c, libs.CodeInternal, "Internal server error. Please try again later.")
+		return
+	}
+	err = a.Repos.Users.EnableMFA(ctx, user.ID, hashes, step)
+	if errors.Is(err, repository.ErrNotFound) {
+		libs.RespondError(c, libs.CodeMFAAlreadyEnabled, "Two-factor authentication is already on")
+		return
+	}
+	if err != nil {
+		logger.Error("failed to enable mfa", "user_id", user.ID.Hex(), "error", err)
+		libs.RespondError(c, libs.CodeInternal, "Internal server error. Please try again later.")
+		return
+	}
+	logger.Info("mfa enabled", "user_id", user.ID.Hex())
+
+	c.JSON(http.StatusOK, RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// RegenerateRecoveryCodes replaces every recovery code. It needs a current
+// TOTP code as json {"code": ""}.
+func (a *App) RegenerateRecoveryCodes(c *gin.Context) {
+	user, ok := a.mfaRequest(c, false)
+	if !ok {
+		return
+	}
+
+	logger := logging.FromContext(c.Request.Context())
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		logger.Error("failed to generate recovery codes", "error", err)
+		libs.RespondError(c, libs.CodeInternal, "Internal server error. Please try again later.")
+		return
+	}
+	if err := a.Repos.Users.SetRecoveryCodes(c.Request.Context(), user.ID, hashes); err != nil {
+		logger.Error("failed to store recovery codes", "user_id", user.ID.Hex(), "error", err)
+		libs.RespondError(c, libs.CodeInternal, "Internal server error. Please try again later.")
+		return
+	}
+	c.JSON(http.StatusOK, RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// DisableMFA turns 2FA off. It needs json {"code": ""} with a TOTP or
+// recovery code, so a stolen session alone can't remove the second factor.
+func (a *App) DisableMFA(c *gin.Context) {
+	user, ok := a.mfaRequest(c, true)
+	if !ok {
+		return
+	}
+
+	logger := logging.FromContext(c.Request.Context())
+	if err := a.Repos.Users.DisableMFA(c.Request.Context(), user.ID); err != nil {
+		logger.Error("failed to disable mfa", "user_id", user.ID.Hex(), "error", err)
+		libs.RespondError(c, libs.CodeInternal, "Internal server error. Please try again later.")
+		return
+	}
+	logger.Info("mfa disabled", "user_id", user.ID.Hex())
+	c.JSON(http.StatusOK, InfoResponse{Message: "Two-factor authentication is off"})
+}
+
+// mfaRequest binds an MFACodeRequest for the signed-in user, who must have
+// 2FA on, and checks the code with the same throttling as VerifyMFA. It
+// has already responded when ok is false.
+func (a *App) mfaRequest(c *gin.Context, allowRecovery bool) (*model.User, bool) {
+	var body MFACodeRequest
+	if err := c.ShouldBindJSON(&body); err != nil {
+		libs.RespondError(c, libs.CodeInvalidRequest, "Code is required")
+		return nil, false
+	}
+	user, ok := a.currentUser(c)
+	if !ok {
+		return nil, false
+	}
+	if !user.MFAEnabled() {
+		libs.RespondError(c, libs.CodeMFANotEnabled, "Two-factor authentication is off")
+		return nil, false
+	}
+	ctx := c.Request.Context()
+	if wait, _ := a.loginStatus(ctx, a.emailKey(user.Email), c.ClientIP()); wait > 0 {
+		respondLoginWait(c, wait)
+		return nil, false
+	}
+	valid, err := a.checkSecondFactor(ctx, user, body.Code, allowRecovery)
+	if err != nil {
+		logging.FromContext(ctx).Error("failed to check mfa code", "user_id", user.ID.Hex(), "error", err)
+		libs.RespondError(c, libs.CodeInternal, "Internal server error. Please try again later.")
+		return nil, false
+	}
+	if !valid {
+		a.loginFailed(ctx, a.emailKey(user.Email), c.ClientIP(), user)
+		libs.RespondError(c, libs.CodeMFACodeInvalid, "Invalid authentication code")
+		return nil, false
+	}
+	return user, true
+}
+
+// checkSecondFactor accepts a TOTP code not used before or, when
+// allowRecovery is set, an unused recovery code, which is then spent.
+func (a *App) checkSecondFactor(ctx context.Context, user *model.User, code string, allowRecovery bool) (bool, error) {
+	secret, err := libs.OpenTOTPSecret(a.Config.Auth.JWTSecret, user.MFA.Secret)
+	if err != nil {
+		return false, err
+	}
+	if step, ok := libs.ValidateTOTP(secret, code, time.Now()); ok {
+		err := a.Repos.Users.UseTOTPStep(ctx, user.ID, step)
+		if errors.Is(err, repository.ErrNotFound) {
+			return false, nil // replayed
+		}
+		return err == nil, err
+	}
+	if !allowRecovery {
+		return false, nil
+	}
+
+	err = a.Repos.Users.UseRecoveryCode(ctx, user.ID, libs.HashRecoveryCode(code))
+	if errors.Is(err, repository.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	logging.FromContext(ctx).Info("recovery code used", "user_id", user.ID.Hex(), "remaining", len(user.MFA.RecoveryCodes)-1)
+	return true, nil
+}
+
+// issueMFAChallenge returns the token that stands in for a password that
+// was already checked, valid for one VerifyMFA.
+func (a *App) issueMFAChallenge(ctx context.Context, user *model.User) (string, error) {
+	raw, token, err := libs.SignLinkToken(a.Config.Auth.JWTSecret, mfaChallengePurpose, user.ID.Hex(), mfaChallengeTTL)
+	if err != nil {
+		return "", err
+	}
+	if err := a.Repos.Tokens.Issue(ctx, token.NonceHash(), mfaChallengePurpose, user.ID, token.ExpiresAt); err != nil {
+		return "", err
+	}
+	return raw, nil
+}
+
+func newRecoveryCodes() (codes, hashes []string, err error) {
+	codes, err = libs.NewRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, nil, err
+	}
+	hashes = make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = libs.HashRecoveryCode(code)
+	}
+	return codes, hashes, nil
+}
@@ -0,0 +1,195 @@
+package controlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/chatappbackend/libs"
+	"github.com/sarwanazhar/chatappbackend/logging"
+	"github.com/sarwanazhar/chatappbackend/mail"
+	"github.com/sarwanazhar/chatappbackend/model"
+	"github.com/sarwanazhar/chatappbackend/repository"
+)
+
+const resetPasswordPurpose = "reset_password"
+
+// ForgotPassword emails a password reset link. It needs json {"email": ""}
+// and always answers 202 so it can't be used to find out who has an account.
+func (a *App) ForgotPassword(c *gin.Context) {
+	var body ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&body); err != nil {
+		libs.RespondError(c, libs.CodeInvalidRequest, "Email is required")
+		return
+	}
+	email, problem := a.normalizeEmail("email", body.Email)
+	if problem != nil {
+		libs.RespondInvalid(c, problem.Message, *problem)
+		return
+	}
+
+	// Same as ResendVerification: the lookup and send happen in the
+	// background so the response time is the same for every address.
+	a.mailInBackground(c.Request.Context(), "forgot password", func(ctx context.Context) {
+		logger := logging.FromContext(ctx)
+		user, err := a.Repos.Users.FindByEmail(ctx, a.emailKey(email))
+		if err != nil {
+			if !errors.Is(err, repository.ErrNotFound) {
+				logger.Error("forgot password lookup failed", "error", err)
+			}
+			return
+		}
+		if user.Disabled {
+			return
+		}
+		last, err := a.Repos.Tokens.LatestIssuedAt(ctx, user.ID, resetPasswordPurpose)
+		if err != nil {
+			logger.Error("forgot password cooldown check failed", "user_id", user.ID.Hex(), "error", err)
+			return
+		}
+		if time.Since(last) < resendCooldown {
+			return
+		}
+		if err := a.sendPasswordReset(ctx, user); err != nil {
+			logger.Error("failed to send password reset email", "user_id", user.ID.Hex(), "error", err)
+		}
+	})
+
+	c.JSON(http.StatusAccepted, InfoResponse{Message: "If that address has an account, a reset link is on its way"})
+}
+
+// ResetPassword sets a new password using the token from a reset email and
+// signs the user out of every existing session.
+// It needs json {"token": "", "password": ""}.
+func (a *App) ResetPassword(c *gin.Context) {
+	var body ResetPasswordRequest
+	if err := c.ShouldBindJSON(&body); err != nil {
+		libs.RespondError(c, libs.CodeInvalidRequest, "Reset token is required")
+		return
+	}
+
+	logger := logging.FromContext(c.Request.Context())
+
+	token, err := libs.ParseLinkToken(a.Config.Auth.JWTSecret, resetPasswordPurpose, body.Token)
+	if errors.Is(err, libs.ErrLinkTokenExpired) {
+		libs.RespondError(c, libs.CodeLinkExpired, "This reset link has expired, request a new one")
+		return
+	}
+	if err != nil {
+		libs.RespondError(c, libs.CodeLinkInvalid, "This reset link is invalid")
+		return
+	}
+
+	// Check the password before consuming the link, so a refused one can
+	// be fixed and posted again
+	user, err := a.Repos.Users.FindByID(c.Request.Context(), token.Subject)
+	if errors.Is(err, repository.ErrNotFound) {
+		libs.RespondError(c, libs.CodeLinkInvalid, "This reset link is invalid")
+		return
+	}
+	if err != nil {
+		logger.Error("failed to load user for password reset", "error", err)
+		libs.RespondError(c, libs.CodeInternal, "Internal server error. Please try again later.")
+		return
+	}
+	if problem := a.checkNewPassword(c.Request.Context(), "password", body.Password, user.Email); problem != nil {
+		libs.RespondInvalid(c, problem.Message, *problem)
+		return
+	}
+
+	hashedPassword, err := a.Passwords.Hash(body.Password)
+	if err != nil {
+		logger.Error("failed to hash password", "error", err)
+		libs.RespondError(c, libs.CodeInternal, "Internal server error. Please try again later.")
+		return
+	}
+
+	// Consume only once the new hash is ready so a hashing failure doesn't
+	// burn the link
+	userID, err := a.Repos.Tokens.Consume(c.Request.Context(), token.NonceHash(), resetPasswordPurpose)
+	if errors.Is(err, repository.ErrNotFound) || (err == nil && userID.Hex() != token.Subject) {
+		libs.RespondError(c, libs.CodeLinkInvalid, "This reset link was already used or replaced by a newer one")
+		return
+	}
+	if err != nil {
+		logger.Error("failed to consume reset token", "error", err)
+		libs.RespondError(c, libs.CodeInternal, "Internal server error. Please try again later.")
+		return
+	}
+
+	if err := a.Repos.Users.SetPassword(c.Request.Context(), userID, hashedPassword); err != nil {
+		logger.Error("failed to reset password", "user_id", userID.Hex(), "error", err)
+		libs.RespondError(c, libs.CodeInternal, "Internal server error. Please try again later.")
+		return
+	}
+	logger.Info("password reset", "user_id", userID.Hex())
+	// Whoever had the old password may have had the inbox too
+	if err := a.Repos.Tokens.RevokeAll(c.Request.Context(), userID, exportPurpose); err != nil {
+		logger.Error("failed to revoke export links", "user_id", userID.Hex(), "error", err)
+	}
+
+	// The new password ends any lockout: the owner proved themselves by email
+	a.loginSucceeded(c.Request.Context(), a.emailKey(user.Email))
+
+	// Opening the link proved the user owns the inbox
+	if err := a.Repos.Users.MarkEmailVerified(c.Request.Context(), userID); err != nil {
+		logger.Error("failed to mark email verified", "user_id", userID.Hex(), "error", err)
+	}
+
+	c.JSON(http.StatusOK, InfoResponse{Message: "Password updated, sign in with your new password"})
+}
+
+// sendPasswordReset emails user a fresh reset link. Links sent earlier stop
+// working.
+func (a *App) sendPasswordReset(ctx context.Context, user *model.User) error {
+	cfg := a.Config.Auth
+	raw, token, err := libs.SignLinkToken(cfg.JWTSecret, resetPasswordPurpose, user.ID.Hex(), cfg.ResetTokenTTL)
+	if err != nil {
+		return err
+	}
+	if err := a.Repos.Tokens.RevokeAll(ctx, user.ID, resetPasswordPurpose); err != nil {
+		return err
+	}
+	if err := a.Repos.Tokens.Issue(ctx, token.NonceHash(), resetPasswordPurpose, user.ID, token.ExpiresAt); err != nil {
+		return err
+	}
+
+	link, err := withToken(cfg.ResetPasswordURL, raw)
+	if err != nil {
+		return err
+	}
+	if err := a.Mailer.Send(ctx, mail.PasswordReset(user.Email, link, cfg.ResetTokenTTL)); err != nil {
+		return fmt.Errorf("sending mail: %w", err)
+	}
+	return nil
+}
+
+// checkPassword reports whether password is user's. A match against a hash
+// made under a weaker policy than the current one is hashed again while the
+// password is at hand; failing to store the new hash only delays the
+// upgrade to the next login, so it doesn't fail the check.
+func (a *App) checkPassword(ctx context.Context, user *model.User, password string) bool {
+	ok, rehash := a.Passwords.Check(password, user.Password)
+	if !ok || !rehash {
+		return ok
+	}
+
+	logger := logging.FromContext(ctx)
+	hash, err := a.Passwords.Hash(password)
+	if err == nil {
+		err = a.Repos.Users.RehashPassword(ctx, user.ID, user.Password, hash)
+	}
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		// The password changed meanwhile, and got a current hash then
+	case err != nil:
+		logger.Warn("failed to upgrade password hash", "user_id", user.ID.Hex(), "error", err)
+	default:
+		user.Password = hash
+		logger.Info("password hash upgraded", "user_id", user.ID.Hex())
+	}
+	return true
+}
@@ -0,0 +1,76 @@
+package controlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/chatappbackend/libs"
+	"github.com/sarwanazhar/chatappbackend/logging"
+	"github.com/sarwanazhar/chatappbackend/repository"
+)
+
+// GetChallenge issues a proof-of-work challenge at the current difficulty.
+// Challenges are free to get; solving one is what costs.
+func (a *App) GetChallenge(c *gin.Context) {
+	cfg := a.Config.PoW
+	difficulty := a.powDifficulty()
+	raw, token, err := libs.NewPoWChallenge(a.Config.Auth.JWTSecret, difficulty, cfg.TTL)
+	if err != nil {
+		logging.FromContext(c.Request.Context()).Error("failed to issue challenge", "error", err)
+		libs.RespondError(c, libs.CodeInternal, "Internal server error. Please try again later.")
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, ChallengeResponse{
+		Challenge:  raw,
+		Algorithm:  "sha256",
+		Difficulty: difficulty,
+		ExpiresAt:  token.ExpiresAt,
+		Enabled:    cfg.Enabled,
+	})
+}
+
+// powDifficulty is the configured difficulty plus one bit for every
+// doubling of register and login traffic beyond the load threshold.
+func (a *App) powDifficulty() int {
+	cfg := a.Config.PoW
+	rate := a.authLoad.Rate()
+	difficulty := cfg.Difficulty
+	for limit := float64(cfg.LoadThreshold); rate > limit && difficulty < cfg.MaxDifficulty; limit *= 2 {
+		difficulty++
+	}
+	return difficulty
+}
+
+// checkProofOfWork accepts a solved, unused challenge. It has already
+// responded when it returns false.
+func (a *App) checkProofOfWork(c *gin.Context, pow *ProofOfWork) bool {
+	if pow == nil {
+		libs.RespondError(c, libs.CodePoWRequired, "Solve a challenge from /v1/auth/challenge and send it as proofOfWork")
+		return false
+	}
+	token, err := libs.VerifyPoW(a.Config.Auth.JWTSecret, pow.Challenge, pow.Solution)
+	if err != nil {
+		libs.RespondError(c, libs.CodePoWInvalid, "The proof-of-work solution is wrong or its challenge expired")
+		return false
+	}
+
+	err = a.Repos.Tokens.Redeem(c.Request.Context(), token.NonceHash(), libs.PoWPurpose, token.ExpiresAt)
+	if errors.Is(err, repository.ErrDuplicate) {
+		libs.RespondError(c, libs.CodePoWInvalid, "This challenge was already used, get a new one")
+		return false
+	}
+	if err != nil {
+		logging.FromContext(c.Request.Context()).Error("failed to redeem challenge", "error", err)
+		libs.RespondError(c, libs.CodeInternal, "Internal server error. Please try again later.")
+		return false
+	}
+	return true
+}
+
+// loginNeedsProofOfWork reports whether failures for the email or IP make
+// this login suspicious enough to need a solved challenge.
+func (a *App) loginNeedsProofOfWork(failures int) bool {
+	return a.Config.PoW.Enabled && failures >= a.Config.PoW.LoginAfter
+}
@@ -0,0 +1,90 @@
+package controlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/chatappbackend/libs"
+	"github.com/sarwanazhar/chatappbackend/logging"
+	"github.com/sarwanazhar/chatappbackend/model"
+	"github.com/sarwanazhar/chatappbackend/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// maxUserAgent bounds what a client can make us store per session.
+const maxUserAgent = 512
+
+// startSession records a sign-in by user from this request and returns the
+// token bound to it. Every login path ends here.
+func (a *App) startSession(c *gin.Context, user *model.User) (string, error) {
+	userAgent := c.Request.UserAgent()
+	if len(userAgent) > maxUserAgent {
+		userAgent = userAgent[:maxUserAgent]
+	}
+	session := &model.Session{
+		UserID:    user.ID,
+		UserAgent: userAgent,
+		IP:        c.ClientIP(),
+		ExpiresAt: time.Now().Add(a.Config.Auth.TokenTTL),
+	}
+	if err := a.Repos.Sessions.Create(c.Request.Context(), session); err != nil {
+		return "", err
+	}
+	return libs.GenerateJWT(a.Keys, a.Config.Auth, user.ID.Hex(), session.ID.Hex())
+}
+
+// ListSessions returns where the signed-in user is logged in, marking the
+// session making this request.
+func (a *App) ListSessions(c *gin.Context) {
+	user, ok := a.currentUser(c)
+	if !ok {
+		return
+	}
+	// Sessions from before the last wholesale revocation no longer work
+	var since time.Time
+	if user.TokensRevokedAt != nil {
+		since = user.TokensRevokedAt.Truncate(time.Second)
+	}
+	sessions, err := a.Repos.Sessions.ListByUser(c.Request.Context(), user.ID, since)
+	if err != nil {
+		logging.FromContext(c.Request.Context()).Error("failed to list sessions", "user_id", user.ID.Hex(), "error", err)
+		libs.RespondError(c, libs.CodeInternal, "Internal server error. Please try again later.")
+		return
+	}
+
+	current := c.GetString("sessionId")
+	resp := SessionListResponse{Sessions: make([]SessionResponse, len(sessions))}
+	for i := range sessions {
+		resp.Sessions[i] = newSessionResponse(&sessions[i], current)
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// DeleteSession signs a session out; its token stops working on its next
+// request. Deleting the current session is how a client logs out.
+func (a *App) DeleteSession(c *gin.Context) {
+	sessionID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		libs.RespondError(c, libs.CodeInvalidRequest, "Invalid session ID format")
+		return
+	}
+	user, ok := a.currentUser(c)
+	if !ok {
+		return
+	}
+
+	err = a.Repos.Sessions.DeleteOwned(c.Request.Context(), sessionID, user.ID)
+	if errors.Is(err, repository.ErrNotFound) {
+		libs.RespondError(c, libs.CodeSessionNotFound, "Session not found")
+		return
+	}
+	if err != nil {
+		logging.FromContext(c.Request.Context()).Error("failed to delete session", "session_id", sessionID.Hex(), "error", err)
+		libs.RespondError(c, libs.CodeInternal, "Internal server error. Please try again later.")
+		return
+	}
+	logging.FromContext(c.Request.Context()).Info("session revoked", "user_id", user.ID.Hex(), "session_id", sessionID.Hex())
+	c.JSON(http.StatusOK, InfoResponse{Message: "Session revoked"})
+}
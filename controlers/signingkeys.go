@@ -0,0 +1,116 @@
+package controlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/chatappbackend/libs"
+	"github.com/sarwanazhar/chatappbackend/model"
+	"github.com/sarwanazhar/chatappbackend/repository"
+)
+
+const (
+	// keyPrepublish is how long a new key is in the JWKS before it signs,
+	// so every server instance and every verifier's cached copy of the JWKS
+	// knows it by then.
+	keyPrepublish = time.Hour
+	// keyLead is how long before a key's rotation its successor is made,
+	// leaving room for late refreshes while still prepublishing it.
+	keyLead = 3 * keyPrepublish
+	// keyRefreshInterval is how often each instance reloads the keys and
+	// checks whether the next one is due.
+	keyRefreshInterval = 5 * time.Minute
+	// jwksMaxAge is how long verifiers may cache the JWKS, well inside
+	// keyPrepublish.
+	jwksMaxAge = 15 * time.Minute
+)
+
+// GetJWKS publishes the public keys that verify access tokens.
+func (a *App) GetJWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age="+strconv.Itoa(int(jwksMaxAge.Seconds())))
+	c.JSON(http.StatusOK, a.Keys.JWKS())
+}
+
+// LoadSigningKeys creates the next signing key when one is due and loads
+// the current keys into a.Keys. The server calls it before serving.
+func (a *App) LoadSigningKeys(ctx context.Context) error {
+	now := time.Now()
+	keys, err := a.Repos.SigningKeys.ListCurrent(ctx, now)
+	if err != nil {
+		return err
+	}
+
+	if signFrom, due := a.nextKeyDue(keys, now); due {
+		cfg := a.Config.Auth
+		// A key signs for about one rotation and its tokens live TokenTTL
+		// after that; the extra rotation covers a late successor
+		expiresAt := signFrom.Add(2*cfg.KeyRotation + cfg.TokenTTL)
+		key, err := libs.NewSigningKey(cfg.JWTSecret, cfg.SigningAlgorithm, signFrom, expiresAt)
+		if err != nil {
+			return err
+		}
+		err = a.Repos.SigningKeys.Create(ctx, key)
+		if err == nil {
+			a.Logger.Info("signing key created", "kid", key.ID, "algorithm", key.Algorithm, "sign_from", signFrom)
+		} else if !errors.Is(err, repository.ErrDuplicate) {
+			return err
+		}
+		// Either way there is a new key, ours or another instance's
+		if keys, err = a.Repos.SigningKeys.ListCurrent(ctx, now); err != nil {
+			return err
+		}
+	}
+	return a.Keys.Load(a.Config.Auth.JWTSecret, keys)
+}
+
+// nextKeyDue reports whether a key should be created now and when it
+// should start signing. keys are ordered latest first. Times are derived
+// from the hour, not the instant, so instances rotating together pick the
+// same one and the unique index keeps a single key.
+func (a *App) nextKeyDue(keys []model.SigningKey, now time.Time) (time.Time, bool) {
+	hour := now.Truncate(keyPrepublish)
+	if len(keys) == 0 {
+		// Nothing to verify against yet, so the first key signs at once
+		return hour, true
+	}
+	latest := keys[0]
+	if latest.SignFrom.After(now) {
+		// The next key is already published and waiting
+		return time.Time{}, false
+	}
+	successor := latest.SignFrom.Add(a.Config.Auth.KeyRotation)
+	earliest := hour.Add(2 * keyPrepublish)
+	switch {
+	case latest.Algorithm != a.Config.Auth.SigningAlgorithm:
+		// The configured algorithm changed; switch as soon as allowed
+		return earliest, true
+	case now.Before(successor.Add(-keyLead)):
+		return time.Time{}, false
+	case successor.Before(earliest):
+		// Rotation is late, e.g. every instance was down
+		return earliest, true
+	default:
+		return successor, true
+	}
+}
+
+// RotateSigningKeys reloads the signing keys every keyRefreshInterval,
+// creating the next one when it is due, until ctx is done.
+func (a *App) RotateSigningKeys(ctx context.Context) {
+	ticker := time.NewTicker(keyRefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := a.LoadSigningKeys(ctx); err != nil {
+			a.Logger.Error("failed to refresh signing keys", "error", err)
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package controlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/chatappbackend/libs"
+	"github.com/sarwanazhar/chatappbackend/logging"
+	"github.com/sarwanazhar/chatappbackend/model"
+	"github.com/sarwanazhar/chatappbackend/repository"
+	"github.com/sarwanazhar/chatappbackend/sso"
+)
+
+const (
+	ssoPurpose = "sso_login"
+	// ssoCookie carries the signed login state between StartSSO and the
+	// callback, binding the callback to the browser that started it.
+	ssoCookie     = "sso_login"
+	ssoCookiePath = "/v1/auth/sso/"
+	// ssoLoginTTL is how long the user has to finish at the provider.
+	ssoLoginTTL = 10 * time.Minute
+)
+
+// ListProviders names the identity providers the frontend can offer.
+func (a *App) ListProviders(c *gin.Context) {
+	c.JSON(http.StatusOK, ProvidersResponse{Providers: a.SSO.Names()})
+}
+
+// StartSSO sends the browser to the provider's login page.
+func (a *App) StartSSO(c *gin.Context) {
+	name := c.Param("provider")
+	provider, ok := a.SSO[name]
+	if !ok {
+		libs.RespondError(c, libs.CodeProviderNotFound, "Unknown identity provider")
+		return
+	}
+
+	// The state is a signed link token whose nonce doubles as the OAuth
+	// state and the OIDC nonce; the PKCE verifier rides in its subject
+	verifier := sso.NewVerifier()
+	raw, state, err := libs.SignLinkToken(a.Config.Auth.JWTSecret, ssoPurpose, name+":"+verifier, ssoLoginTTL)
+	if err != nil {
+		logging.FromContext(c.Request.Context()).Error("failed to sign sso state", "error", err)
+		libs.RespondError(c, libs.CodeInternal, "Internal server error. Please try again later.")
+		return
+	}
+	target, err := provider.AuthCodeURL(c.Request.Context(), state.Nonce, state.Nonce, verifier)
+	if err != nil {
+		logging.FromContext(c.Request.Context()).Error("sso provider unavailable", "provider", name, "error", err)
+		libs.RespondError(c, libs.CodeInternal, "The identity provider is unavailable. Please try again later.")
+		return
+	}
+
+	a.setSSOCookie(c, raw, int(ssoLoginTTL/time.Second))
+	c.Redirect(http.StatusFound, target)
+}
+
+// FinishSSO is the provider's redirect back. It signs the user in, creating
+// or linking the account by verified email, and hands our own token (or an
+// MFA challenge) to the frontend in the URL fragment so it never reaches
+// server logs.
+func (a *App) FinishSSO(c *gin.Context) {
+	name := c.Param("provider")
+	provider, ok := a.SSO[name]
+	if !ok {
+		libs.RespondError(c, libs.CodeProviderNotFound, "Unknown identity provider")
+		return
+	}
+
+	logger := logging.FromContext(c.Request.Context()).With("provider", name)
+	raw, _ := c.Cookie(ssoCookie)
+	a.setSSOCookie(c, "", -1)
+
+	if reason := c.Query("error"); reason != "" {
+		logger.Info("sso login rejected", "reason", reason)
+		a.redirectSSO(c, "error", string(libs.CodeSSOFailed))
+		return
+	}
+
+	state, err := libs.ParseLinkToken(a.Config.Auth.JWTSecret, ssoPurpose, raw)
+	stateName, verifier, _ := strings.Cut(state.Subject, ":")
+	if err != nil || stateName != name || subtle.ConstantTimeCompare([]byte(c.Query("state")), []byte(state.Nonce)) != 1 {
+		logger.Info("sso login rejected", "reason", "state_mismatch")
+		a.redirectSSO(c, "error", string(libs.CodeSSOFailed))
+		return
+	}
+
+	identity, err := provider.Exchange(c.Request.Context(), c.Query("code"), state.Nonce, verifier)
+	if err != nil {
+		logger.Warn("sso exchange failed", "error", err)
+		a.redirectSSO(c, "error", string(libs.CodeSSOFailed))
+		return
+	}
+	if !identity.EmailVerified {
+		logger.Info("sso login rejected", "reason", "email_unverified")
+		a.redirectSSO(c, "error", string(libs.CodeEmailUnverified))
+		return
+	}
+
+	user, err := a.ssoUser(c.Request.Context(), identity)
+	if err != nil {
+		logger.Error("failed to sign in sso user", "error", err)
+		a.redirectSSO(c, "error", string(libs.CodeSSOFailed))
+		return
+	}
+	if user.Disabled {
+		logger.Info("sso login rejected", "user_id", user.ID.Hex(), "reason", "disabled")
+		a.redirectSSO(c, "error", string(libs.CodeAccountDisabled))
+		return
+	}
+
+	// The provider vouches for the password step only
+	if user.MFAEnabled() {
+		challenge, err := a.issueMFAChallenge(c.Request.Context(), user)
+		if err != nil {
+			logger.Error("failed to issue mfa challenge", "user_id", user.ID.Hex(), "error", err)
+			a.redirectSSO(c, "error", string(libs.CodeInternal))
+			return
+		}
+		a.redirectSSO(c, "mfaToken", challenge)
+		return
+	}
+
+	token, err := a.startSession(c, user)
+	if err != nil {
+		logger.Error("failed to start session", "user_id", user.ID.Hex(), "error", err)
+		a.redirectSSO(c, "error", string(libs.CodeInternal))
+		return
+	}
+	logger.Info("sso login", "user_id", user.ID.Hex())
+	a.redirectSSO(c, "token", token)
+}
+
+// ssoUser finds the account identity signs in as: the one already linked
+// to it, else the one with the same email (which the provider verified),
+// else a new passwordless account.
+func (a *App) ssoUser(ctx context.Context, identity *sso.Identity) (*model.User, error) {
+	user, err := a.Repos.Users.FindByIdentity(ctx, identity.Provider, identity.Subject)
+	if !errors.Is(err, repository.ErrNotFound) {
+		return user, err
+	}
+
+	email, err := libs.NormalizeEmail(identity.Email)
+	if err != nil {
+		return nil, fmt.Errorf("%s email %q: %w", identity.Provider, identity.Email, err)
+	}
+	link := model.Identity{Provider: identity.Provider, Subject: identity.Subject, LinkedAt: time.Now()}
+	user, err = a.Repos.Users.FindByEmail(ctx, a.emailKey(email))
+	if err == nil {
+		// Nobody proved they own an unverified account's address, so it may
+		// have been registered to squat on it; the provider's proof wins
+		// and whoever registered it is locked out before the link
+		if !user.EmailVerified {
+			err := a.Repos.ClaimUnverified(ctx, user.ID)
+			switch {
+			case errors.Is(err, repository.ErrNotFound):
+				// Verified by its owner meanwhile; link as usual
+			case err != nil:
+				return nil, err
+			default:
+				logging.FromContext(ctx).Warn("unverified account claimed through sso", "user_id", user.ID.Hex(), "provider", identity.Provider)
+				user.Password, user.MFA, user.PendingEmail, user.DeleteAt = "", nil, "", nil
+			}
+			user.EmailVerified = true
+		}
+		if err := a.Repos.Users.LinkIdentity(ctx, user.ID, link); err != nil {
+			return nil, err
+		}
+		return user, nil
+	}
+	if !errors.Is(err, repository.ErrNotFound) {
+		return nil, err
+	}
+
+	now := time.Now()
+	reg, err := a.Repos.Register(ctx, &model.User{
+		Email:           email,
+		EmailKey:        a.emailKey(email),
+		EmailVerified:   true,
+		EmailVerifiedAt: &now,
+		Identities:      []model.Identity{link},
+	})
+	if err != nil {
+		return nil, err
+	}
+	logging.FromContext(ctx).Info("user created", "user_id", reg.User.ID.Hex(), "chat_id", reg.Chat.ID.Hex(), "provider", identity.Provider)
+	return reg.User, nil
+}
+
+func (a *App) setSSOCookie(c *gin.Context, value string, maxAge int) {
+	secure := strings.HasPrefix(a.Config.SSO.CallbackBaseURL, "https://")
+	// Lax, not Strict: the callback is a cross-site navigation from the provider
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(ssoCookie, value, maxAge, ssoCookiePath, "", secure, true)
+}
+
+// redirectSSO sends the browser to the frontend with key=value in the
+// fragment.
+func (a *App) redirectSSO(c *gin.Context, key, value string) {
+	c.Redirect(http.StatusFound, a.Config.SSO.RedirectURL+"#"+url.Values{key: {value}}.Encode())
+}
@@ -0,0 +1,324 @@
+package controlers
+
+import (
+	"time"
+
+	"github.com/sarwanazhar/chatappbackend/libs"
+	"github.com/sarwanazhar/chatappbackend/model"
+	"github.com/sarwanazhar/chatappbackend/repository"
+)
+
+// Request and response bodies. The OpenAPI document is generated from these
+// types, so a field added here shows up in /openapi.json and in request
+// validation without further changes. `binding` tags are enforced by gin and
+// mirrored into the schema (required, min, max).
+
+// RegisterRequest leaves an empty Password to the password policy, which
+// explains what a new password needs.
+type RegisterRequest struct {
+	Email       string       `json:"email" binding:"required"`
+	Password    string       `json:"password"`
+	ProofOfWork *ProofOfWork `json:"proofOfWork,omitempty"`
+}
+
+type LoginRequest struct {
+	Email       string       `json:"email" binding:"required"`
+	Password    string       `json:"password" binding:"required"`
+	ProofOfWork *ProofOfWork `json:"proofOfWork,omitempty"`
+}
+
+// ProofOfWork is a solved challenge from GET /v1/auth/challenge.
+type ProofOfWork struct {
+	Challenge string `json:"challenge" binding:"required"`
+	Solution  string `json:"solution" binding:"required"`
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+type ResendVerificationRequest struct {
+	Email string `json:"email" binding:"required"`
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required"`
+}
+
+// ResetPasswordRequest leaves an empty Password to the password policy.
+type ResetPasswordRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password"`
+}
+
+// ChangePasswordRequest needs CurrentPassword unless the account has no
+// password yet, as after signing up through SSO, and Code when 2FA is on.
+// An empty NewPassword is left to the password policy.
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"currentPassword,omitempty"`
+	NewPassword     string `json:"newPassword"`
+	Code            string `json:"code,omitempty"`
+}
+
+type ChangeEmailRequest struct {
+	Email    string `json:"email" binding:"required"`
+	Password string `json:"password,omitempty"`
+	Code     string `json:"code,omitempty"`
+}
+
+type DeleteAccountRequest struct {
+	Password string `json:"password,omitempty"`
+	Code     string `json:"code,omitempty"`
+}
+
+type MFALoginRequest struct {
+	MFAToken string `json:"mfaToken" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+// MFACodeRequest carries a TOTP code, or a recovery code where allowed.
+type MFACodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type CreateAPIKeyRequest struct {
+	Name   string   `json:"name" binding:"required,max=100"`
+	Scopes []string `json:"scopes" binding:"required"`
+	// ExpiresAt is optional; keys without one last until revoked.
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
+type SetRoleRequest struct {
+	Role string `json:"role" binding:"required"`
+}
+
+type CreateChatRequest struct {
+	Title string `json:"title,omitempty" binding:"max=200"`
+}
+
+type UpdateChatRequest struct {
+	Title string `json:"title" binding:"required,max=200"`
+}
+
+type MessageRequest struct {
+	Prompt string `json:"prompt" binding:"required"`
+}
+
+// LegacyDeleteChatRequest is the body of the deprecated POST /chat/delete.
+type LegacyDeleteChatRequest struct {
+	ChatID string `json:"chat_id" binding:"required"`
+}
+
+// LegacyMessageRequest is the body of the deprecated POST /chat/message,
+// which names the chat in the body instead of the path.
+type LegacyMessageRequest struct {
+	ChatID string `json:"chat_id" binding:"required"`
+	Prompt string `json:"prompt" binding:"required"`
+}
+
+// InfoResponse acknowledges a request that has nothing else to return.
+type InfoResponse struct {
+	Message string `json:"message"`
+}
+
+type UserResponse struct {
+	ID            string `json:"id"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"emailVerified"`
+	MFAEnabled    bool   `json:"mfaEnabled"`
+	// PendingEmail is an address change waiting for confirmation.
+	PendingEmail string `json:"pendingEmail,omitempty"`
+	// DeleteAt is set while the account is scheduled for deletion.
+	DeleteAt *time.Time `json:"deleteAt,omitempty"`
+}
+
+func newUserResponse(user *model.User) UserResponse {
+	return UserResponse{
+		ID:            user.ID.Hex(),
+		Email:         user.Email,
+		EmailVerified: user.EmailVerified,
+		MFAEnabled:    user.MFAEnabled(),
+		PendingEmail:  user.PendingEmail,
+		DeleteAt:      user.DeleteAt,
+	}
+}
+
+// AccountDeletionResponse says when a deleted account will be gone for good.
+type AccountDeletionResponse struct {
+	DeleteAt time.Time `json:"deleteAt"`
+}
+
+// LoginResponse has Token and User once the user is signed in. With 2FA on,
+// the password step instead answers MFARequired and an MFAToken to send
+// with a code to /v1/auth/mfa.
+type LoginResponse struct {
+	Token       string        `json:"token,omitempty"`
+	User        *UserResponse `json:"user,omitempty"`
+	MFARequired bool          `json:"mfaRequired,omitempty"`
+	MFAToken    string        `json:"mfaToken,omitempty"`
+}
+
+func newLoginResponse(token string, user *model.User) LoginResponse {
+	resp := newUserResponse(user)
+	return LoginResponse{Token: token, User: &resp}
+}
+
+type TOTPEnrollmentResponse struct {
+	Secret string `json:"secret"`
+	// URI is the otpauth:// link to render as a QR code.
+	URI string `json:"otpauthUri"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+// ChallengeResponse is a proof-of-work challenge: find a solution such that
+// SHA-256(challenge + solution) starts with Difficulty zero bits. Enabled
+// says whether registration currently needs one.
+type ChallengeResponse struct {
+	Challenge  string    `json:"challenge"`
+	Algorithm  string    `json:"algorithm"`
+	Difficulty int       `json:"difficulty"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+	Enabled    bool      `json:"enabled"`
+}
+
+type ProvidersResponse struct {
+	Providers []string `json:"providers"`
+}
+
+type APIKeyResponse struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+	ExpiresAt  *time.Time `json:"expiresAt,omitempty"`
+}
+
+func newAPIKeyResponse(key *model.APIKey) APIKeyResponse {
+	return APIKeyResponse{
+		ID:         key.ID.Hex(),
+		Name:       key.Name,
+		Prefix:     key.Prefix,
+		Scopes:     key.Scopes,
+		CreatedAt:  key.CreatedAt,
+		LastUsedAt: key.LastUsedAt,
+		ExpiresAt:  key.ExpiresAt,
+	}
+}
+
+// APIKeyCreatedResponse is the only time the key itself is returned.
+type APIKeyCreatedResponse struct {
+	Key    string         `json:"key"`
+	APIKey APIKeyResponse `json:"apiKey"`
+}
+
+type APIKeyListResponse struct {
+	APIKeys []APIKeyResponse `json:"apiKeys"`
+}
+
+// SessionResponse is one sign-in. Device is a readable guess from the user
+// agent; Current marks the session making the request.
+type SessionResponse struct {
+	ID         string    `json:"id"`
+	Device     string    `json:"device"`
+	UserAgent  string    `json:"userAgent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"createdAt"`
+	LastSeenAt time.Time `json:"lastSeenAt"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+	Current    bool      `json:"current"`
+}
+
+func newSessionResponse(session *model.Session, currentID string) SessionResponse {
+	return SessionResponse{
+		ID:         session.ID.Hex(),
+		Device:     libs.DescribeUserAgent(session.UserAgent),
+		UserAgent:  session.UserAgent,
+		IP:         session.IP,
+		CreatedAt:  session.CreatedAt,
+		LastSeenAt: session.LastSeenAt,
+		ExpiresAt:  session.ExpiresAt,
+		Current:    session.ID.Hex() == currentID,
+	}
+}
+
+type SessionListResponse struct {
+	Sessions []SessionResponse `json:"sessions"`
+}
+
+// ExportResponse is a data export job. DownloadURL is set once it is
+// ready, and works with the same Authorization header until ExpiresAt.
+type ExportResponse struct {
+	ID          string     `json:"id"`
+	Status      string     `json:"status"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	CompletedAt *time.Time `json:"completedAt,omitempty"`
+	Size        int64      `json:"size,omitempty"`
+	DownloadURL string     `json:"downloadUrl,omitempty"`
+	ExpiresAt   *time.Time `json:"expiresAt,omitempty"`
+}
+
+// AdminUserResponse is a user as staff see them in the admin API.
+type AdminUserResponse struct {
+	ID            string    `json:"id"`
+	Email         string    `json:"email"`
+	Role          string    `json:"role"`
+	Disabled      bool      `json:"disabled"`
+	EmailVerified bool      `json:"emailVerified"`
+	MFAEnabled    bool      `json:"mfaEnabled"`
+	Providers     []string  `json:"providers"`
+	CreatedAt     time.Time `json:"createdAt"`
+}
+
+func newAdminUserResponse(user *model.User) AdminUserResponse {
+	providers := make([]string, len(user.Identities))
+	for i, id := range user.Identities {
+		providers[i] = id.Provider
+	}
+	return AdminUserResponse{
+		ID:            user.ID.Hex(),
+		Email:         user.Email,
+		Role:          user.RoleName(),
+		Disabled:      user.Disabled,
+		EmailVerified: user.EmailVerified,
+		MFAEnabled:    user.MFAEnabled(),
+		Providers:     providers,
+		CreatedAt:     user.CreatedAt,
+	}
+}
+
+// AdminUserListResponse is one page of a user search; Total counts every
+// match.
+type AdminUserListResponse struct {
+	Users  []AdminUserResponse `json:"users"`
+	Total  int64               `json:"total"`
+	Offset int64               `json:"offset"`
+	Limit  int64               `json:"limit"`
+}
+
+type AdminUserDetailResponse struct {
+	User  AdminUserResponse    `json:"user"`
+	Usage repository.UserUsage `json:"usage"`
+}
+
+type ChatCreatedResponse struct {
+	Message string `json:"message"`
+	ChatID  string `json:"chatId"`
+}
+
+type ChatListResponse struct {
+	Chats []model.Chat `json:"chats"`
+}
+
+type ChatResponse struct {
+	Chat *model.Chat `json:"chat"`
+}
+
+// DeltaEvent is the data of each unnamed SSE event while a reply streams.
+type DeltaEvent struct {
+	Delta string `json:"delta"`
+}
@@ -1,157 +1,192 @@
 package controlers
 
 import (
-	"context"
-	"fmt"
-	"log"
+	"errors"
 	"net/http"
-	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/sarwanazhar/chatappbackend/database"
 	"github.com/sarwanazhar/chatappbackend/libs"
+	"github.com/sarwanazhar/chatappbackend/logging"
 	"github.com/sarwanazhar/chatappbackend/model"
-	"go.mongodb.org/mongo-driver/bson/primitive"
+	"github.com/sarwanazhar/chatappbackend/repository"
 )
 
 // this creates a simple user in mongo db
 // its a post needs json {"email": "", "password": ""}
-func CreateUser(c *gin.Context) {
-	type Body struct {
-		Email    string `json:"email"`
-		Password string `json:"password"`
+func (a *App) CreateUser(c *gin.Context) {
+	var body RegisterRequest
+	if err := c.ShouldBindJSON(&body); err != nil {
+		libs.RespondError(c, libs.CodeInvalidRequest, "Email is required")
+		return
 	}
 
-	var body Body
-	if err := c.ShouldBindJSON(&body); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	logger := logging.FromContext(c.Request.Context())
+	a.authLoad.Add()
+
+	email, emailProblem := a.normalizeEmail("email", body.Email)
+	passwordProblem := a.checkNewPassword(c.Request.Context(), "password", body.Password, email)
+	if fields := fieldErrors(emailProblem, passwordProblem); len(fields) > 0 {
+		libs.RespondInvalid(c, "Check the highlighted fields", fields...)
 		return
 	}
 
-	EmailExists, err := libs.SearchForExistingEmail(body.Email)
+	if a.Config.PoW.Enabled && !a.checkProofOfWork(c, body.ProofOfWork) {
+		return
+	}
+
+	exists, err := a.Repos.Users.EmailExists(c.Request.Context(), a.emailKey(email))
 
 	if err != nil {
-		log.Printf("Failed to check email existence for %s: %v", body.Email, err)
+		logger.Error("failed to check email existence", "email", email, "error", err)
 
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error. Please try again later."})
-		return // <<-- FIX: use simple return
+		libs.RespondError(c, libs.CodeInternal, "Internal server error. Please try again later.")
+		return
 	}
 
-	if EmailExists {
-		c.JSON(http.StatusConflict, gin.H{"error": "This email address is already registered."})
+	if exists {
+		libs.RespondError(c, libs.CodeEmailTaken, "This email address is already registered.")
 		return
 	}
 
-	hashedPassword, err := libs.HashPassword(body.Password)
+	hashedPassword, err := a.Passwords.Hash(body.Password)
 
 	if err != nil {
-		log.Fatal(err)
+		logger.Error("failed to hash password", "error", err)
+		libs.RespondError(c, libs.CodeInternal, "Internal server error. Please try again later.")
+		return
 	}
 
-	contxt, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
 	user := &model.User{
-		Email:    body.Email,
+		Email:    email,
+		EmailKey: a.emailKey(email),
 		Password: hashedPassword,
 	}
 
-	newId, err := libs.CreateUser(contxt, user)
+	reg, err := a.Repos.Register(c.Request.Context(), user)
+	if errors.Is(err, repository.ErrDuplicate) {
+		// Lost a race with a concurrent registration of the same email
+		libs.RespondError(c, libs.CodeEmailTaken, "This email address is already registered.")
+		return
+	}
 	if err != nil {
-		log.Printf("Failed to create user %s: %v", body.Email, err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error. Please try again later."})
+		logger.Error("failed to register user", "email", email, "error", err)
+		libs.RespondError(c, libs.CodeInternal, "Internal server error. Please try again later.")
 		return
 	}
-	fmt.Print("new user created id:")
-	fmt.Println(newId)
+	logger.Info("user created", "user_id", reg.User.ID.Hex(), "chat_id", reg.Chat.ID.Hex())
 
-	chat := model.Chat{
-		ID:        primitive.NewObjectID(),
-		UserID:    newId,
-		Title:     "Chat",
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
+	// The account is usable either way; a lost email can be resent
+	if err := a.sendVerification(c.Request.Context(), reg.User); err != nil {
+		logger.Error("failed to send verification email", "user_id", reg.User.ID.Hex(), "error", err)
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+	c.JSON(http.StatusCreated, InfoResponse{Message: "User created successfully"})
+}
 
-	_, err = database.GetCollection("chatApp", "chat").InsertOne(ctx, chat)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create chat"})
+func (a *App) LoginUser(c *gin.Context) {
+	var body LoginRequest
+	if err := c.ShouldBindJSON(&body); err != nil {
+		libs.RespondError(c, libs.CodeInvalidRequest, "Email and password are required")
 		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{"message": "User created successfully"})
-}
+	ctx := c.Request.Context()
+	logger := logging.FromContext(ctx)
+	a.authLoad.Add()
 
-func LoginUser(c *gin.Context) {
-	type Body struct {
-		Email    string `json:"email"`
-		Password string `json:"password"`
+	email, problem := a.normalizeEmail("email", body.Email)
+	if problem != nil {
+		libs.RespondInvalid(c, problem.Message, *problem)
+		return
 	}
-	var body Body
-	if err := c.ShouldBindJSON(&body); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+
+	// Attempts count against the account, whichever of its addresses is used
+	key := a.emailKey(email)
+	wait, failures := a.loginStatus(ctx, key, c.ClientIP())
+	if wait > 0 {
+		logger.Info("login rejected", "email", email, "reason", "throttled")
+		respondLoginWait(c, wait)
+		return
+	}
+	if a.loginNeedsProofOfWork(failures) && !a.checkProofOfWork(c, body.ProofOfWork) {
+		logger.Info("login rejected", "email", email, "reason", "proof_of_work")
 		return
 	}
 
-	foundUser, err := libs.FindUserByEmail(body.Email)
+	foundUser, err := a.Repos.Users.FindByEmail(ctx, key)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{
-			"error": "Invalid email or password",
-		})
+		// Burn the same hashing time as a real check so unknown emails
+		// can't be told apart by how fast they fail
+		a.Passwords.Check(body.Password, "")
+		a.loginFailed(ctx, key, c.ClientIP(), nil)
+		logger.Info("login rejected", "email", email, "reason", err.Error())
+		libs.RespondError(c, libs.CodeInvalidCredentials, "Invalid email or password")
 		return
 	}
 
-	// Log the successful result (avoid exposing sensitive fields in responses)
-	fmt.Printf("User Found!\n")
-	fmt.Printf("ID: %s\n", foundUser.ID.Hex())
-	fmt.Printf("Email: %s\n", foundUser.Email)
-	// ... print other fields
-
-	isPasswordCorrect := libs.CheckPasswordHash(body.Password, foundUser.Password)
+	isPasswordCorrect := a.checkPassword(ctx, foundUser, body.Password)
 
 	if !isPasswordCorrect {
-		c.JSON(401, gin.H{"error": "Invalid email or password"})
+		a.loginFailed(ctx, key, c.ClientIP(), foundUser)
+		logger.Info("login rejected", "user_id", foundUser.ID.Hex(), "reason", "wrong_password")
+		libs.RespondError(c, libs.CodeInvalidCredentials, "Invalid email or password")
+		return
+	}
+
+	if foundUser.Disabled {
+		logger.Info("login rejected", "user_id", foundUser.ID.Hex(), "reason", "disabled")
+		libs.RespondError(c, libs.CodeAccountDisabled, "This account has been disabled")
 		return
 	}
 
+	if foundUser.MFAEnabled() {
+		challenge, err := a.issueMFAChallenge(ctx, foundUser)
+		if err != nil {
+			logger.Error("failed to issue mfa challenge", "user_id", foundUser.ID.Hex(), "error", err)
+			libs.RespondError(c, libs.CodeInternal, "Internal server error. Please try again later.")
+			return
+		}
+		c.JSON(http.StatusOK, LoginResponse{MFARequired: true, MFAToken: challenge})
+		return
+	}
+
+	a.loginSucceeded(ctx, key)
+
 	// generate token
-	token, err := libs.GenerateJWT(foundUser.ID.Hex())
+	token, err := a.startSession(c, foundUser)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Could not generate token",
-		})
+		logger.Error("failed to start session", "user_id", foundUser.ID.Hex(), "error", err)
+		libs.RespondError(c, libs.CodeInternal, "Could not generate token")
 		return
 	}
 
 	// Return token to client
-	c.JSON(http.StatusOK, gin.H{
-		"token": token,
-		"user": gin.H{
-			"id":    foundUser.ID.Hex(),
-			"email": foundUser.Email,
-		},
-	})
+	c.JSON(http.StatusOK, newLoginResponse(token, foundUser))
 
 }
 
 // Protected routes
 
-func GetProfiles(c *gin.Context) {
+func (a *App) GetProfiles(c *gin.Context) {
 	userID := c.GetString("userId")
-	fmt.Print(userID)
 
-	user, err := libs.FindUserByID(userID)
+	user, err := a.Repos.Users.FindByID(c.Request.Context(), userID)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		libs.RespondError(c, libs.CodeUserNotFound, "User not found")
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"id":    user.ID.Hex(),
-		"email": user.Email,
-	})
+	c.JSON(http.StatusOK, newUserResponse(user))
 
 }
+
+// currentUser loads the user JWTMiddleware authenticated. It has already
+// responded when ok is false.
+func (a *App) currentUser(c *gin.Context) (*model.User, bool) {
+	user, err := a.Repos.Users.FindByID(c.Request.Context(), c.GetString("userId"))
+	if err != nil {
+		libs.RespondError(c, libs.CodeUserNotFound, "User not found")
+		return nil, false
+	}
+	return user, true
+}
@@ -0,0 +1,46 @@
+package controlers
+
+import (
+	"context"
+
+	"github.com/sarwanazhar/chatappbackend/libs"
+	"github.com/sarwanazhar/chatappbackend/logging"
+)
+
+// normalizeEmail returns email in the form accounts store and mail it, or
+// what is wrong with it as the request's field.
+func (a *App) normalizeEmail(field, email string) (string, *libs.FieldError) {
+	normalized, err := libs.NormalizeEmail(email)
+	if err != nil {
+		return "", &libs.FieldError{Field: field, Code: libs.FieldInvalid, Message: "Enter a valid email address"}
+	}
+	return normalized, nil
+}
+
+// emailKey returns what accounts are looked up under for a normalized email.
+func (a *App) emailKey(email string) string {
+	return libs.EmailKey(email, a.Config.Auth.FoldPlusAddresses)
+}
+
+// checkNewPassword returns what keeps password from becoming the password
+// of the account registered to email, or nil. An unreadable breached
+// password list is logged and otherwise ignored, so an operator's mistake
+// doesn't stop everyone from registering.
+func (a *App) checkNewPassword(ctx context.Context, field, password, email string) *libs.FieldError {
+	problem, err := a.PasswordPolicy.Check(field, password, email)
+	if err != nil {
+		logging.FromContext(ctx).Error("failed to check breached passwords", "error", err)
+	}
+	return problem
+}
+
+// fieldErrors collects the problems that were found.
+func fieldErrors(problems ...*libs.FieldError) []libs.FieldError {
+	var fields []libs.FieldError
+	for _, p := range problems {
+		if p != nil {
+			fields = append(fields, *p)
+		}
+	}
+	return fields
+}
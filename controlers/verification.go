@@ -0,0 +1,176 @@
+package controlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/chatappbackend/libs"
+	"github.com/sarwanazhar/chatappbackend/logging"
+	"github.com/sarwanazhar/chatappbackend/mail"
+	"github.com/sarwanazhar/chatappbackend/model"
+	"github.com/sarwanazhar/chatappbackend/repository"
+)
+
+const verifyEmailPurpose = "verify_email"
+
+// resendCooldown stops the resend endpoint from being used to flood an inbox.
+const resendCooldown = time.Minute
+
+// VerifyEmail consumes the token from a verification email.
+// It needs json {"token": ""}.
+func (a *App) VerifyEmail(c *gin.Context) {
+	var body VerifyEmailRequest
+	if err := c.ShouldBindJSON(&body); err != nil {
+		libs.RespondError(c, libs.CodeInvalidRequest, "Token is required")
+		return
+	}
+
+	logger := logging.FromContext(c.Request.Context())
+
+	token, err := libs.ParseLinkToken(a.Config.Auth.JWTSecret, verifyEmailPurpose, body.Token)
+	if errors.Is(err, libs.ErrLinkTokenExpired) {
+		libs.RespondError(c, libs.CodeLinkExpired, "This verification link has expired, request a new one")
+		return
+	}
+	if err != nil {
+		libs.RespondError(c, libs.CodeLinkInvalid, "This verification link is invalid")
+		return
+	}
+
+	userID, err := a.Repos.Tokens.Consume(c.Request.Context(), token.NonceHash(), verifyEmailPurpose)
+	if errors.Is(err, repository.ErrNotFound) || (err == nil && userID.Hex() != token.Subject) {
+		libs.RespondError(c, libs.CodeLinkInvalid, "This verification link was already used or replaced by a newer one")
+		return
+	}
+	if err != nil {
+		logger.Error("failed to consume verification token", "error", err)
+		libs.RespondError(c, libs.CodeInternal, "Internal server error. Please try again later.")
+		return
+	}
+
+	if err := a.Repos.Users.MarkEmailVerified(c.Request.Context(), userID); err != nil {
+		logger.Error("failed to mark email verified", "user_id", userID.Hex(), "error", err)
+		libs.RespondError(c, libs.CodeInternal, "Internal server error. Please try again later.")
+		return
+	}
+	logger.Info("email verified", "user_id", userID.Hex())
+
+	c.JSON(http.StatusOK, InfoResponse{Message: "Email verified"})
+}
+
+// ResendVerification emails a new link. It needs json {"email": ""} and
+// always answers 202 so it can't be used to find out who has an account.
+func (a *App) ResendVerification(c *gin.Context) {
+	var body ResendVerificationRequest
+	if err := c.ShouldBindJSON(&body); err != nil {
+		libs.RespondError(c, libs.CodeInvalidRequest, "Email is required")
+		return
+	}
+	email, problem := a.normalizeEmail("email", body.Email)
+	if problem != nil {
+		libs.RespondInvalid(c, problem.Message, *problem)
+		return
+	}
+
+	// Sending happens in the background so the response time doesn't reveal
+	// whether the address is registered.
+	a.mailInBackground(c.Request.Context(), "resend verification", func(ctx context.Context) {
+		logger := logging.FromContext(ctx)
+		user, err := a.Repos.Users.FindByEmail(ctx, a.emailKey(email))
+		if err != nil {
+			if !errors.Is(err, repository.ErrNotFound) {
+				logger.Error("resend verification lookup failed", "error", err)
+			}
+			return
+		}
+		if user.EmailVerified || (user.VerificationSentAt != nil && time.Since(*user.VerificationSentAt) < resendCooldown) {
+			return
+		}
+		if err := a.sendVerification(ctx, user); err != nil {
+			logger.Error("failed to resend verification email", "user_id", user.ID.Hex(), "error", err)
+		}
+	})
+
+	c.JSON(http.StatusAccepted, InfoResponse{Message: "If that address needs verifying, a new link is on its way"})
+}
+
+// RequireVerifiedEmail rejects users who haven't verified their address when
+// auth.require_verified_email is on. It runs after JWTMiddleware.
+func (a *App) RequireVerifiedEmail() gin.HandlerFunc {
+	if !a.Config.Auth.RequireVerifiedEmail {
+		return func(c *gin.Context) { c.Next() }
+	}
+	return func(c *gin.Context) {
+		user, err := a.Repos.Users.FindByID(c.Request.Context(), c.GetString("userId"))
+		if err != nil {
+			libs.RespondError(c, libs.CodeUserNotFound, "User not found")
+			return
+		}
+		if !user.EmailVerified {
+			libs.RespondError(c, libs.CodeEmailUnverified, "Verify your email address to use chats")
+			return
+		}
+		c.Next()
+	}
+}
+
+// sendVerification emails user a fresh verification link. Links sent
+// earlier stop working.
+func (a *App) sendVerification(ctx context.Context, user *model.User) error {
+	cfg := a.Config.Auth
+	raw, token, err := libs.SignLinkToken(cfg.JWTSecret, verifyEmailPurpose, user.ID.Hex(), cfg.VerificationTTL)
+	if err != nil {
+		return err
+	}
+	if err := a.Repos.Tokens.RevokeAll(ctx, user.ID, verifyEmailPurpose); err != nil {
+		return err
+	}
+	if err := a.Repos.Tokens.Issue(ctx, token.NonceHash(), verifyEmailPurpose, user.ID, token.ExpiresAt); err != nil {
+		return err
+	}
+
+	link, err := withToken(cfg.VerifyEmailURL, raw)
+	if err != nil {
+		return err
+	}
+	if err := a.Mailer.Send(ctx, mail.Verification(user.Email, link, cfg.VerificationTTL)); err != nil {
+		return fmt.Errorf("sending mail: %w", err)
+	}
+	return a.Repos.Users.SetVerificationSentAt(ctx, user.ID, time.Now())
+}
+
+// withToken adds ?token= to a frontend URL, keeping any query it has.
+func withToken(base, token string) (string, error) {
+	u, err := url.Parse(base)
+	if err != nil {
+		return "", fmt.Errorf("invalid link URL %q: %w", base, err)
+	}
+	q := u.Query()
+	q.Set("token", token)
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// mailInBackground runs send, which emails an address, after the response
+// has gone out, at most mail.workers at a time. When every worker is busy
+// the request is logged and dropped rather than queued, so a burst of
+// requests can't pile up goroutines; the client is told the same either
+// way.
+func (a *App) mailInBackground(ctx context.Context, what string, send func(ctx context.Context)) {
+	ctx = context.WithoutCancel(ctx)
+	select {
+	case a.mailSlots <- struct{}{}:
+	default:
+		logging.FromContext(ctx).Warn("mail workers busy, dropping request", "request", what)
+		return
+	}
+	go func() {
+		defer func() { <-a.mailSlots }()
+		send(ctx)
+	}()
+}
@@ -0,0 +1,44 @@
+package controlers
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMailInBackgroundDropsWhenBusy(t *testing.T) {
+	a := &App{mailSlots: make(chan struct{}, 1)}
+	ctx := context.Background()
+
+	started, release := make(chan struct{}), make(chan struct{})
+	a.mailInBackground(ctx, "first", func(context.Context) {
+		close(started)
+		<-release
+	})
+	<-started
+
+	dropped := make(chan struct{}, 1)
+	a.mailInBackground(ctx, "second", func(context.Context) { dropped <- struct{}{} })
+
+	close(release)
+	deadline := time.Now().Add(5 * time.Second)
+	for len(a.mailSlots) > 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("the first send never gave its slot back")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	done := make(chan struct{})
+	a.mailInBackground(ctx, "third", func(context.Context) { close(done) })
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("a send with a free slot never ran")
+	}
+	select {
+	case <-dropped:
+		t.Error("a send made while every slot was busy ran")
+	default:
+	}
+}
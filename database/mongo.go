@@ -2,36 +2,59 @@ package database
 
 import (
 	"context"
-	"log"
-	"time"
+	"fmt"
 
+	"github.com/sarwanazhar/chatappbackend/config"
+	"github.com/sarwanazhar/chatappbackend/metrics"
+	"github.com/sarwanazhar/chatappbackend/tracing"
+	"go.mongodb.org/mongo-driver/v2/event"
 	"go.mongodb.org/mongo-driver/v2/mongo"
 	"go.mongodb.org/mongo-driver/v2/mongo/options"
 )
 
-var Client *mongo.Client
-
-func ConnectMongo(uri string) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+// ConnectMongo connects to cfg.URI and pings the server before returning.
+// Every command is instrumented with metrics and trace spans.
+func ConnectMongo(ctx context.Context, cfg config.MongoConfig) (*mongo.Client, error) {
+	ctx, cancel := context.WithTimeout(ctx, cfg.ConnectTimeout)
 	defer cancel()
 
-	client, err := mongo.Connect(options.Client().ApplyURI(uri))
+	client, err := mongo.Connect(options.Client().ApplyURI(cfg.URI).SetMonitor(combineMonitors(metrics.MongoMonitor(), tracing.MongoMonitor())))
 	if err != nil {
-		log.Fatal("Mongo connect error:", err)
+		return nil, fmt.Errorf("mongo connect error: %w", err)
 	}
 
 	if err := client.Ping(ctx, nil); err != nil {
-		log.Fatal("Mongo ping error:", err)
+		_ = client.Disconnect(context.Background())
+		return nil, fmt.Errorf("mongo ping error: %w", err)
 	}
 
-	Client = client
-	log.Println("✅ MongoDB connected")
-}
-
-func GetDatabase(dbName string) *mongo.Database {
-	return Client.Database(dbName)
+	return client, nil
 }
 
-func GetCollection(dbName, collectionName string) *mongo.Collection {
-	return Client.Database(dbName).Collection(collectionName)
+// combineMonitors fans every command event out to each monitor, since the
+// driver only accepts a single one.
+func combineMonitors(monitors ...*event.CommandMonitor) *event.CommandMonitor {
+	return &event.CommandMonitor{
+		Started: func(ctx context.Context, e *event.CommandStartedEvent) {
+			for _, m := range monitors {
+				if m.Started != nil {
+					m.Started(ctx, e)
+				}
+			}
+		},
+		Succeeded: func(ctx context.Context, e *event.CommandSucceededEvent) {
+			for _, m := range monitors {
+				if m.Succeeded != nil {
+					m.Succeeded(ctx, e)
+				}
+			}
+		},
+		Failed: func(ctx context.Context, e *event.CommandFailedEvent) {
+			for _, m := range monitors {
+				if m.Failed != nil {
+					m.Failed(ctx, e)
+				}
+			}
+		},
+	}
 }
@@ -0,0 +1,189 @@
+// Package export builds the ZIP archive a user downloads when they ask for
+// a copy of their data: JSON for machines, plus a Markdown file per chat
+// for people.
+package export
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/sarwanazhar/chatappbackend/model"
+	"github.com/sarwanazhar/chatappbackend/repository"
+)
+
+// Bundle is everything exported about one user.
+type Bundle struct {
+	ExportedAt time.Time
+	User       *model.User
+	Chats      []model.Chat
+	Usage      *repository.UserUsage
+	APIKeys    []model.APIKey
+	Sessions   []model.Session
+}
+
+// profile is the user as exported: no password hash, 2FA secret or
+// recovery codes.
+type profile struct {
+	ID              string           `json:"id"`
+	Email           string           `json:"email"`
+	EmailVerified   bool             `json:"emailVerified"`
+	EmailVerifiedAt *time.Time       `json:"emailVerifiedAt,omitempty"`
+	PendingEmail    string           `json:"pendingEmail,omitempty"`
+	Role            string           `json:"role"`
+	MFAEnabled      bool             `json:"mfaEnabled"`
+	Identities      []model.Identity `json:"identities,omitempty"`
+	DeleteAt        *time.Time       `json:"deleteAt,omitempty"`
+	CreatedAt       time.Time        `json:"createdAt"`
+	UpdatedAt       time.Time        `json:"updatedAt"`
+}
+
+// Write writes b to w as a ZIP archive.
+func Write(w io.Writer, b *Bundle) error {
+	z := zip.NewWriter(w)
+	user := b.User
+
+	files := []struct {
+		name string
+		v    any
+	}{
+		{"profile.json", profile{
+			ID:              user.ID.Hex(),
+			Email:           user.Email,
+			EmailVerified:   user.EmailVerified,
+			EmailVerifiedAt: user.EmailVerifiedAt,
+			PendingEmail:    user.PendingEmail,
+			Role:            user.RoleName(),
+			MFAEnabled:      user.MFAEnabled(),
+			Identities:      user.Identities,
+			DeleteAt:        user.DeleteAt,
+			CreatedAt:       user.CreatedAt,
+			UpdatedAt:       user.UpdatedAt,
+		}},
+		{"usage.json", b.Usage},
+		{"api_keys.json", b.APIKeys},
+		{"sessions.json", b.Sessions},
+	}
+	for _, f := range files {
+		if err := writeJSON(z, f.name, b.ExportedAt, f.v); err != nil {
+			return err
+		}
+	}
+
+	names := make([]string, len(b.Chats))
+	for i := range b.Chats {
+		chat := &b.Chats[i]
+		names[i] = fmt.Sprintf("chats/%03d-%s", i+1, slug(chat.Title))
+		if err := writeJSON(z, names[i]+".json", b.ExportedAt, chat); err != nil {
+			return err
+		}
+		if err := writeFile(z, names[i]+".md", b.ExportedAt, chatMarkdown(chat)); err != nil {
+			return err
+		}
+	}
+	if err := writeFile(z, "README.md", b.ExportedAt, readme(b, names)); err != nil {
+		return err
+	}
+	return z.Close()
+}
+
+func writeJSON(z *zip.Writer, name string, modified time.Time, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding %s: %w", name, err)
+	}
+	return writeFile(z, name, modified, string(data)+"\n")
+}
+
+func writeFile(z *zip.Writer, name string, modified time.Time, content string) error {
+	f, err := z.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: modified})
+	if err != nil {
+		return fmt.Errorf("adding %s: %w", name, err)
+	}
+	if _, err := io.WriteString(f, content); err != nil {
+		return fmt.Errorf("writing %s: %w", name, err)
+	}
+	return nil
+}
+
+// readme is the archive's table of contents.
+func readme(b *Bundle, chatFiles []string) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "# ChatApp data export\n\n")
+	fmt.Fprintf(&sb, "Account %s, exported %s.\n\n", b.User.Email, formatTime(b.ExportedAt))
+	sb.WriteString("- `profile.json`: your account details\n")
+	sb.WriteString("- `usage.json`: how many chats and messages you have\n")
+	sb.WriteString("- `api_keys.json`: your API keys (names, scopes and dates; never the keys themselves)\n")
+	sb.WriteString("- `sessions.json`: the devices you are signed in on\n")
+	sb.WriteString("- `chats/`: every chat, as JSON and as Markdown\n")
+	if len(b.Chats) == 0 {
+		sb.WriteString("\nYou have no chats.\n")
+		return sb.String()
+	}
+	sb.WriteString("\n## Chats\n\n")
+	for i := range b.Chats {
+		chat := &b.Chats[i]
+		fmt.Fprintf(&sb, "- [%s](%s.md), %s, %d messages\n", markdownText(title(chat)), chatFiles[i], formatTime(chat.CreatedAt), len(chat.Messages))
+	}
+	return sb.String()
+}
+
+// chatMarkdown renders a chat as a readable transcript.
+func chatMarkdown(chat *model.Chat) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "# %s\n\n", markdownText(title(chat)))
+	fmt.Fprintf(&sb, "Started %s, %d messages.\n", formatTime(chat.CreatedAt), len(chat.Messages))
+	for _, msg := range chat.Messages {
+		speaker := "You"
+		if msg.Role == "model" {
+			speaker = "Assistant"
+		}
+		fmt.Fprintf(&sb, "\n---\n\n**%s**, %s\n\n%s\n", speaker, formatTime(msg.CreatedAt), strings.TrimSpace(msg.Content))
+	}
+	return sb.String()
+}
+
+func title(chat *model.Chat) string {
+	if strings.TrimSpace(chat.Title) == "" {
+		return "Untitled chat"
+	}
+	return chat.Title
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format("2 January 2006 15:04 UTC")
+}
+
+// markdownText escapes the characters that would turn a title into
+// markup or break a link.
+func markdownText(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "[", `\[`, "]", `\]`, "*", `\*`, "_", `\_`, "`", "\\`", "\n", " ").Replace(s)
+}
+
+// slug makes a short, safe file name from a chat title.
+func slug(s string) string {
+	var sb strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(s) {
+		if sb.Len() >= 40 {
+			break
+		}
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			sb.WriteRune(r)
+			dash = false
+		case !dash && sb.Len() > 0:
+			sb.WriteByte('-')
+			dash = true
+		}
+	}
+	out := strings.Trim(sb.String(), "-")
+	if out == "" {
+		return "chat"
+	}
+	return out
+}
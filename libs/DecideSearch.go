@@ -2,15 +2,16 @@ package libs
 
 import (
 	"context"
-	"fmt"
-	"os"
 	"strings"
-	"time"
 
+	"github.com/sarwanazhar/chatappbackend/logging"
+	"github.com/sarwanazhar/chatappbackend/metrics"
 	"google.golang.org/genai"
 )
 
-func DecideSearch(prompt string) string {
+// DecideSearch asks the router model whether prompt needs a web search.
+// Any failure degrades to NO_SEARCH.
+func (g *Gemini) DecideSearch(ctx context.Context, prompt string) string {
 	router := `
 You are a routing agent.
 
@@ -30,27 +31,18 @@ Respond with ONLY one word: SEARCH or NO_SEARCH.
 Do not add any other text.
 `
 
-	apiKey := os.Getenv("GEMINI_API_KEY")
-	if apiKey == "" {
+	if g.client == nil {
+		metrics.SearchDecisions.WithLabelValues("error").Inc()
 		return "NO_SEARCH"
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, g.cfg.RouterTimeout)
 	defer cancel()
 
-	client, err := genai.NewClient(ctx, &genai.ClientConfig{
-		APIKey:  apiKey,
-		Backend: genai.BackendGeminiAPI,
-	})
-	if err != nil {
-		fmt.Println("error here 123")
-		return "NO_SEARCH"
-	}
-
 	// Use system instruction via config and pass prompt as content
-	resp, err := client.Models.GenerateContent(
+	resp, err := g.client.Models.GenerateContent(
 		ctx,
-		"gemini-2.5-flash-lite",
+		g.cfg.RouterModel,
 		genai.Text(prompt), // returns []*genai.Content, but variadic is accepted
 		&genai.GenerateContentConfig{
 			SystemInstruction: &genai.Content{
@@ -59,6 +51,8 @@ Do not add any other text.
 		},
 	)
 	if err != nil {
+		logging.FromContext(ctx).Warn("search routing failed, skipping search", "error", err)
+		metrics.SearchDecisions.WithLabelValues("error").Inc()
 		return "NO_SEARCH"
 	}
 
@@ -72,7 +66,9 @@ Do not add any other text.
 
 	out = strings.TrimSpace(strings.ToUpper(out))
 	if out == "SEARCH" {
+		metrics.SearchDecisions.WithLabelValues("SEARCH").Inc()
 		return "SEARCH"
 	}
+	metrics.SearchDecisions.WithLabelValues("NO_SEARCH").Inc()
 	return "NO_SEARCH"
 }
@@ -1,6 +1,7 @@
 package libs
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"net/url"
@@ -8,34 +9,60 @@ import (
 	"time"
 
 	"github.com/PuerkitoBio/goquery"
+	"github.com/sarwanazhar/chatappbackend/config"
+	"github.com/sarwanazhar/chatappbackend/logging"
+	"github.com/sarwanazhar/chatappbackend/metrics"
+	"github.com/sarwanazhar/chatappbackend/tracing"
 )
 
-func SearchInternet(query string) string {
+// DuckDuckGo scrapes DuckDuckGo's HTML results page; no API key needed.
+type DuckDuckGo struct {
+	cfg    config.SearchConfig
+	client *http.Client
+}
+
+func NewDuckDuckGo(cfg config.SearchConfig) *DuckDuckGo {
+	client := tracing.HTTPClient()
+	client.Timeout = cfg.Timeout
+	return &DuckDuckGo{cfg: cfg, client: client}
+}
+
+// SearchInternet returns up to MaxResults "- title: snippet" lines for
+// query, or "" when the search fails or finds nothing.
+func (d *DuckDuckGo) SearchInternet(ctx context.Context, query string) string {
+	start := time.Now()
+	defer func() {
+		metrics.SearchDuration.Observe(time.Since(start).Seconds())
+	}()
+
 	searchURL := "https://duckduckgo.com/html/?q=" + url.QueryEscape(query)
 
-	client := &http.Client{Timeout: 8 * time.Second}
-	req, err := http.NewRequest("GET", searchURL, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", searchURL, nil)
 	if err != nil {
+		metrics.SearchFailures.WithLabelValues("request").Inc()
 		return ""
 	}
 	req.Header.Set("User-Agent", "Mozilla/5.0 (compatible)")
 
-	resp, err := client.Do(req)
+	resp, err := d.client.Do(req)
 	if err != nil {
+		logging.FromContext(ctx).Warn("web search failed", "error", err)
+		metrics.SearchFailures.WithLabelValues("http").Inc()
 		return ""
 	}
 	defer resp.Body.Close()
 
 	doc, err := goquery.NewDocumentFromReader(resp.Body)
 	if err != nil {
+		metrics.SearchFailures.WithLabelValues("parse").Inc()
 		return ""
 	}
 
 	var results []string
 	// DuckDuckGo structure can change — keep selector conservative.
-	// Collect up to 5 results: title + snippet
+	// Collect up to MaxResults results: title + snippet
 	doc.Find(".result__body").EachWithBreak(func(i int, s *goquery.Selection) bool {
-		if i >= 5 {
+		if i >= d.cfg.MaxResults {
 			return false
 		}
 		title := strings.TrimSpace(s.Find(".result__a").Text())
@@ -48,6 +75,7 @@ func SearchInternet(query string) string {
 	})
 
 	if len(results) == 0 {
+		metrics.SearchFailures.WithLabelValues("no_results").Inc()
 		return ""
 	}
 	// join and cap length to avoid huge tokens
@@ -0,0 +1,61 @@
+package libs
+
+import (
+	"errors"
+	"net/mail"
+	"strings"
+)
+
+// ErrInvalidEmail means a string isn't an address accounts can be
+// registered under.
+var ErrInvalidEmail = errors.New("not a valid email address")
+
+// NormalizeEmail returns the form of email that accounts store and mail:
+// trimmed and lowercased. Only a bare address is accepted, no display name,
+// comment or quoted local part, within the RFC 5321 length limits.
+func NormalizeEmail(email string) (string, error) {
+	email = strings.TrimSpace(email)
+	if len(email) > 254 {
+		return "", ErrInvalidEmail
+	}
+	// ParseAddress accepts "Name <a@b>" and friends; anything it had to
+	// rewrite wasn't a bare address
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Name != "" || addr.Address != email {
+		return "", ErrInvalidEmail
+	}
+
+	at := strings.LastIndexByte(email, '@')
+	local, domain := strings.ToLower(email[:at]), strings.ToLower(email[at+1:])
+	if len(local) > 64 || !validDomain(domain) {
+		return "", ErrInvalidEmail
+	}
+	return local + "@" + domain, nil
+}
+
+// EmailKey returns the key accounts are unique by and looked up under for
+// a normalized email. With foldPlus a "+tag" on the local part is dropped,
+// so name+shop@example.com and name@example.com are the same account; mail
+// still goes to the address as it was given.
+func EmailKey(email string, foldPlus bool) string {
+	at := strings.LastIndexByte(email, '@')
+	if i := strings.IndexByte(email, '+'); foldPlus && i > 0 && i < at {
+		return email[:i] + email[at:]
+	}
+	return email
+}
+
+// validDomain reports whether domain is a dotted host name. Address
+// literals such as [192.0.2.1] aren't accepted.
+func validDomain(domain string) bool {
+	labels := strings.Split(domain, ".")
+	if len(labels) < 2 {
+		return false
+	}
+	for _, label := range labels {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' || strings.ContainsAny(label, "[]") {
+			return false
+		}
+	}
+	return true
+}
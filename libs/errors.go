@@ -0,0 +1,106 @@
+package libs
+
+import "net/http"
+
+// ErrorCode is the machine-readable half of an error reply. Codes are part
+// of the API contract: clients switch on them, so never rename one; add a
+// new code instead.
+type ErrorCode string
+
+const (
+	CodeInvalidRequest     ErrorCode = "request.invalid"
+	CodeRouteNotFound      ErrorCode = "route.not_found"
+	CodeMethodNotAllowed   ErrorCode = "route.method_not_allowed"
+	CodeMissingToken       ErrorCode = "auth.missing_token"
+	CodeInvalidToken       ErrorCode = "auth.invalid_token"
+	CodeTokenExpired       ErrorCode = "auth.token_expired"
+	CodeTokenRevoked       ErrorCode = "auth.token_revoked"
+	CodeInvalidCredentials ErrorCode = "auth.invalid_credentials"
+	CodeAccountDisabled    ErrorCode = "auth.account_disabled"
+	CodeTooManyAttempts    ErrorCode = "auth.too_many_attempts"
+	CodePoWRequired        ErrorCode = "auth.pow_required"
+	CodePoWInvalid         ErrorCode = "auth.pow_invalid"
+	CodeEmailUnverified    ErrorCode = "auth.email_unverified"
+	CodeLinkInvalid        ErrorCode = "auth.link_invalid"
+	CodeLinkExpired        ErrorCode = "auth.link_expired"
+	CodeProviderNotFound   ErrorCode = "auth.provider_not_found"
+	CodeSSOFailed          ErrorCode = "auth.sso_failed"
+	CodeMFAChallenge       ErrorCode = "auth.mfa_challenge_invalid"
+	CodeMFACodeInvalid     ErrorCode = "auth.mfa_code_invalid"
+	CodeMFACodeRequired    ErrorCode = "auth.mfa_code_required"
+	CodeReauthRequired     ErrorCode = "auth.reauth_required"
+	CodeInsufficientScope  ErrorCode = "auth.insufficient_scope"
+	CodeSessionRequired    ErrorCode = "auth.session_required"
+	CodePermissionDenied   ErrorCode = "auth.permission_denied"
+	CodeMFAAlreadyEnabled  ErrorCode = "mfa.already_enabled"
+	CodeMFANotEnabled      ErrorCode = "mfa.not_enabled"
+	CodeUserNotFound       ErrorCode = "user.not_found"
+	CodeEmailTaken         ErrorCode = "user.email_taken"
+	CodePasswordIncorrect  ErrorCode = "user.password_incorrect"
+	CodeChatNotFound       ErrorCode = "chat.not_found"
+	CodeAPIKeyNotFound     ErrorCode = "apikey.not_found"
+	CodeAPIKeyLimit        ErrorCode = "apikey.limit_reached"
+	CodeSessionNotFound    ErrorCode = "session.not_found"
+	CodeExportNotFound     ErrorCode = "export.not_found"
+	CodeQuotaExceeded      ErrorCode = "quota.exceeded"
+	CodeLLMUnavailable     ErrorCode = "upstream.llm_unavailable"
+	CodeInternal           ErrorCode = "internal"
+)
+
+// errorStatus maps every code to the HTTP status it is sent with.
+var errorStatus = map[ErrorCode]int{
+	CodeInvalidRequest:     http.StatusBadRequest,
+	CodeRouteNotFound:      http.StatusNotFound,
+	CodeMethodNotAllowed:   http.StatusMethodNotAllowed,
+	CodeMissingToken:       http.StatusUnauthorized,
+	CodeInvalidToken:       http.StatusUnauthorized,
+	CodeTokenExpired:       http.StatusUnauthorized,
+	CodeTokenRevoked:       http.StatusUnauthorized,
+	CodeInvalidCredentials: http.StatusUnauthorized,
+	CodeAccountDisabled:    http.StatusForbidden,
+	CodeTooManyAttempts:    http.StatusTooManyRequests,
+	CodePoWRequired:        http.StatusPreconditionRequired,
+	CodePoWInvalid:         http.StatusBadRequest,
+	CodeEmailUnverified:    http.StatusForbidden,
+	CodeLinkInvalid:        http.StatusBadRequest,
+	CodeLinkExpired:        http.StatusBadRequest,
+	CodeProviderNotFound:   http.StatusNotFound,
+	CodeSSOFailed:          http.StatusBadRequest,
+	CodeMFAChallenge:       http.StatusUnauthorized,
+	CodeMFACodeInvalid:     http.StatusUnauthorized,
+	CodeMFACodeRequired:    http.StatusForbidden,
+	CodeReauthRequired:     http.StatusForbidden,
+	CodeInsufficientScope:  http.StatusForbidden,
+	CodeSessionRequired:    http.StatusForbidden,
+	CodePermissionDenied:   http.StatusForbidden,
+	CodeMFAAlreadyEnabled:  http.StatusConflict,
+	CodeMFANotEnabled:      http.StatusConflict,
+	CodeUserNotFound:       http.StatusNotFound,
+	CodeEmailTaken:         http.StatusConflict,
+	CodePasswordIncorrect:  http.StatusForbidden,
+	CodeChatNotFound:       http.StatusNotFound,
+	CodeAPIKeyNotFound:     http.StatusNotFound,
+	CodeAPIKeyLimit:        http.StatusConflict,
+	CodeSessionNotFound:    http.StatusNotFound,
+	CodeExportNotFound:     http.StatusNotFound,
+	CodeQuotaExceeded:      http.StatusTooManyRequests,
+	CodeLLMUnavailable:     http.StatusServiceUnavailable,
+	CodeInternal:           http.StatusInternalServerError,
+}
+
+// Status is the HTTP status for code; unknown codes are a 500.
+func (code ErrorCode) Status() int {
+	if status, ok := errorStatus[code]; ok {
+		return status
+	}
+	return http.StatusInternalServerError
+}
+
+// ErrorCodes lists every code, for documentation.
+func ErrorCodes() []ErrorCode {
+	codes := make([]ErrorCode, 0, len(errorStatus))
+	for code := range errorStatus {
+		codes = append(codes, code)
+	}
+	return codes
+}
@@ -0,0 +1,55 @@
+package libs
+
+import (
+	"context"
+	"errors"
+	"iter"
+
+	"github.com/sarwanazhar/chatappbackend/config"
+	"github.com/sarwanazhar/chatappbackend/tracing"
+	"google.golang.org/genai"
+)
+
+// ErrAIUnavailable is returned when no Gemini API key is configured.
+var ErrAIUnavailable = errors.New("AI API key not set")
+
+// Gemini wraps one shared genai client for search routing and chat replies.
+type Gemini struct {
+	cfg    config.AIConfig
+	client *genai.Client
+}
+
+// NewGemini creates the client up front. With no API key configured it
+// returns a Gemini whose calls fail with ErrAIUnavailable.
+func NewGemini(ctx context.Context, cfg config.AIConfig) (*Gemini, error) {
+	g := &Gemini{cfg: cfg}
+	if cfg.APIKey == "" {
+		return g, nil
+	}
+
+	client, err := genai.NewClient(ctx, &genai.ClientConfig{
+		APIKey:     cfg.APIKey,
+		Backend:    genai.BackendGeminiAPI,
+		HTTPClient: tracing.HTTPClient(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	g.client = client
+	return g, nil
+}
+
+// Model is the name of the model answering chat messages.
+func (g *Gemini) Model() string {
+	return g.cfg.ChatModel
+}
+
+// GenerateStream streams the chat model's reply to contents.
+func (g *Gemini) GenerateStream(ctx context.Context, contents []*genai.Content, cfg *genai.GenerateContentConfig) iter.Seq2[*genai.GenerateContentResponse, error] {
+	if g.client == nil {
+		return func(yield func(*genai.GenerateContentResponse, error) bool) {
+			yield(nil, ErrAIUnavailable)
+		}
+	}
+	return g.client.Models.GenerateContentStream(ctx, g.cfg.ChatModel, contents, cfg)
+}
@@ -7,22 +7,22 @@ import (
 
 // BuildGenaiContents builds the slice of contents (user/model messages) and
 // the GenerateContentConfig containing the system instruction.
-// - history: recent messages (will filter empty & last 6)
+// - history: recent messages (will filter empty & keep the last `limit`)
 // - systemInstruction: if empty, a default assistant instruction is used
-func BuildGenaiContents(history []model.Message, systemInstruction string) (
+func BuildGenaiContents(history []model.Message, systemInstruction string, limit int) (
 	contents []*genai.Content, cfg *genai.GenerateContentConfig,
 ) {
 	contents = []*genai.Content{}
 
-	// filter out empty messages and take last 6
+	// filter out empty messages and take the last `limit`
 	filtered := []model.Message{}
 	for _, m := range history {
 		if m.Content != "" {
 			filtered = append(filtered, m)
 		}
 	}
-	if len(filtered) > 6 {
-		filtered = filtered[len(filtered)-6:]
+	if len(filtered) > limit {
+		filtered = filtered[len(filtered)-limit:]
 	}
 
 	// convert each message into genai Content via genai.Text(...)
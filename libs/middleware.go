@@ -1,65 +1,136 @@
 package libs
 
 import (
-	"net/http"
+	"context"
+	"errors"
 	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/sarwanazhar/chatappbackend/config"
+	"github.com/sarwanazhar/chatappbackend/logging"
 )
 
-func JWTMiddleware() gin.HandlerFunc {
+// AuthError rejects a request with a specific code, e.g. from an Authenticator.
+type AuthError struct {
+	Code    ErrorCode
+	Message string
+}
+
+func (e *AuthError) Error() string { return e.Message }
+
+// Authenticator holds the checks that need the database. Return an
+// *AuthError to choose the response; any other error is a 500.
+type Authenticator interface {
+	// CheckToken runs after a JWT's signature and expiry have been verified
+	// and can still refuse it, e.g. because it was issued before the user's
+	// password changed.
+	CheckToken(ctx context.Context, userID string, claims jwt.MapClaims) error
+	// CheckAPIKey resolves an API key to its user and granted scopes.
+	CheckAPIKey(ctx context.Context, key string) (userID string, scopes []string, err error)
+}
+
+// JWTMiddleware authenticates the bearer token, a JWT from a login or an
+// API key, and stores the user ID as "userId". For a JWT it also stores its
+// session's ID as "sessionId"; for API keys, the granted "scopes", which
+// RequireScope checks. JWTs are verified with the key in keys named by their
+// "kid" header.
+func JWTMiddleware(cfg config.AuthConfig, keys *KeyRing, auth Authenticator) gin.HandlerFunc {
+	secret := []byte(cfg.JWTSecret)
+	methods := []string{AlgRS256, AlgEdDSA}
+	if cfg.AcceptHS256 {
+		methods = append(methods, jwt.SigningMethodHS256.Alg())
+	}
 	return func(c *gin.Context) {
 		// 1️⃣ Get Authorization header
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header missing"})
-			c.Abort()
+			RespondError(c, CodeMissingToken, "Authorization header missing")
 			return
 		}
 
 		// 2️⃣ Extract token from "Bearer <token>"
 		tokenString := strings.TrimSpace(strings.TrimPrefix(authHeader, "Bearer"))
 		if tokenString == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Token missing"})
-			c.Abort()
+			RespondError(c, CodeMissingToken, "Token missing")
 			return
 		}
 
-		// 3️⃣ Parse & validate JWT
-		token, err := jwt.Parse(tokenString, func(t *jwt.Token) (interface{}, error) {
-			// Make sure token method is HS256
-			if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, jwt.ErrTokenSignatureInvalid
+		// API keys skip the JWT steps
+		if IsAPIKey(tokenString) {
+			userID, scopes, err := auth.CheckAPIKey(c.Request.Context(), tokenString)
+			if err != nil {
+				respondAuthError(c, err)
+				return
 			}
-			return jwtSecret, nil
+			c.Set("userId", userID)
+			c.Set("scopes", scopes)
+			c.Next()
+			return
+		}
 
-		})
+		// 3️⃣ Parse & validate JWT. Every token must expire: the oldest
+		// HS256 tokens carry no exp and would otherwise never do so
+		token, err := jwt.Parse(tokenString, func(t *jwt.Token) (interface{}, error) {
+			// Tokens from before signing keys carry no kid and were signed
+			// with the secret; methods only allows HS256 while they're accepted
+			if _, ok := t.Method.(*jwt.SigningMethodHMAC); ok {
+				return secret, nil
+			}
+			return keys.VerificationKey(t)
+		}, jwt.WithValidMethods(methods), jwt.WithExpirationRequired(), jwt.WithIssuedAt())
+		if errors.Is(err, jwt.ErrTokenExpired) {
+			RespondError(c, CodeTokenExpired, "Token expired")
+			return
+		}
 		if err != nil || !token.Valid {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
-			c.Abort()
+			RespondError(c, CodeInvalidToken, "Invalid token")
 			return
 		}
 
 		// 4️⃣ Extract userId from claims
 		claims, ok := token.Claims.(jwt.MapClaims)
-		if !ok || claims["userId"] == nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
-			c.Abort()
+		if !ok || claims["userId"] == nil || !hasIssuedAt(claims) {
+			RespondError(c, CodeInvalidToken, "Invalid token claims")
 			return
 		}
 
 		userID, ok := claims["userId"].(string)
 		if !ok {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token userId"})
-			c.Abort()
+			RespondError(c, CodeInvalidToken, "Invalid token userId")
+			return
+		}
+
+		// 5️⃣ Ask the app whether the token is still honoured
+		if err := auth.CheckToken(c.Request.Context(), userID, claims); err != nil {
+			respondAuthError(c, err)
 			return
 		}
 
-		// 5️⃣ Save userId in context
+		// 6️⃣ Save userId (and the session) in context
 		c.Set("userId", userID)
+		if sessionID, ok := claims["sid"].(string); ok {
+			c.Set("sessionId", sessionID)
+		}
 
 		// ✅ Proceed to handler
 		c.Next()
 	}
 }
+
+// hasIssuedAt reports whether claims say when the token was issued, which
+// revocation by time needs.
+func hasIssuedAt(claims jwt.MapClaims) bool {
+	iat, err := claims.GetIssuedAt()
+	return err == nil && iat != nil
+}
+
+func respondAuthError(c *gin.Context, err error) {
+	var authErr *AuthError
+	if errors.As(err, &authErr) {
+		RespondError(c, authErr.Code, authErr.Message)
+		return
+	}
+	logging.FromContext(c.Request.Context()).Error("auth check failed", "error", err)
+	RespondError(c, CodeInternal, "Internal server error. Please try again later.")
+}
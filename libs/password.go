@@ -0,0 +1,121 @@
+package libs
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/sarwanazhar/chatappbackend/config"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Stored password hashes describe how they were made. argon2id uses the
+// PHC string format, $argon2id$v=19$m=19456,t=2,p=1$<salt>$<hash>, and
+// bcrypt its own, $2a$10$...; both can be checked whatever the current
+// policy is.
+
+const (
+	argon2SaltLen = 16
+	argon2KeyLen  = 32
+)
+
+// PasswordHasher hashes passwords under the configured policy and checks
+// them against hashes made under any policy.
+type PasswordHasher struct {
+	cfg config.PasswordConfig
+	// dummy has the current policy and matches no password anyone will
+	// type.
+	dummy func() string
+}
+
+func NewPasswordHasher(cfg config.PasswordConfig) *PasswordHasher {
+	h := &PasswordHasher{cfg: cfg}
+	h.dummy = sync.OnceValue(func() string {
+		hash, err := h.Hash("no account has this password")
+		if err != nil {
+			panic(err)
+		}
+		return hash
+	})
+	return h
+}
+
+// Hash hashes password under the current policy.
+func (h *PasswordHasher) Hash(password string) (string, error) {
+	if h.cfg.Algorithm == "bcrypt" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), h.cfg.BcryptCost)
+		return string(hash), err
+	}
+
+	salt := make([]byte, argon2SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	p := argon2Params{memory: uint32(h.cfg.Argon2Memory), time: uint32(h.cfg.Argon2Time), threads: uint8(h.cfg.Argon2Threads)}
+	key := argon2.IDKey([]byte(password), salt, p.time, p.memory, p.threads, argon2KeyLen)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, p.memory, p.time, p.threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// Check reports whether password matches hash, and whether hash was made
+// under a weaker policy than the current one and should be replaced by a
+// fresh Hash while the password is at hand. An empty hash (an unknown
+// email, or an account created through single sign-on) never matches but
+// still costs a full check, so response times don't reveal which emails
+// have a password.
+func (h *PasswordHasher) Check(password, hash string) (ok, rehash bool) {
+	if hash == "" {
+		h.Check(password, h.dummy())
+		return false, false
+	}
+
+	if p, salt, key, err := parseArgon2(hash); err == nil {
+		got := argon2.IDKey([]byte(password), salt, p.time, p.memory, p.threads, uint32(len(key)))
+		if subtle.ConstantTimeCompare(got, key) != 1 {
+			return false, false
+		}
+		weaker := p.memory < uint32(h.cfg.Argon2Memory) || p.time < uint32(h.cfg.Argon2Time) || len(key) < argon2KeyLen
+		return true, h.cfg.Algorithm != "argon2id" || weaker
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) != nil {
+		return false, false
+	}
+	cost, err := bcrypt.Cost([]byte(hash))
+	return true, h.cfg.Algorithm != "bcrypt" || err != nil || cost < h.cfg.BcryptCost
+}
+
+type argon2Params struct {
+	memory  uint32
+	time    uint32
+	threads uint8
+}
+
+func parseArgon2(hash string) (p argon2Params, salt, key []byte, err error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[0] != "" || parts[1] != "argon2id" {
+		return p, nil, nil, errors.New("not an argon2id hash")
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return p, nil, nil, fmt.Errorf("unsupported argon2 version %q", parts[2])
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.memory, &p.time, &p.threads); err != nil {
+		return p, nil, nil, fmt.Errorf("bad argon2 parameters %q: %w", parts[3], err)
+	}
+	if p.time < 1 || p.threads < 1 {
+		return p, nil, nil, fmt.Errorf("bad argon2 parameters %q", parts[3])
+	}
+	if salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return p, nil, nil, fmt.Errorf("bad argon2 salt: %w", err)
+	}
+	if key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil || len(key) == 0 {
+		return p, nil, nil, errors.New("bad argon2 hash")
+	}
+	return p, salt, key, nil
+}
@@ -0,0 +1,111 @@
+package libs
+
+import (
+	"testing"
+
+	"github.com/sarwanazhar/chatappbackend/config"
+)
+
+func TestParseArgon2(t *testing.T) {
+	tests := []struct {
+		name    string
+		hash    string
+		want    argon2Params
+		saltLen int
+		keyLen  int
+		wantErr bool
+	}{
+		{
+			name:    "valid",
+			hash:    "$argon2id$v=19$m=19456,t=2,p=1$c2FsdHNhbHRzYWx0c2FsdA$aGFzaGhhc2hoYXNoaGFzaGhhc2hoYXNoaGFzaGhhc2g",
+			want:    argon2Params{memory: 19456, time: 2, threads: 1},
+			saltLen: 16,
+			keyLen:  32,
+		},
+		{name: "bcrypt", hash: "$2a$10$N9qo8uLOickgx2ZMRZoMyeIjZAgcfl7p92ldGxad68LJZdL17lhWy", wantErr: true},
+		{name: "argon2i", hash: "$argon2i$v=19$m=19456,t=2,p=1$c2FsdA$aGFzaA", wantErr: true},
+		{name: "old version", hash: "$argon2id$v=16$m=19456,t=2,p=1$c2FsdA$aGFzaA", wantErr: true},
+		{name: "missing parameter", hash: "$argon2id$v=19$m=19456,t=2$c2FsdA$aGFzaA", wantErr: true},
+		{name: "zero time", hash: "$argon2id$v=19$m=19456,t=0,p=1$c2FsdA$aGFzaA", wantErr: true},
+		{name: "zero threads", hash: "$argon2id$v=19$m=19456,t=2,p=0$c2FsdA$aGFzaA", wantErr: true},
+		{name: "padded salt", hash: "$argon2id$v=19$m=19456,t=2,p=1$c2FsdA==$aGFzaA", wantErr: true},
+		{name: "empty hash", hash: "$argon2id$v=19$m=19456,t=2,p=1$c2FsdA$", wantErr: true},
+		{name: "extra field", hash: "$argon2id$v=19$m=19456,t=2,p=1$c2FsdA$aGFzaA$", wantErr: true},
+		{name: "empty", hash: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, salt, key, err := parseArgon2(tt.hash)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseArgon2(%q) = %+v, want an error", tt.hash, p)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseArgon2(%q): %v", tt.hash, err)
+			}
+			if p != tt.want || len(salt) != tt.saltLen || len(key) != tt.keyLen {
+				t.Errorf("parseArgon2(%q) = %+v with %d byte salt and %d byte key, want %+v, %d and %d",
+					tt.hash, p, len(salt), len(key), tt.want, tt.saltLen, tt.keyLen)
+			}
+		})
+	}
+}
+
+// cheapArgon2 keeps the tests fast; only the comparisons between policies
+// matter.
+var cheapArgon2 = config.PasswordConfig{Algorithm: "argon2id", Argon2Memory: 64, Argon2Time: 1, Argon2Threads: 1, BcryptCost: 4}
+
+func TestPasswordHasherCheck(t *testing.T) {
+	with := func(change func(*config.PasswordConfig)) config.PasswordConfig {
+		cfg := cheapArgon2
+		change(&cfg)
+		return cfg
+	}
+	bcrypt4 := with(func(c *config.PasswordConfig) { c.Algorithm = "bcrypt" })
+
+	tests := []struct {
+		name       string
+		hashedWith config.PasswordConfig
+		checkWith  config.PasswordConfig
+		password   string
+		wantOK     bool
+		wantRehash bool
+	}{
+		{name: "argon2id, same policy", hashedWith: cheapArgon2, checkWith: cheapArgon2, password: "secret", wantOK: true},
+		{name: "argon2id, wrong password", hashedWith: cheapArgon2, checkWith: cheapArgon2, password: "Secret"},
+		{name: "argon2id, more memory now", hashedWith: cheapArgon2, checkWith: with(func(c *config.PasswordConfig) { c.Argon2Memory = 128 }),
+			password: "secret", wantOK: true, wantRehash: true},
+		{name: "argon2id, more passes now", hashedWith: cheapArgon2, checkWith: with(func(c *config.PasswordConfig) { c.Argon2Time = 2 }),
+			password: "secret", wantOK: true, wantRehash: true},
+		{name: "argon2id, less memory now", hashedWith: with(func(c *config.PasswordConfig) { c.Argon2Memory = 128 }), checkWith: cheapArgon2,
+			password: "secret", wantOK: true},
+		{name: "argon2id, more threads now", hashedWith: cheapArgon2, checkWith: with(func(c *config.PasswordConfig) { c.Argon2Threads = 2 }),
+			password: "secret", wantOK: true},
+		{name: "argon2id, bcrypt now", hashedWith: cheapArgon2, checkWith: bcrypt4, password: "secret", wantOK: true, wantRehash: true},
+		{name: "bcrypt, same policy", hashedWith: bcrypt4, checkWith: bcrypt4, password: "secret", wantOK: true},
+		{name: "bcrypt, wrong password", hashedWith: bcrypt4, checkWith: bcrypt4, password: "Secret"},
+		{name: "bcrypt, higher cost now", hashedWith: bcrypt4, checkWith: with(func(c *config.PasswordConfig) { c.Algorithm, c.BcryptCost = "bcrypt", 5 }),
+			password: "secret", wantOK: true, wantRehash: true},
+		{name: "bcrypt, argon2id now", hashedWith: bcrypt4, checkWith: cheapArgon2, password: "secret", wantOK: true, wantRehash: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hash, err := NewPasswordHasher(tt.hashedWith).Hash("secret")
+			if err != nil {
+				t.Fatal(err)
+			}
+			ok, rehash := NewPasswordHasher(tt.checkWith).Check(tt.password, hash)
+			if ok != tt.wantOK || rehash != tt.wantRehash {
+				t.Errorf("Check(%q, %q) = %v, %v, want %v, %v", tt.password, hash, ok, rehash, tt.wantOK, tt.wantRehash)
+			}
+		})
+	}
+}
+
+func TestPasswordHasherCheckEmptyHash(t *testing.T) {
+	if ok, rehash := NewPasswordHasher(cheapArgon2).Check("", ""); ok || rehash {
+		t.Errorf("Check with no hash = %v, %v, want false, false", ok, rehash)
+	}
+}
@@ -0,0 +1,180 @@
+package libs
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/sarwanazhar/chatappbackend/config"
+)
+
+const (
+	// maxPasswordLength bounds how much a client can make the server hash.
+	maxPasswordLength = 128
+	// maxBcryptBytes is where bcrypt stops; it refuses longer passwords.
+	maxBcryptBytes = 72
+)
+
+// PasswordPolicy decides which new passwords are accepted.
+type PasswordPolicy struct {
+	minLength int
+	maxBytes  int
+	breached  *BreachedPasswords
+}
+
+func NewPasswordPolicy(cfg config.PasswordConfig) *PasswordPolicy {
+	p := &PasswordPolicy{minLength: cfg.MinLength}
+	if cfg.Algorithm == "bcrypt" {
+		p.maxBytes = maxBcryptBytes
+	}
+	if cfg.BreachedList != "" {
+		p.breached = NewBreachedPasswords(cfg.BreachedList)
+	}
+	return p
+}
+
+// Check returns what is wrong with password as the new password of the
+// account registered to email, or nil if it's acceptable. field names the
+// request field it came from. err reports a breached list that couldn't be
+// read; the password was checked on everything else, so callers may log it
+// and carry on.
+func (p *PasswordPolicy) Check(field, password, email string) (problem *FieldError, err error) {
+	length := utf8.RuneCountInString(password)
+	switch {
+	case length == 0:
+		return &FieldError{Field: field, Code: FieldRequired, Message: "Password is required"}, nil
+	case length < p.minLength:
+		return &FieldError{Field: field, Code: FieldTooShort, Message: fmt.Sprintf("Password must be at least %d characters long", p.minLength)}, nil
+	case length > maxPasswordLength:
+		return &FieldError{Field: field, Code: FieldTooLong, Message: fmt.Sprintf("Password must be at most %d characters long", maxPasswordLength)}, nil
+	case p.maxBytes > 0 && len(password) > p.maxBytes:
+		return &FieldError{Field: field, Code: FieldTooLong, Message: fmt.Sprintf("Password must be at most %d bytes long", p.maxBytes)}, nil
+	case email != "" && strings.EqualFold(password, email):
+		return &FieldError{Field: field, Code: FieldInvalid, Message: "Password must not be your email address"}, nil
+	}
+
+	if p.breached == nil {
+		return nil, nil
+	}
+	breached, err := p.breached.Contains(password)
+	if err != nil {
+		return nil, err
+	}
+	if breached {
+		return &FieldError{Field: field, Code: FieldBreached, Message: "This password has appeared in a data breach, choose another"}, nil
+	}
+	return nil, nil
+}
+
+// BreachedPasswords looks passwords up by SHA-1 hash in a local copy of
+// the Pwned Passwords list from Have I Been Pwned. The copy is either
+//
+//   - a directory of range files named after a 5 hex digit hash prefix,
+//     e.g. 21BD1.txt, each holding the "SUFFIX:COUNT" lines the k-anonymity
+//     range API returns for it (haveibeenpwned-downloader --single false),
+//   - or one file of "HASH:COUNT" lines sorted by hash, which is searched in
+//     place, so even the full list needs no memory.
+//
+// Lines with a count of 0 are the API's padding and never match.
+type BreachedPasswords struct {
+	path string
+}
+
+func NewBreachedPasswords(path string) *BreachedPasswords {
+	return &BreachedPasswords{path: path}
+}
+
+// Contains reports whether password is on the list.
+func (b *BreachedPasswords) Contains(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	info, err := os.Stat(b.path)
+	if err != nil {
+		return false, err
+	}
+	if info.IsDir() {
+		return b.inRange(hash[:5], hash[5:])
+	}
+	return b.inSorted(hash, info.Size())
+}
+
+// inRange scans the range file for prefix, which is short enough to read
+// line by line.
+func (b *BreachedPasswords) inRange(prefix, suffix string) (bool, error) {
+	f, err := os.Open(filepath.Join(b.path, prefix+".txt"))
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if key, found := breachedEntry(scanner.Text()); found && key == suffix {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
+
+// inSorted binary searches a sorted file of size bytes for hash. The
+// search narrows a byte range [lo, hi) that contains the line starting
+// with hash if there is one; lo is always the start of a line.
+func (b *BreachedPasswords) inSorted(hash string, size int64) (bool, error) {
+	f, err := os.Open(b.path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	lo, hi := int64(0), size
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		// The first line starting at or after mid
+		start := mid
+		if mid > lo {
+			r := bufio.NewReader(io.NewSectionReader(f, mid-1, size-mid+1))
+			skipped, err := r.ReadString('\n')
+			if err == io.EOF {
+				hi = mid
+				continue
+			}
+			if err != nil {
+				return false, err
+			}
+			start = mid - 1 + int64(len(skipped))
+		}
+		if start >= hi {
+			hi = mid
+			continue
+		}
+
+		line, err := bufio.NewReader(io.NewSectionReader(f, start, size-start)).ReadString('\n')
+		if err != nil && err != io.EOF {
+			return false, err
+		}
+		key, found := breachedEntry(line)
+		switch {
+		case key == hash:
+			return found, nil
+		case key < hash:
+			lo = start + int64(len(line))
+		default:
+			hi = mid
+		}
+	}
+	return false, nil
+}
+
+// breachedEntry splits a "HASH:COUNT" line, reporting whether it counts as
+// a breach.
+func breachedEntry(line string) (key string, found bool) {
+	key, count, _ := strings.Cut(strings.TrimSpace(line), ":")
+	return strings.ToUpper(key), count != "0"
+}
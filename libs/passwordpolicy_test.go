@@ -0,0 +1,108 @@
+package libs
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// writeSortedList writes a sorted "HASH:COUNT" file of the SHA-1 hashes of
+// "0" to "n-1" with a count of 1, plus extra lines, ending lines with eol.
+func writeSortedList(t *testing.T, n int, extra []string, eol string) (path string, hashes []string) {
+	t.Helper()
+	for i := range n {
+		sum := sha1.Sum([]byte(strconv.Itoa(i)))
+		hashes = append(hashes, strings.ToUpper(hex.EncodeToString(sum[:])))
+	}
+	lines := slices.Clone(extra)
+	for _, h := range hashes {
+		lines = append(lines, h+":1")
+	}
+	slices.Sort(lines)
+	path = filepath.Join(t.TempDir(), "pwned.txt")
+	if err := os.WriteFile(path, []byte(strings.Join(lines, eol)+eol), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(hashes)
+	return path, hashes
+}
+
+func TestBreachedPasswordsInSorted(t *testing.T) {
+	const padding = "8000000000000000000000000000000000000000"
+	for _, eol := range []string{"\n", "\r\n"} {
+		path, hashes := writeSortedList(t, 500, []string{padding + ":0"}, eol)
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		tests := []struct {
+			name string
+			hash string
+			want bool
+		}{
+			{name: "first line", hash: hashes[0], want: true},
+			{name: "last line", hash: hashes[len(hashes)-1], want: true},
+			{name: "middle", hash: hashes[250], want: true},
+			{name: "next to the middle", hash: hashes[251], want: true},
+			{name: "before the first line", hash: "0000000000000000000000000000000000000000"},
+			{name: "after the last line", hash: "FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF"},
+			{name: "one digit off a line", hash: hashes[100][:39] + nextHexDigit(hashes[100][39])},
+			{name: "padding with a count of 0", hash: padding},
+		}
+		for _, tt := range tests {
+			t.Run(strconv.Quote(eol)+"/"+tt.name, func(t *testing.T) {
+				got, err := NewBreachedPasswords(path).inSorted(tt.hash, info.Size())
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got != tt.want {
+					t.Errorf("inSorted(%s) = %v, want %v", tt.hash, got, tt.want)
+				}
+			})
+		}
+	}
+}
+
+// TestBreachedPasswordsInSortedEveryLine searches a small file for each of
+// its lines, which walks every path through the search.
+func TestBreachedPasswordsInSortedEveryLine(t *testing.T) {
+	for n := range 8 {
+		path, hashes := writeSortedList(t, n, nil, "\n")
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, h := range hashes {
+			if got, err := NewBreachedPasswords(path).inSorted(h, info.Size()); err != nil || !got {
+				t.Errorf("%d lines: inSorted(%s) = %v, %v, want true", n, h, got, err)
+			}
+		}
+	}
+}
+
+func TestBreachedPasswordsContains(t *testing.T) {
+	// SHA-1 of "password"
+	path, _ := writeSortedList(t, 50, []string{"5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8:10437277"}, "\n")
+	breached := NewBreachedPasswords(path)
+	for password, want := range map[string]bool{"password": true, "not on the list": false} {
+		got, err := breached.Contains(password)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("Contains(%q) = %v, want %v", password, got, want)
+		}
+	}
+}
+
+// nextHexDigit is the hex digit after d, wrapping F to 0.
+func nextHexDigit(d byte) string {
+	const digits = "0123456789ABCDEF"
+	return string(digits[(strings.IndexByte(digits, d)+1)%16])
+}
@@ -0,0 +1,101 @@
+package libs
+
+import (
+	"crypto/sha256"
+	"errors"
+	"math/bits"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Proof-of-work challenges are link tokens whose subject is the difficulty,
+// so the client can't lower it. A solution is any string s for which
+// SHA-256(challenge + s) starts with difficulty zero bits.
+
+// PoWPurpose tags challenge tokens and their single-use records.
+const PoWPurpose = "pow"
+
+// ErrPoWUnsolved means the solution doesn't meet the challenge's difficulty.
+var ErrPoWUnsolved = errors.New("proof of work unsolved")
+
+// NewPoWChallenge issues a challenge at difficulty.
+func NewPoWChallenge(secret string, difficulty int, ttl time.Duration) (string, LinkToken, error) {
+	return SignLinkToken(secret, PoWPurpose, strconv.Itoa(difficulty), ttl)
+}
+
+// VerifyPoW checks that challenge is genuine and unexpired and that
+// solution solves it. Single use is up to the caller.
+func VerifyPoW(secret, challenge, solution string) (LinkToken, error) {
+	token, err := ParseLinkToken(secret, PoWPurpose, challenge)
+	if err != nil {
+		return LinkToken{}, err
+	}
+	difficulty, err := strconv.Atoi(token.Subject)
+	if err != nil {
+		return LinkToken{}, ErrLinkTokenInvalid
+	}
+	sum := sha256.Sum256([]byte(challenge + solution))
+	if leadingZeroBits(sum[:]) < difficulty {
+		return LinkToken{}, ErrPoWUnsolved
+	}
+	return token, nil
+}
+
+func leadingZeroBits(b []byte) int {
+	n := 0
+	for _, c := range b {
+		if c != 0 {
+			return n + bits.LeadingZeros8(c)
+		}
+		n += 8
+	}
+	return n
+}
+
+// LoadMeter estimates how many events happened in the last window, by
+// blending the previous fixed window into the current one.
+type LoadMeter struct {
+	mu       sync.Mutex
+	window   time.Duration
+	start    time.Time
+	current  int
+	previous int
+}
+
+// NewLoadMeter returns a meter counting over window.
+func NewLoadMeter(window time.Duration) *LoadMeter {
+	return &LoadMeter{window: window, start: time.Now()}
+}
+
+// Add counts one event.
+func (m *LoadMeter) Add() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.roll(time.Now())
+	m.current++
+}
+
+// Rate is the estimated number of events in the last window.
+func (m *LoadMeter) Rate() float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	m.roll(now)
+	elapsed := float64(now.Sub(m.start)) / float64(m.window)
+	return float64(m.previous)*(1-elapsed) + float64(m.current)
+}
+
+func (m *LoadMeter) roll(now time.Time) {
+	passed := now.Sub(m.start) / m.window
+	switch {
+	case passed == 0:
+		return
+	case passed == 1:
+		m.previous = m.current
+	default:
+		m.previous = 0
+	}
+	m.current = 0
+	m.start = m.start.Add(passed * m.window)
+}
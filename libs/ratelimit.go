@@ -0,0 +1,65 @@
+package libs
+
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// RateLimiter gives every key (a client IP) a token bucket of requests per
+// window. A bucket left alone for a whole window has refilled, so it is
+// forgotten then: remembering it wouldn't change any answer, and the map
+// only holds clients seen in the last window or two.
+type RateLimiter struct {
+	limit  rate.Limit
+	burst  int
+	window time.Duration
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+func NewRateLimiter(requests int, window time.Duration) *RateLimiter {
+	return &RateLimiter{
+		limit:     rate.Limit(float64(requests) / window.Seconds()),
+		burst:     requests,
+		window:    window,
+		buckets:   make(map[string]*bucket),
+		lastSweep: time.Now(),
+	}
+}
+
+// Allow takes a token from key's bucket, reporting whether there was one.
+func (l *RateLimiter) Allow(key string) bool {
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastSweep) >= l.window {
+		l.sweep(now)
+	}
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{limiter: rate.NewLimiter(l.limit, l.burst)}
+		l.buckets[key] = b
+	}
+	b.lastSeen = now
+	return b.limiter.AllowN(now, 1)
+}
+
+// sweep forgets the buckets idle for at least a window.
+func (l *RateLimiter) sweep(now time.Time) {
+	for key, b := range l.buckets {
+		if now.Sub(b.lastSeen) >= l.window {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastSweep = now
+}
@@ -0,0 +1,33 @@
+package libs
+
+import (
+	"slices"
+
+	"github.com/sarwanazhar/chatappbackend/model"
+)
+
+// Permissions guard the admin API. Unlike scopes, which narrow what a
+// credential can do, they come from the user's role.
+const (
+	PermUsersRead    = "users:read"
+	PermUsersDisable = "users:disable"
+	PermUsersDelete  = "users:delete"
+	PermUsersRole    = "users:role"
+	PermUsageRead    = "usage:read"
+)
+
+// rolePermissions lists what each role may do. Plain users have none.
+var rolePermissions = map[string][]string{
+	model.RoleSupport: {PermUsersRead, PermUsersDisable, PermUsageRead},
+	model.RoleAdmin:   {PermUsersRead, PermUsersDisable, PermUsersDelete, PermUsersRole, PermUsageRead},
+}
+
+// HasPermission reports whether role grants perm.
+func HasPermission(role, perm string) bool {
+	return slices.Contains(rolePermissions[role], perm)
+}
+
+// IsStaff reports whether role has any admin permissions.
+func IsStaff(role string) bool {
+	return len(rolePermissions[role]) > 0
+}
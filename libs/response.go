@@ -0,0 +1,55 @@
+package libs
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/chatappbackend/logging"
+)
+
+// ErrorResponse is the body of every error reply and the data of every
+// streamed error event. Error keeps the human-readable message under the
+// key clients already read; Code is what they should switch on.
+type ErrorResponse struct {
+	Code      ErrorCode `json:"code"`
+	Error     string    `json:"error"`
+	RequestID string    `json:"requestId"`
+	// Fields says what is wrong with each offending request field, when
+	// the request was rejected for its content.
+	Fields []FieldError `json:"fields,omitempty"`
+}
+
+// FieldError is one problem with one request field. Field is the JSON name,
+// dotted for nested fields; Code is one of the Field* constants.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Field error codes.
+const (
+	FieldRequired = "required"
+	FieldInvalid  = "invalid"
+	FieldTooShort = "too_short"
+	FieldTooLong  = "too_long"
+	FieldBreached = "breached"
+)
+
+// NewErrorResponse builds the error body for the current request.
+func NewErrorResponse(c *gin.Context, code ErrorCode, message string) ErrorResponse {
+	return ErrorResponse{Code: code, Error: message, RequestID: logging.GetRequestID(c)}
+}
+
+// RespondError aborts the request with the status belonging to code and
+// {"code", "error": message, "requestId"} so clients can quote the ID when
+// reporting a problem.
+func RespondError(c *gin.Context, code ErrorCode, message string) {
+	c.AbortWithStatusJSON(code.Status(), NewErrorResponse(c, code, message))
+}
+
+// RespondInvalid aborts the request with request.invalid, message and the
+// problems with each field.
+func RespondInvalid(c *gin.Context, message string, fields ...FieldError) {
+	body := NewErrorResponse(c, CodeInvalidRequest, message)
+	body.Fields = fields
+	c.AbortWithStatusJSON(CodeInvalidRequest.Status(), body)
+}
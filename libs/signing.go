@@ -0,0 +1,240 @@
+package libs
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/sarwanazhar/chatappbackend/model"
+)
+
+// Access tokens are signed with asymmetric keys, so other services can
+// verify them with the public keys from /.well-known/jwks.json without
+// holding any secret. A token's "kid" header names the key that signed it.
+
+// Access token signature algorithms.
+const (
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+)
+
+// signingKeyLabel separates sealed signing keys from other sealed secrets.
+const signingKeyLabel = "signing-key"
+
+var (
+	// ErrNoSigningKey means no loaded key is due to sign yet.
+	ErrNoSigningKey = errors.New("no signing key")
+	// ErrUnknownSigningKey means a token names a key the ring doesn't hold,
+	// or claims a different algorithm than the key's.
+	ErrUnknownSigningKey = errors.New("unknown signing key")
+)
+
+// NewSigningKey generates a key pair for algorithm that signs from
+// signFrom and stays published until expiresAt. Its private half is sealed
+// with jwtSecret; its ID is the RFC 7638 thumbprint of the public half.
+func NewSigningKey(jwtSecret, algorithm string, signFrom, expiresAt time.Time) (*model.SigningKey, error) {
+	var private crypto.Signer
+	var err error
+	switch algorithm {
+	case AlgRS256:
+		private, err = rsa.GenerateKey(rand.Reader, 2048)
+	case AlgEdDSA:
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm %q", algorithm)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := seal(jwtSecret, signingKeyLabel, der)
+	if err != nil {
+		return nil, err
+	}
+	public, err := x509.MarshalPKIXPublicKey(private.Public())
+	if err != nil {
+		return nil, err
+	}
+	jwk, err := newJWK(private.Public(), algorithm, "")
+	if err != nil {
+		return nil, err
+	}
+	return &model.SigningKey{
+		ID:         jwk.thumbprint(),
+		Algorithm:  algorithm,
+		PrivateKey: sealed,
+		PublicKey:  public,
+		SignFrom:   signFrom,
+		ExpiresAt:  expiresAt,
+	}, nil
+}
+
+// JWK is a public key in JSON Web Key form (RFC 7517).
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	// N and E are an RSA key's modulus and exponent.
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Crv and X are an Ed25519 key's curve and public point.
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKSet is the document served at /.well-known/jwks.json.
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+func newJWK(public crypto.PublicKey, algorithm, kid string) (JWK, error) {
+	jwk := JWK{Use: "sig", Alg: algorithm, Kid: kid}
+	switch public := public.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(public)
+	default:
+		return JWK{}, fmt.Errorf("unsupported public key type %T", public)
+	}
+	return jwk, nil
+}
+
+// thumbprint hashes the key's required members in lexical order, per
+// RFC 7638, so a key's ID follows from the key itself.
+func (k JWK) thumbprint() string {
+	var members string
+	switch k.Kty {
+	case "RSA":
+		members = fmt.Sprintf(`{"e":%q,"kty":"RSA","n":%q}`, k.E, k.N)
+	case "OKP":
+		members = fmt.Sprintf(`{"crv":%q,"kty":"OKP","x":%q}`, k.Crv, k.X)
+	}
+	sum := sha256.Sum256([]byte(members))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// KeyRing holds the current signing keys for the token signer, the JWT
+// middleware and the JWKS endpoint. Load replaces them as keys rotate.
+type KeyRing struct {
+	mu sync.RWMutex
+	// keys are ordered by signFrom, latest first.
+	keys []ringKey
+}
+
+type ringKey struct {
+	id        string
+	method    jwt.SigningMethod
+	private   crypto.Signer
+	jwk       JWK
+	signFrom  time.Time
+	expiresAt time.Time
+}
+
+// NewKeyRing returns an empty ring; nothing signs or verifies until Load.
+func NewKeyRing() *KeyRing {
+	return &KeyRing{}
+}
+
+// Load replaces the ring's keys, opening each private half with jwtSecret.
+// Keys sealed with another secret fail the whole load, since the ring
+// would otherwise be missing keys that tokens in circulation name.
+func (r *KeyRing) Load(jwtSecret string, keys []model.SigningKey) error {
+	loaded := make([]ringKey, 0, len(keys))
+	for _, k := range keys {
+		der, err := unseal(jwtSecret, signingKeyLabel, k.PrivateKey)
+		if err != nil {
+			return fmt.Errorf("signing key %s: %w", k.ID, err)
+		}
+		parsed, err := x509.ParsePKCS8PrivateKey(der)
+		if err != nil {
+			return fmt.Errorf("signing key %s: %w", k.ID, err)
+		}
+		private, ok := parsed.(crypto.Signer)
+		method := jwt.GetSigningMethod(k.Algorithm)
+		if !ok || method == nil {
+			return fmt.Errorf("signing key %s: unsupported algorithm %q", k.ID, k.Algorithm)
+		}
+		jwk, err := newJWK(private.Public(), k.Algorithm, k.ID)
+		if err != nil {
+			return fmt.Errorf("signing key %s: %w", k.ID, err)
+		}
+		loaded = append(loaded, ringKey{
+			id:        k.ID,
+			method:    method,
+			private:   private,
+			jwk:       jwk,
+			signFrom:  k.SignFrom,
+			expiresAt: k.ExpiresAt,
+		})
+	}
+	sort.Slice(loaded, func(i, j int) bool { return loaded[i].signFrom.After(loaded[j].signFrom) })
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.keys = loaded
+	return nil
+}
+
+// Sign signs claims with the latest key due to sign, naming it in the
+// token's "kid" header.
+func (r *KeyRing) Sign(claims jwt.Claims) (string, error) {
+	now := time.Now()
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, k := range r.keys {
+		if k.signFrom.After(now) || !k.expiresAt.After(now) {
+			continue
+		}
+		token := jwt.NewWithClaims(k.method, claims)
+		token.Header["kid"] = k.id
+		return token.SignedString(k.private)
+	}
+	return "", ErrNoSigningKey
+}
+
+// VerificationKey is a jwt.Keyfunc: it returns the public key named by the
+// token's "kid", provided the token claims that key's algorithm.
+func (r *KeyRing) VerificationKey(t *jwt.Token) (any, error) {
+	kid, _ := t.Header["kid"].(string)
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, k := range r.keys {
+		if k.id == kid && t.Method.Alg() == k.method.Alg() {
+			return k.private.Public(), nil
+		}
+	}
+	return nil, ErrUnknownSigningKey
+}
+
+// JWKS returns the public half of every key in the ring, including keys
+// that don't sign yet, so verifiers learn them ahead of time.
+func (r *KeyRing) JWKS() JWKSet {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	set := JWKSet{Keys: make([]JWK, len(r.keys))}
+	for i, k := range r.keys {
+		set.Keys[i] = k.jwk
+	}
+	return set
+}
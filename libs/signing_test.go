@@ -0,0 +1,123 @@
+package libs
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/sarwanazhar/chatappbackend/model"
+)
+
+func TestJWKThumbprint(t *testing.T) {
+	tests := []struct {
+		name string
+		jwk  JWK
+		want string
+	}{
+		{
+			// RFC 7638 section 3.1
+			name: "RSA",
+			jwk: JWK{
+				Kty: "RSA",
+				N:   "0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw",
+				E:   "AQAB",
+				// Members outside the thumbprint don't change it
+				Use: "sig", Alg: AlgRS256, Kid: "2011-04-29",
+			},
+			want: "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs",
+		},
+		{
+			// RFC 8037 appendix A.3
+			name: "Ed25519",
+			jwk:  JWK{Kty: "OKP", Crv: "Ed25519", X: "11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo"},
+			want: "kPrK_qmxVWaYVA9wwBF6Iuo3vVzz7TxHCTwXBygrS4k",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.jwk.thumbprint(); got != tt.want {
+				t.Errorf("thumbprint() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKeyRing(t *testing.T) {
+	const secret = "jwt secret"
+	now := time.Now()
+	for _, alg := range []string{AlgRS256, AlgEdDSA} {
+		t.Run(alg, func(t *testing.T) {
+			key, err := NewSigningKey(secret, alg, now.Add(-time.Minute), now.Add(time.Hour))
+			if err != nil {
+				t.Fatal(err)
+			}
+			ring := NewKeyRing()
+			if err := ring.Load(secret, []model.SigningKey{*key}); err != nil {
+				t.Fatal(err)
+			}
+
+			jwks := ring.JWKS()
+			if len(jwks.Keys) != 1 {
+				t.Fatalf("JWKS has %d keys, want 1", len(jwks.Keys))
+			}
+			if jwk := jwks.Keys[0]; jwk.Kid != key.ID || jwk.thumbprint() != key.ID || jwk.Alg != alg {
+				t.Errorf("JWKS key %+v, want kid and thumbprint %s and alg %s", jwk, key.ID, alg)
+			}
+
+			signed, err := ring.Sign(jwt.MapClaims{"sub": "user"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			token, err := jwt.Parse(signed, ring.VerificationKey, jwt.WithValidMethods([]string{alg}))
+			if err != nil || token.Header["kid"] != key.ID {
+				t.Errorf("parsing a signed token: kid %v, %v", token.Header["kid"], err)
+			}
+
+			if err := NewKeyRing().Load("another secret", []model.SigningKey{*key}); err == nil {
+				t.Error("Load with another JWT secret succeeded")
+			}
+		})
+	}
+}
+
+func TestKeyRingSignsWithLatestDueKey(t *testing.T) {
+	const secret = "jwt secret"
+	now := time.Now()
+	var keys []model.SigningKey
+	for _, window := range []struct{ from, until time.Duration }{
+		{-2 * time.Hour, -time.Hour}, // expired
+		{-time.Hour, time.Hour},      // due
+		{-time.Minute, time.Hour},    // due, newer
+		{time.Hour, 2 * time.Hour},   // not due yet
+	} {
+		key, err := NewSigningKey(secret, AlgEdDSA, now.Add(window.from), now.Add(window.until))
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, *key)
+	}
+	ring := NewKeyRing()
+	if err := ring.Load(secret, keys); err != nil {
+		t.Fatal(err)
+	}
+
+	signed, err := ring.Sign(jwt.MapClaims{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, _, err := jwt.NewParser().ParseUnverified(signed, jwt.MapClaims{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kid := token.Header["kid"]; kid != keys[2].ID {
+		t.Errorf("signed with %v, want the newest due key %s", kid, keys[2].ID)
+	}
+	if len(ring.JWKS().Keys) != len(keys) {
+		t.Errorf("JWKS has %d keys, want all %d", len(ring.JWKS().Keys), len(keys))
+	}
+
+	if _, err := NewKeyRing().Sign(jwt.MapClaims{}); !errors.Is(err, ErrNoSigningKey) {
+		t.Errorf("Sign with an empty ring = %v, want ErrNoSigningKey", err)
+	}
+}
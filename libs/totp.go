@@ -0,0 +1,160 @@
+package libs
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// TOTP follows RFC 6238 with the parameters every authenticator app
+// supports: HMAC-SHA1, 6 digits, 30 second steps.
+const (
+	totpDigits = 6
+	totpPeriod = 30
+	// totpSkew accepts codes one step either side of now for clock drift
+	totpSkew = 1
+)
+
+var b32 = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// NewTOTPSecret returns a random 160-bit seed in the base32 form
+// authenticator apps expect.
+func NewTOTPSecret() (string, error) {
+	seed := make([]byte, 20)
+	if _, err := rand.Read(seed); err != nil {
+		return "", err
+	}
+	return b32.EncodeToString(seed), nil
+}
+
+// TOTPURI is the otpauth:// URI shown as a QR code during enrollment.
+func TOTPURI(issuer, account, secret string) string {
+	q := url.Values{}
+	q.Set("secret", secret)
+	q.Set("issuer", issuer)
+	q.Set("algorithm", "SHA1")
+	q.Set("digits", fmt.Sprint(totpDigits))
+	q.Set("period", fmt.Sprint(totpPeriod))
+	label := url.PathEscape(issuer) + ":" + url.PathEscape(account)
+	return "otpauth://totp/" + label + "?" + q.Encode()
+}
+
+// ValidateTOTP checks code against secret at now and returns the time step
+// it matched, so callers can refuse a code that was already used.
+func ValidateTOTP(secret, code string, now time.Time) (int64, bool) {
+	seed, err := b32.DecodeString(strings.ToUpper(secret))
+	code = strings.ReplaceAll(code, " ", "")
+	if err != nil || len(code) != totpDigits {
+		return 0, false
+	}
+	current := now.Unix() / totpPeriod
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if subtle.ConstantTimeCompare([]byte(totpCode(seed, step)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+func totpCode(seed []byte, step int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+	mac := hmac.New(sha1.New, seed)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%1_000_000)
+}
+
+// NewRecoveryCodes returns n one-time codes like "abcd-efgh-ijkl-mnop".
+// Each carries 80 random bits, enough that a plain SHA-256 of it is a safe
+// thing to store.
+func NewRecoveryCodes(n int) ([]string, error) {
+	codes := make([]string, n)
+	for i := range codes {
+		raw := make([]byte, 10)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, err
+		}
+		s := strings.ToLower(b32.EncodeToString(raw))
+		codes[i] = s[0:4] + "-" + s[4:8] + "-" + s[8:12] + "-" + s[12:16]
+	}
+	return codes, nil
+}
+
+// HashRecoveryCode is what gets stored for a recovery code. Case, spaces
+// and dashes don't matter when the user types it back.
+func HashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+var ErrSealedSecretInvalid = errors.New("sealed secret invalid")
+
+// SealTOTPSecret encrypts a TOTP seed for storage so a database leak alone
+// doesn't let anyone generate codes. The key is derived from the JWT
+// secret, so rotating JWT_SECRET invalidates enrolled authenticators.
+func SealTOTPSecret(jwtSecret, secret string) (string, error) {
+	return seal(jwtSecret, "totp-secret", []byte(secret))
+}
+
+// OpenTOTPSecret reverses SealTOTPSecret.
+func OpenTOTPSecret(jwtSecret, sealed string) (string, error) {
+	plain, err := unseal(jwtSecret, "totp-secret", sealed)
+	return string(plain), err
+}
+
+// seal encrypts plain with a key derived from the JWT secret and label, so
+// secrets sealed for one use can't be opened as another.
+func seal(jwtSecret, label string, plain []byte) (string, error) {
+	aead, err := sealingAEAD(jwtSecret, label)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(aead.Seal(nonce, nonce, plain, nil)), nil
+}
+
+func unseal(jwtSecret, label, sealed string) ([]byte, error) {
+	aead, err := sealingAEAD(jwtSecret, label)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(sealed)
+	if err != nil || len(raw) < aead.NonceSize() {
+		return nil, ErrSealedSecretInvalid
+	}
+	plain, err := aead.Open(nil, raw[:aead.NonceSize()], raw[aead.NonceSize():], nil)
+	if err != nil {
+		return nil, ErrSealedSecretInvalid
+	}
+	return plain, nil
+}
+
+func sealingAEAD(jwtSecret, label string) (cipher.AEAD, error) {
+	key := hmac.New(sha256.New, []byte(jwtSecret))
+	key.Write([]byte(label))
+	block, err := aes.NewCipher(key.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
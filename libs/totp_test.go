@@ -0,0 +1,76 @@
+package libs
+
+import (
+	"testing"
+	"time"
+)
+
+// rfc6238Seed is the SHA-1 seed of the RFC 6238 appendix B test vectors.
+var rfc6238Seed = []byte("12345678901234567890")
+
+func TestTOTPCodeRFC6238(t *testing.T) {
+	// RFC 6238 appendix B gives 8 digits; 6-digit codes are the last six
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},          // 94287082
+		{1111111109, "081804"},  // 07081804
+		{1111111111, "050471"},  // 14050471
+		{1234567890, "005924"},  // 89005924
+		{2000000000, "279037"},  // 69279037
+		{20000000000, "353130"}, // 65353130
+	}
+	for _, tt := range tests {
+		if got := totpCode(rfc6238Seed, tt.unix/totpPeriod); got != tt.want {
+			t.Errorf("totpCode at %d = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	secret := b32.EncodeToString(rfc6238Seed)
+	now := time.Unix(1111111111, 0)
+	step := now.Unix() / totpPeriod
+
+	tests := []struct {
+		name     string
+		secret   string
+		code     string
+		wantStep int64
+		wantOK   bool
+	}{
+		{name: "current step", secret: secret, code: "050471", wantStep: step, wantOK: true},
+		{name: "spaces", secret: secret, code: "050 471", wantStep: step, wantOK: true},
+		{name: "lowercase secret", secret: "gezdgnbvgy3tqojqgezdgnbvgy3tqojq", code: "050471", wantStep: step, wantOK: true},
+		{name: "previous step", secret: secret, code: totpCode(rfc6238Seed, step-1), wantStep: step - 1, wantOK: true},
+		{name: "next step", secret: secret, code: totpCode(rfc6238Seed, step+1), wantStep: step + 1, wantOK: true},
+		{name: "two steps ago", secret: secret, code: totpCode(rfc6238Seed, step-2)},
+		{name: "two steps ahead", secret: secret, code: totpCode(rfc6238Seed, step+2)},
+		{name: "wrong code", secret: secret, code: "050472"},
+		{name: "eight digits", secret: secret, code: "14050471"},
+		{name: "empty code", secret: secret, code: ""},
+		{name: "bad secret", secret: "not base32!", code: "050471"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotStep, ok := ValidateTOTP(tt.secret, tt.code, now)
+			if ok != tt.wantOK || gotStep != tt.wantStep {
+				t.Errorf("ValidateTOTP(%q) = %d, %v, want %d, %v", tt.code, gotStep, ok, tt.wantStep, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestSealTOTPSecret(t *testing.T) {
+	sealed, err := SealTOTPSecret("jwt secret", "GEZDGNBVGY3TQOJQ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := OpenTOTPSecret("jwt secret", sealed); err != nil || got != "GEZDGNBVGY3TQOJQ" {
+		t.Errorf("OpenTOTPSecret = %q, %v, want the sealed secret", got, err)
+	}
+	if _, err := OpenTOTPSecret("another secret", sealed); err == nil {
+		t.Error("OpenTOTPSecret with another JWT secret succeeded")
+	}
+}
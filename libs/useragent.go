@@ -0,0 +1,52 @@
+package libs
+
+import "strings"
+
+// uaBrowsers and uaSystems are checked in order, so tokens that other
+// agents also send (Chrome's "Safari", Edge's "Chrome") come after them.
+var (
+	uaBrowsers = []struct{ token, name string }{
+		{"Edg/", "Edge"},
+		{"OPR/", "Opera"},
+		{"Firefox/", "Firefox"},
+		{"Chrome/", "Chrome"},
+		{"Safari/", "Safari"},
+		{"curl/", "curl"},
+	}
+	uaSystems = []struct{ token, name string }{
+		{"Android", "Android"},
+		{"iPhone", "iOS"},
+		{"iPad", "iPadOS"},
+		{"Windows", "Windows"},
+		{"Mac OS X", "macOS"},
+		{"CrOS", "ChromeOS"},
+		{"Linux", "Linux"},
+	}
+)
+
+// DescribeUserAgent names the browser and system in a User-Agent header,
+// e.g. "Firefox on Windows", for listing sessions. It is a best guess and
+// returns "Unknown device" when nothing matches.
+func DescribeUserAgent(ua string) string {
+	browser := uaMatch(ua, uaBrowsers)
+	system := uaMatch(ua, uaSystems)
+	switch {
+	case browser != "" && system != "":
+		return browser + " on " + system
+	case browser != "":
+		return browser
+	case system != "":
+		return system
+	default:
+		return "Unknown device"
+	}
+}
+
+func uaMatch(ua string, candidates []struct{ token, name string }) string {
+	for _, c := range candidates {
+		if strings.Contains(ua, c.token) {
+			return c.name
+		}
+	}
+	return ""
+}
@@ -0,0 +1,48 @@
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+)
+
+// Options controls how the root logger is built.
+type Options struct {
+	Level  slog.Level
+	Format string // "json" (default) or "text"
+	// Redact masks emails and drops passwords, tokens and prompt contents.
+	// It is on unless explicitly disabled for local debugging.
+	Redact bool
+}
+
+// New builds a logger writing to w.
+func New(w io.Writer, opts Options) *slog.Logger {
+	handlerOpts := &slog.HandlerOptions{Level: opts.Level}
+	if opts.Redact {
+		handlerOpts.ReplaceAttr = redact
+	}
+
+	var handler slog.Handler
+	if opts.Format == "text" {
+		handler = slog.NewTextHandler(w, handlerOpts)
+	} else {
+		handler = slog.NewJSONHandler(w, handlerOpts)
+	}
+	return slog.New(handler)
+}
+
+type ctxKey struct{}
+
+// WithContext returns a copy of ctx carrying logger.
+func WithContext(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, ctxKey{}, logger)
+}
+
+// FromContext returns the request-scoped logger, or the default logger when
+// ctx has none.
+func FromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(ctxKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
@@ -0,0 +1,46 @@
+package logging
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// Attribute keys whose values never reach the logs verbatim.
+var (
+	secretKeys = map[string]bool{
+		"password":      true,
+		"token":         true,
+		"authorization": true,
+	}
+	contentKeys = map[string]bool{
+		"prompt":             true,
+		"content":            true,
+		"system_instruction": true,
+		"search_context":     true,
+		"response":           true,
+	}
+)
+
+func redact(_ []string, a slog.Attr) slog.Attr {
+	key := strings.ToLower(a.Key)
+	switch {
+	case key == "email":
+		return slog.String(a.Key, MaskEmail(a.Value.String()))
+	case secretKeys[key]:
+		return slog.String(a.Key, "[REDACTED]")
+	case contentKeys[key]:
+		return slog.String(a.Key, fmt.Sprintf("[REDACTED len=%d]", len(a.Value.String())))
+	}
+	return a
+}
+
+// MaskEmail keeps the first character of the local part and the domain,
+// e.g. "jane.doe@example.com" becomes "j***@example.com".
+func MaskEmail(email string) string {
+	at := strings.LastIndex(email, "@")
+	if at <= 0 {
+		return "[REDACTED]"
+	}
+	return email[:1] + "***" + email[at:]
+}
@@ -0,0 +1,38 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// File writes each message to its own .eml file, which any mail client can
+// open. Meant for development and tests.
+type File struct {
+	dir  string
+	from *mail.Address
+}
+
+func (f *File) Send(_ context.Context, msg Message) error {
+	if err := os.MkdirAll(f.dir, 0o700); err != nil {
+		return err
+	}
+	name := filepath.Join(f.dir, fmt.Sprintf("%s.eml", time.Now().UTC().Format("20060102T150405.000000000")))
+	return os.WriteFile(name, render(f.from, msg), 0o600)
+}
+
+// Log writes messages to the application log instead of sending them. The
+// body is logged unredacted so links can be copied out during development;
+// never use it in production.
+type Log struct {
+	logger *slog.Logger
+}
+
+func (l *Log) Send(ctx context.Context, msg Message) error {
+	l.logger.InfoContext(ctx, "📧 mail not sent (log driver)", "to", msg.To, "subject", msg.Subject, "body", msg.Text)
+	return nil
+}
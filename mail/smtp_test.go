@@ -0,0 +1,155 @@
+package mail
+
+import (
+	"context"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sarwanazhar/chatappbackend/config"
+)
+
+// sink is an SMTP server that takes one connection and records the message
+// sent over it.
+type sink struct {
+	addr string
+	// reject answers RCPT TO with a permanent failure.
+	reject bool
+	got    chan received
+}
+
+type received struct {
+	from, to string
+	lines    []string
+}
+
+func newSink(t *testing.T, reject bool) *sink {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	s := &sink{addr: l.Addr().String(), reject: reject, got: make(chan received, 1)}
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		s.serve(textproto.NewConn(conn))
+	}()
+	return s
+}
+
+func (s *sink) serve(c *textproto.Conn) {
+	var msg received
+	_ = c.PrintfLine("220 sink ready")
+	for {
+		line, err := c.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			_ = c.PrintfLine("250 sink")
+		case "MAIL":
+			msg.from = arg
+			_ = c.PrintfLine("250 ok")
+		case "RCPT":
+			if s.reject {
+				_ = c.PrintfLine("550 no such user")
+				continue
+			}
+			msg.to = arg
+			_ = c.PrintfLine("250 ok")
+		case "DATA":
+			_ = c.PrintfLine("354 go ahead")
+			if msg.lines, err = c.ReadDotLines(); err != nil {
+				return
+			}
+			_ = c.PrintfLine("250 queued")
+			s.got <- msg
+		case "QUIT":
+			_ = c.PrintfLine("221 bye")
+			return
+		default:
+			_ = c.PrintfLine("502 not implemented")
+		}
+	}
+}
+
+func newSMTPMailer(t *testing.T, addr string) Mailer {
+	t.Helper()
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.Default().Mail
+	cfg.Driver = "smtp"
+	cfg.From = "ChatApp <no-reply@example.com>"
+	cfg.SMTPHost = host
+	cfg.SMTPTLS = "none"
+	cfg.Timeout = 5 * time.Second
+	if cfg.SMTPPort, err = strconv.Atoi(port); err != nil {
+		t.Fatal(err)
+	}
+	mailer, err := New(cfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return mailer
+}
+
+func TestSMTPSendsVerification(t *testing.T) {
+	s := newSink(t, false)
+	link := "http://localhost:3000/verify-email?token=abc.def"
+	err := newSMTPMailer(t, s.addr).Send(context.Background(), Verification("Name+Tag@example.com", link, 24*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var msg received
+	select {
+	case msg = <-s.got:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the sink received no message")
+	}
+	if msg.from != "FROM:<no-reply@example.com>" || msg.to != "TO:<Name+Tag@example.com>" {
+		t.Errorf("envelope %s %s, want no-reply@example.com to Name+Tag@example.com", msg.from, msg.to)
+	}
+	headers, body, _ := strings.Cut(strings.Join(msg.lines, "\n"), "\n\n")
+	for _, want := range []string{
+		`From: "ChatApp" <no-reply@example.com>`,
+		"To: Name+Tag@example.com",
+		"Subject: Confirm your email address",
+		"Content-Type: text/plain; charset=utf-8",
+	} {
+		if !strings.Contains(headers, want) {
+			t.Errorf("headers lack %q:\n%s", want, headers)
+		}
+	}
+	if !strings.Contains(body, "\n"+link+"\n") || !strings.Contains(body, "expires in 24 hours") {
+		t.Errorf("body lacks the link on its own line or its lifetime:\n%s", body)
+	}
+}
+
+func TestSMTPRejectedRecipient(t *testing.T) {
+	s := newSink(t, true)
+	err := newSMTPMailer(t, s.addr).Send(context.Background(), Verification("nobody@example.com", "http://localhost/", time.Hour))
+	if err == nil || !strings.Contains(err.Error(), "RCPT TO") {
+		t.Errorf("Send to a rejected recipient = %v, want an RCPT TO error", err)
+	}
+}
+
+func TestSMTPInvalidRecipient(t *testing.T) {
+	// Never dialled: the address is refused first
+	err := newSMTPMailer(t, "127.0.0.1:1").Send(context.Background(), Message{To: "Name <a@b", Subject: "x", Text: "x"})
+	if err == nil || !strings.Contains(err.Error(), "invalid recipient") {
+		t.Errorf("Send to a malformed address = %v, want an invalid recipient error", err)
+	}
+}
@@ -0,0 +1,146 @@
+package mail
+
+import (
+	"fmt"
+	"time"
+)
+
+// Verification asks the recipient to confirm their address by opening link.
+func Verification(to, link string, ttl time.Duration) Message {
+	return Message{
+		To:      to,
+		Subject: "Confirm your email address",
+		Text: fmt.Sprintf(`Welcome to ChatApp!
+
+Confirm your email address by opening this link:
+
+%s
+
+The link expires in %s. If you didn't create an account you can ignore this email.
+`, link, humanize(ttl)),
+	}
+}
+
+// PasswordReset sends the link that lets the recipient choose a new
+// password.
+func PasswordReset(to, link string, ttl time.Duration) Message {
+	return Message{
+		To:      to,
+		Subject: "Reset your password",
+		Text: fmt.Sprintf(`Someone asked to reset the password for your ChatApp account.
+
+Choose a new password by opening this link:
+
+%s
+
+The link expires in %s and can only be used once. Resetting signs you out on every device.
+If you didn't ask for this you can ignore this email, your password hasn't changed.
+`, link, humanize(ttl)),
+	}
+}
+
+// AccountLocked warns the owner that repeated failed sign-ins locked their
+// account for lockout.
+func AccountLocked(to string, lockout time.Duration) Message {
+	return Message{
+		To:      to,
+		Subject: "Your account was temporarily locked",
+		Text: fmt.Sprintf(`Someone failed to sign in to your ChatApp account several times in a row, so
+sign-ins are paused for %s.
+
+If that was you, wait and try again, or reset your password to get back in straight away.
+If it wasn't you, none of these attempts got in, but consider changing your password and turning on
+two-factor authentication.
+`, humanize(lockout)),
+	}
+}
+
+// ConfirmEmailChange asks the recipient to confirm that the account should
+// use this address from now on.
+func ConfirmEmailChange(to, link string, ttl time.Duration) Message {
+	return Message{
+		To:      to,
+		Subject: "Confirm your new email address",
+		Text: fmt.Sprintf(`Someone asked to use this address for their ChatApp account.
+
+Confirm the change by opening this link:
+
+%s
+
+The link expires in %s. Until then the account keeps its current address.
+If you didn't ask for this you can ignore this email.
+`, link, humanize(ttl)),
+	}
+}
+
+// EmailChanged tells the previous address that the account moved to
+// newEmail.
+func EmailChanged(to, newEmail string) Message {
+	return Message{
+		To:      to,
+		Subject: "Your email address was changed",
+		Text: fmt.Sprintf(`The email address of your ChatApp account was changed to %s.
+
+If that wasn't you, reply to this email straight away so we can help you recover the account.
+`, newEmail),
+	}
+}
+
+// PasswordChanged confirms a password change made while signed in.
+func PasswordChanged(to string) Message {
+	return Message{
+		To:      to,
+		Subject: "Your password was changed",
+		Text: `The password of your ChatApp account was just changed, and every other device was signed out.
+
+If that wasn't you, reset your password straight away with "Forgot password" on the sign-in page.
+`,
+	}
+}
+
+// DeletionScheduled confirms that the account will be deleted at deleteAt
+// and how to stop it.
+func DeletionScheduled(to string, deleteAt time.Time) Message {
+	return Message{
+		To:      to,
+		Subject: "Your account will be deleted",
+		Text: fmt.Sprintf(`Your ChatApp account and all its chats will be deleted on %s.
+
+Changed your mind? Sign in and cancel the deletion before then. After that date the account can't be recovered.
+`, deleteAt.UTC().Format("2 January 2006 at 15:04 UTC")),
+	}
+}
+
+// ExportReady sends the link to a finished data export.
+func ExportReady(to, link string, ttl time.Duration) Message {
+	return Message{
+		To:      to,
+		Subject: "Your data export is ready",
+		Text: fmt.Sprintf(`The copy of your ChatApp data you asked for is ready. Download it here:
+
+%s
+
+The link works for %s. The archive holds your account details and every chat, so keep it somewhere safe.
+`, link, humanize(ttl)),
+	}
+}
+
+// humanize renders durations the way people write them: "48 hours",
+// "30 minutes".
+func humanize(d time.Duration) string {
+	switch {
+	case d >= time.Hour && d%time.Hour == 0:
+		return plural(int(d/time.Hour), "hour")
+	case d >= time.Minute:
+		return plural(int(d/time.Minute), "minute")
+	default:
+		return d.String()
+	}
+}
+
+func plural(n int, unit string) string {
+	if n == 1 {
+		return "1 " + unit
+	}
+	return fmt.Sprintf("%d %ss", n, unit)
+}
@@ -1,62 +1,180 @@
 package main
 
 import (
+	"context"
 	"fmt"
-	"log"
+	"log/slog"
+	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 
-	"github.com/gin-gonic/gin"
-	"github.com/joho/godotenv"
-	ginratelimit "github.com/ljahier/gin-ratelimit"
+	"github.com/sarwanazhar/chatappbackend/config"
+	"github.com/sarwanazhar/chatappbackend/controlers"
 	"github.com/sarwanazhar/chatappbackend/database"
+	"github.com/sarwanazhar/chatappbackend/libs"
+	"github.com/sarwanazhar/chatappbackend/logging"
+	"github.com/sarwanazhar/chatappbackend/mail"
+	"github.com/sarwanazhar/chatappbackend/migrations"
+	"github.com/sarwanazhar/chatappbackend/repository"
 	"github.com/sarwanazhar/chatappbackend/routes"
+	"github.com/sarwanazhar/chatappbackend/sso"
+	"github.com/sarwanazhar/chatappbackend/tracing"
+	"go.mongodb.org/mongo-driver/v2/mongo"
 )
 
-func init() {
-	// Load .env only if running locally (PORT not set)
-	if os.Getenv("PORT") == "" {
-		err := godotenv.Load()
-		if err != nil {
-			log.Println("⚠️  No .env file found, continuing...")
-		} else {
-			log.Println("✅ .env loaded")
+// Usage:
+//
+//	chatappbackend [flags]                 run the HTTP server
+//	chatappbackend migrate [up] [flags]    apply pending migrations and exit
+//	chatappbackend migrate status [flags]  list migrations and when they ran
+func main() {
+	args := os.Args[1:]
+	command := "serve"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	}
+	action := ""
+	if command == "migrate" {
+		action = "up"
+		if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+			action, args = args[0], args[1:]
 		}
 	}
+
+	cfg, err := config.Load(args)
+	if err != nil {
+		fatal("❌ Configuration error", "error", err)
+	}
+
+	logger := logging.New(os.Stdout, cfg.Log.LoggingOptions())
+	slog.SetDefault(logger)
+
+	ctx := context.Background()
+
+	// Connect to MongoDB
+	client, err := database.ConnectMongo(ctx, cfg.Mongo)
+	if err != nil {
+		fatal("❌ MongoDB unavailable", "error", err)
+	}
+	defer client.Disconnect(context.Background())
+	logger.Info("✅ MongoDB connected", "database", cfg.Mongo.Database)
+	db := client.Database(cfg.Mongo.Database)
+
+	switch command {
+	case "serve":
+		serve(ctx, cfg, db, logger)
+	case "migrate":
+		migrate(ctx, db, logger, action)
+	default:
+		fatal("❌ Unknown command", "command", command)
+	}
 }
 
-func main() {
-	port := os.Getenv("PORT")
-	backendUri := os.Getenv("MONGODB_URI")
+func serve(ctx context.Context, cfg *config.Config, db *mongo.Database, logger *slog.Logger) {
+	for _, warning := range cfg.Warnings() {
+		logger.Warn("⚠️  " + warning)
+	}
 
-	if port == "" {
-		port = "8080"
+	shutdownTracing, err := tracing.Init(ctx)
+	if err != nil {
+		fatal("❌ Tracing setup failed", "error", err)
 	}
-	if backendUri == "" {
-		log.Fatal("❌ MONGODB_URI is empty")
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+		defer cancel()
+		_ = shutdownTracing(ctx)
+	}()
+
+	if cfg.Mongo.AutoMigrate {
+		if err := migrations.Run(ctx, db, logger, time.Minute); err != nil {
+			fatal("❌ Migrations failed", "error", err)
+		}
 	}
 
-	// Connect to MongoDB
-	database.ConnectMongo(backendUri)
+	gemini, err := libs.NewGemini(ctx, cfg.AI)
+	if err != nil {
+		fatal("❌ Gemini client setup failed", "error", err)
+	}
 
-	r := gin.Default()
+	mailer, err := mail.New(cfg.Mail, logger)
+	if err != nil {
+		fatal("❌ Mailer setup failed", "error", err)
+	}
 
-	// --- RATE LIMITER SETUP ---
-	tb := ginratelimit.NewTokenBucket(30, 1*time.Minute)
+	providers := sso.New(cfg.SSO)
+	if len(providers) > 0 {
+		logger.Info("SSO providers enabled", "providers", providers.Names())
+	}
 
-	// Middleware that uses userId from context
-	r.Use(func(ctx *gin.Context) {
-		userId := ctx.GetString("userId")
-		ginratelimit.RateLimitByUserId(tb, userId)(ctx)
-	})
+	app := controlers.NewApp(
+		cfg,
+		repository.New(db, cfg.Mongo.OperationTimeout),
+		gemini,
+		libs.NewDuckDuckGo(cfg.Search),
+		mailer,
+		providers,
+		logger,
+	)
+
+	if err := app.LoadSigningKeys(ctx); err != nil {
+		fatal("❌ Signing keys unavailable", "error", err)
+	}
 
-	// Register routes
-	routes.InitRoutes(r)
+	background, stopBackground := context.WithCancel(ctx)
+	defer stopBackground()
+	go app.PurgeDeletedAccounts(background)
+	go app.RotateSigningKeys(background)
 
-	address := fmt.Sprintf(":%s", port)
-	fmt.Printf("✅ Starting server on %s\n", address)
+	address := fmt.Sprintf(":%s", cfg.Server.Port)
+	logger.Info("✅ Starting server", "address", address)
 
-	if err := r.Run(address); err != nil {
-		log.Fatalf("❌ Server failed to run: %v", err)
+	srv := &http.Server{Addr: address, Handler: routes.New(app)}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			fatal("❌ Server failed to run", "error", err)
+		}
+	}()
+
+	// Wait for a termination signal so pending spans get flushed on the way out
+	stop, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	<-stop.Done()
+
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancelShutdown()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		logger.Warn("⚠️  Server shutdown", "error", err)
 	}
 }
+
+func migrate(ctx context.Context, db *mongo.Database, logger *slog.Logger, action string) {
+	switch action {
+	case "up":
+		if err := migrations.Run(ctx, db, logger, time.Minute); err != nil {
+			fatal("❌ Migrations failed", "error", err)
+		}
+		logger.Info("✅ Migrations up to date")
+	case "status":
+		statuses, err := migrations.List(ctx, db)
+		if err != nil {
+			fatal("❌ Could not read migrations", "error", err)
+		}
+		for _, s := range statuses {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = s.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%4d  %-25s  %s\n", s.Version, applied, s.Description)
+		}
+	default:
+		fatal("❌ Unknown migrate action, use up or status", "action", action)
+	}
+}
+
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
@@ -0,0 +1,176 @@
+package migrations
+
+import (
+	"context"
+	"time"
+
+	"github.com/sarwanazhar/chatappbackend/libs"
+	"github.com/sarwanazhar/chatappbackend/logging"
+	"github.com/sarwanazhar/chatappbackend/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// All is the ordered migration history. Append new migrations with the next
+// version number; never edit or reorder one that has shipped.
+var All = []Migration{
+	{
+		Version:     1,
+		Description: "unique index on users.email",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			// Fails if duplicate emails already exist; resolve them by hand first.
+			return ensureIndex(ctx, db, repository.UsersCollection, "email_unique")
+		},
+	},
+	{
+		Version:     2,
+		Description: "index chats by user_id and updated_at",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			return ensureIndex(ctx, db, repository.ChatsCollection, "user_id_updated_at")
+		},
+	},
+	{
+		Version:     3,
+		Description: "backfill missing updated_at from created_at",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			filter := bson.M{"updated_at": bson.M{"$exists": false}}
+			backfill := mongo.Pipeline{{{Key: "$set", Value: bson.M{"updated_at": "$created_at"}}}}
+			for _, collection := range []string{repository.UsersCollection, repository.ChatsCollection} {
+				if _, err := db.Collection(collection).UpdateMany(ctx, filter, backfill); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Version:     4,
+		Description: "link token indexes; existing users count as verified",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			for _, name := range []string{"expires_at_ttl", "user_id_purpose"} {
+				if err := ensureIndex(ctx, db, repository.TokensCollection, name); err != nil {
+					return err
+				}
+			}
+			// Accounts created before verification existed are grandfathered
+			// in, so turning on REQUIRE_VERIFIED_EMAIL doesn't lock them out.
+			_, err := db.Collection(repository.UsersCollection).UpdateMany(ctx,
+				bson.M{"email_verified": bson.M{"$exists": false}},
+				bson.M{"$set": bson.M{"email_verified": true}},
+			)
+			return err
+		},
+	},
+	{
+		Version:     5,
+		Description: "unique index on linked provider identities",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			return ensureIndex(ctx, db, repository.UsersCollection, "identities_unique")
+		},
+	},
+	{
+		Version:     6,
+		Description: "api key indexes",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			for _, name := range []string{"hash_unique", "user_id_created_at"} {
+				if err := ensureIndex(ctx, db, repository.APIKeysCollection, name); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Version:     7,
+		Description: "expire failed login counters",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			return ensureIndex(ctx, db, repository.LoginAttemptsCollection, "expires_at_ttl")
+		},
+	},
+	{
+		Version:     8,
+		Description: "session indexes",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			for _, name := range []string{"user_id_last_seen_at", "expires_at_ttl"} {
+				if err := ensureIndex(ctx, db, repository.SessionsCollection, name); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Version:     9,
+		Description: "index pending account deletions",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			return ensureIndex(ctx, db, repository.UsersCollection, "delete_at")
+		},
+	},
+	{
+		Version:     10,
+		Description: "data export indexes",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			for _, name := range []string{"user_id_created_at", "expires_at_ttl"} {
+				if err := ensureIndex(ctx, db, repository.ExportsCollection, name); err != nil {
+					return err
+				}
+			}
+			for _, name := range []string{"export_id_n_unique", "user_id", "expires_at_ttl"} {
+				if err := ensureIndex(ctx, db, repository.ExportChunksCollection, name); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Version:     11,
+		Description: "signing key indexes",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			for _, name := range []string{"sign_from_unique", "expires_at_ttl"} {
+				if err := ensureIndex(ctx, db, repository.SigningKeysCollection, name); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Version:     12,
+		Description: "normalize stored emails and add email keys",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			// The index first, so keys that clash are refused as they're set
+			if err := ensureIndex(ctx, db, repository.UsersCollection, "email_key_unique"); err != nil {
+				return err
+			}
+			users := repository.New(db, 30*time.Second).Users
+			report, err := users.NormalizeEmails(ctx, libs.NormalizeEmail, func(email string) string {
+				// Plus folding is left to `chatadmin normalize-emails`,
+				// since it depends on configuration
+				return libs.EmailKey(email, false)
+			})
+			if err != nil {
+				return err
+			}
+			// Users that differ only by case can't all keep signing in, but
+			// that's no reason to hold back the upgrade; `chatadmin
+			// normalize-emails` lists them again once they're resolved
+			if len(report.Conflicts) > 0 || len(report.Invalid) > 0 {
+				logging.FromContext(ctx).Warn("some stored emails were left as they are",
+					"conflicts", len(report.Conflicts), "conflict_user_ids", hexIDs(report.Conflicts),
+					"invalid", len(report.Invalid), "invalid_user_ids", hexIDs(report.Invalid))
+			}
+			return nil
+		},
+	},
+}
+
+// hexIDs formats ids for a log line.
+func hexIDs(ids []primitive.ObjectID) []string {
+	hex := make([]string, len(ids))
+	for i, id := range ids {
+		hex[i] = id.Hex()
+	}
+	return hex
+}
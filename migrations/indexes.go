@@ -0,0 +1,167 @@
+package migrations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/sarwanazhar/chatappbackend/repository"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// Indexes is every index the application relies on, by collection. Each
+// index is named so migrations and RebuildIndexes can refer to it.
+var Indexes = map[string][]mongo.IndexModel{
+	repository.UsersCollection: {
+		{
+			Keys:    bson.D{{Key: "email", Value: 1}},
+			Options: options.Index().SetName("email_unique").SetUnique(true),
+		},
+		{
+			// Sparse so users whose key couldn't be set (see migration
+			// 12) don't all collide on a missing key.
+			Keys:    bson.D{{Key: "email_key", Value: 1}},
+			Options: options.Index().SetName("email_key_unique").SetUnique(true).SetSparse(true),
+		},
+		{
+			// One user per provider account. Sparse so users without
+			// identities don't all collide on a missing key.
+			Keys:    bson.D{{Key: "identities.provider", Value: 1}, {Key: "identities.subject", Value: 1}},
+			Options: options.Index().SetName("identities_unique").SetUnique(true).SetSparse(true),
+		},
+		{
+			// Sparse: only users with a pending deletion have delete_at
+			Keys:    bson.D{{Key: "delete_at", Value: 1}},
+			Options: options.Index().SetName("delete_at").SetSparse(true),
+		},
+	},
+	repository.ChatsCollection: {
+		{
+			Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "updated_at", Value: -1}},
+			Options: options.Index().SetName("user_id_updated_at"),
+		},
+	},
+	repository.APIKeysCollection: {
+		{
+			Keys:    bson.D{{Key: "hash", Value: 1}},
+			Options: options.Index().SetName("hash_unique").SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}},
+			Options: options.Index().SetName("user_id_created_at"),
+		},
+	},
+	repository.SessionsCollection: {
+		{
+			Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "last_seen_at", Value: -1}},
+			Options: options.Index().SetName("user_id_last_seen_at"),
+		},
+		{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetName("expires_at_ttl").SetExpireAfterSeconds(0),
+		},
+	},
+	repository.ExportsCollection: {
+		{
+			Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}},
+			Options: options.Index().SetName("user_id_created_at"),
+		},
+		{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetName("expires_at_ttl").SetExpireAfterSeconds(0),
+		},
+	},
+	repository.ExportChunksCollection: {
+		{
+			Keys:    bson.D{{Key: "export_id", Value: 1}, {Key: "n", Value: 1}},
+			Options: options.Index().SetName("export_id_n_unique").SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "user_id", Value: 1}},
+			Options: options.Index().SetName("user_id"),
+		},
+		{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetName("expires_at_ttl").SetExpireAfterSeconds(0),
+		},
+	},
+	repository.SigningKeysCollection: {
+		{
+			// Server instances rotating at the same time agree on one key
+			Keys:    bson.D{{Key: "sign_from", Value: 1}},
+			Options: options.Index().SetName("sign_from_unique").SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetName("expires_at_ttl").SetExpireAfterSeconds(0),
+		},
+	},
+	repository.LoginAttemptsCollection: {
+		{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetName("expires_at_ttl").SetExpireAfterSeconds(0),
+		},
+	},
+	repository.TokensCollection: {
+		{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetName("expires_at_ttl").SetExpireAfterSeconds(0),
+		},
+		{
+			Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "purpose", Value: 1}},
+			Options: options.Index().SetName("user_id_purpose"),
+		},
+	},
+}
+
+// ensureIndex creates the named index from Indexes. Creating an index that
+// already exists with the same definition is a no-op.
+func ensureIndex(ctx context.Context, db *mongo.Database, collection, name string) error {
+	for _, model := range Indexes[collection] {
+		if indexName(model) != name {
+			continue
+		}
+		if _, err := db.Collection(collection).Indexes().CreateOne(ctx, model); err != nil {
+			return fmt.Errorf("creating index %s.%s: %w", collection, name, err)
+		}
+		return nil
+	}
+	return fmt.Errorf("index %s.%s is not defined", collection, name)
+}
+
+// RebuildIndexes drops each defined index and creates it again, which picks
+// up definition changes that an in-place create would reject.
+func RebuildIndexes(ctx context.Context, db *mongo.Database) error {
+	for collection, models := range Indexes {
+		view := db.Collection(collection).Indexes()
+		for _, model := range models {
+			name := indexName(model)
+			if err := view.DropOne(ctx, name); err != nil && !isIndexNotFound(err) {
+				return fmt.Errorf("dropping index %s.%s: %w", collection, name, err)
+			}
+			if _, err := view.CreateOne(ctx, model); err != nil {
+				return fmt.Errorf("creating index %s.%s: %w", collection, name, err)
+			}
+		}
+	}
+	return nil
+}
+
+func indexName(model mongo.IndexModel) string {
+	var opts options.IndexOptions
+	for _, set := range model.Options.List() {
+		_ = set(&opts)
+	}
+	if opts.Name == nil {
+		return ""
+	}
+	return *opts.Name
+}
+
+func isIndexNotFound(err error) bool {
+	var cmdErr mongo.CommandError
+	// 27 is IndexNotFound; 26 (NamespaceNotFound) means the collection is missing
+	return errors.As(err, &cmdErr) && (cmdErr.HasErrorCode(27) || cmdErr.HasErrorCode(26))
+}
@@ -0,0 +1,161 @@
+package migrations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/sarwanazhar/chatappbackend/logging"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// Collection records applied versions, one document per version, plus the
+// lock document held while migrations run.
+const Collection = "migrations"
+
+const lockID = "lock"
+
+// A lock older than this is assumed to belong to a crashed process.
+const staleLockAfter = 15 * time.Minute
+
+// ErrLocked is returned when another process holds the migration lock for
+// longer than Run is willing to wait.
+var ErrLocked = errors.New("migrations are locked by another process")
+
+// Migration is one schema or data change. Up must be safe to re-run: a crash
+// after Up but before the version is recorded runs it again.
+type Migration struct {
+	Version     int
+	Description string
+	Up          func(ctx context.Context, db *mongo.Database) error
+}
+
+type record struct {
+	Version     int       `bson:"_id"`
+	Description string    `bson:"description"`
+	AppliedAt   time.Time `bson:"applied_at"`
+	Duration    string    `bson:"duration"`
+}
+
+// Status describes one known migration and whether it has been applied.
+type Status struct {
+	Version     int
+	Description string
+	AppliedAt   *time.Time
+}
+
+// Run applies every pending migration in version order. Concurrent callers
+// (e.g. several instances starting at once) are serialised by a lock
+// document; the losers wait up to lockWait and then see nothing pending.
+func Run(ctx context.Context, db *mongo.Database, logger *slog.Logger, lockWait time.Duration) error {
+	release, err := acquireLock(ctx, db, lockWait)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	applied, err := appliedVersions(ctx, db)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range All {
+		if _, done := applied[m.Version]; done {
+			continue
+		}
+
+		logger.Info("applying migration", "version", m.Version, "description", m.Description)
+		start := time.Now()
+		if err := m.Up(logging.WithContext(ctx, logger.With("version", m.Version)), db); err != nil {
+			return fmt.Errorf("migration %d (%s): %w", m.Version, m.Description, err)
+		}
+
+		_, err := db.Collection(Collection).InsertOne(ctx, record{
+			Version:     m.Version,
+			Description: m.Description,
+			AppliedAt:   time.Now(),
+			Duration:    time.Since(start).String(),
+		})
+		if err != nil {
+			return fmt.Errorf("recording migration %d: %w", m.Version, err)
+		}
+		logger.Info("migration applied", "version", m.Version, "duration", time.Since(start))
+	}
+	return nil
+}
+
+// List reports every known migration alongside when it was applied.
+func List(ctx context.Context, db *mongo.Database) ([]Status, error) {
+	applied, err := appliedVersions(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, 0, len(All))
+	for _, m := range All {
+		s := Status{Version: m.Version, Description: m.Description}
+		if r, ok := applied[m.Version]; ok {
+			s.AppliedAt = &r.AppliedAt
+		}
+		statuses = append(statuses, s)
+	}
+	return statuses, nil
+}
+
+func appliedVersions(ctx context.Context, db *mongo.Database) (map[int]record, error) {
+	cursor, err := db.Collection(Collection).Find(ctx, bson.M{"_id": bson.M{"$type": "number"}})
+	if err != nil {
+		return nil, fmt.Errorf("reading applied migrations: %w", err)
+	}
+	var records []record
+	if err := cursor.All(ctx, &records); err != nil {
+		return nil, fmt.Errorf("decoding applied migrations: %w", err)
+	}
+
+	applied := make(map[int]record, len(records))
+	for _, r := range records {
+		applied[r.Version] = r
+	}
+	return applied, nil
+}
+
+func acquireLock(ctx context.Context, db *mongo.Database, wait time.Duration) (func(), error) {
+	coll := db.Collection(Collection)
+	owner, _ := os.Hostname()
+	owner = fmt.Sprintf("%s/%d", owner, os.Getpid())
+	deadline := time.Now().Add(wait)
+
+	for {
+		now := time.Now()
+		// Take the lock if it is free or stale. When someone else holds a
+		// fresh lock the filter misses, the upsert collides on _id and the
+		// insert fails with a duplicate key error.
+		_, err := coll.UpdateOne(ctx,
+			bson.M{"_id": lockID, "locked_at": bson.M{"$lt": now.Add(-staleLockAfter)}},
+			bson.M{"$set": bson.M{"locked_at": now, "owner": owner}},
+			options.UpdateOne().SetUpsert(true),
+		)
+		if err == nil {
+			return func() {
+				_, _ = coll.DeleteOne(context.Background(), bson.M{"_id": lockID, "owner": owner})
+			}, nil
+		}
+		if !mongo.IsDuplicateKeyError(err) {
+			return nil, fmt.Errorf("acquiring migration lock: %w", err)
+		}
+		if now.After(deadline) {
+			return nil, ErrLocked
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(time.Second):
+		}
+	}
+}
@@ -7,11 +7,142 @@ import (
 )
 
 type User struct {
-	ID        primitive.ObjectID `json:"_id" bson:"_id,omitempty"`
-	Email     string             `json:"email" bson:"email"`
-	Password  string             `json:"password" bson:"password"`
-	CreatedAt time.Time          `json:"createdAt" bson:"created_at"`
-	UpdatedAt time.Time          `json:"updatedAt" bson:"updated_at"`
+	ID       primitive.ObjectID `json:"_id" bson:"_id,omitempty"`
+	Email    string             `json:"email" bson:"email"`
+	Password string             `json:"password" bson:"password"`
+	Disabled bool               `json:"disabled" bson:"disabled,omitempty"`
+	// Role is RoleUser, RoleSupport or RoleAdmin; empty means RoleUser.
+	Role string `json:"role,omitempty" bson:"role,omitempty"`
+	// EmailKey is Email as accounts are unique by and looked up under
+	// (libs.EmailKey); mail still goes to Email.
+	EmailKey string `json:"-" bson:"email_key,omitempty"`
+
+	EmailVerified      bool       `json:"emailVerified" bson:"email_verified"`
+	EmailVerifiedAt    *time.Time `json:"emailVerifiedAt,omitempty" bson:"email_verified_at,omitempty"`
+	VerificationSentAt *time.Time `json:"-" bson:"verification_sent_at,omitempty"`
+	// TokensRevokedAt invalidates every access token issued before it.
+	TokensRevokedAt *time.Time `json:"-" bson:"tokens_revoked_at,omitempty"`
+	// PendingEmail is the address the user asked to switch to; it replaces
+	// Email once the link sent there is opened.
+	PendingEmail string `json:"pendingEmail,omitempty" bson:"pending_email,omitempty"`
+	// DeleteAt is set while the user's deletion is pending: the account and
+	// its data are removed for good after it.
+	DeleteAt *time.Time `json:"deleteAt,omitempty" bson:"delete_at,omitempty"`
+
+	// Identities are the external accounts (Google, GitHub, ...) that can
+	// sign in as this user. Users created through one have no password.
+	Identities []Identity `json:"identities,omitempty" bson:"identities,omitempty"`
+
+	MFA *MFA `json:"-" bson:"mfa,omitempty"`
+
+	CreatedAt time.Time `json:"createdAt" bson:"created_at"`
+	UpdatedAt time.Time `json:"updatedAt" bson:"updated_at"`
+}
+
+// Roles a user can hold. Staff roles unlock the admin API; what each may
+// do there is decided by libs.HasPermission.
+const (
+	RoleUser    = "user"
+	RoleSupport = "support"
+	RoleAdmin   = "admin"
+)
+
+// Roles lists every role, least privileged first.
+var Roles = []string{RoleUser, RoleSupport, RoleAdmin}
+
+// RoleName is the user's role, defaulting to RoleUser.
+func (u *User) RoleName() string {
+	if u.Role == "" {
+		return RoleUser
+	}
+	return u.Role
+}
+
+// Identity links a user to an account at an identity provider.
+type Identity struct {
+	Provider string    `json:"provider" bson:"provider"`
+	Subject  string    `json:"-" bson:"subject"`
+	LinkedAt time.Time `json:"linkedAt" bson:"linked_at"`
+}
+
+// MFA is a user's TOTP second factor. Until Enabled it is an enrollment
+// waiting for its first code.
+type MFA struct {
+	// Secret is the TOTP seed sealed with libs.SealTOTPSecret.
+	Secret    string     `bson:"secret"`
+	Enabled   bool       `bson:"enabled"`
+	EnabledAt *time.Time `bson:"enabled_at,omitempty"`
+	// RecoveryCodes are hashes (libs.HashRecoveryCode) of the unused codes.
+	RecoveryCodes []string `bson:"recovery_codes,omitempty"`
+	// LastStep is the newest TOTP step accepted, so a code works only once.
+	LastStep int64 `bson:"last_step"`
+}
+
+// MFAEnabled reports whether logins need a second factor.
+func (u *User) MFAEnabled() bool {
+	return u.MFA != nil && u.MFA.Enabled
+}
+
+// APIKey is a personal access token for scripts. Only its hash is stored.
+type APIKey struct {
+	ID     primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	UserID primitive.ObjectID `json:"-" bson:"user_id"`
+	Name   string             `json:"name" bson:"name"`
+	// Prefix is the key's first characters, enough to recognise it.
+	Prefix     string     `json:"prefix" bson:"prefix"`
+	Hash       string     `json:"-" bson:"hash"`
+	Scopes     []string   `json:"scopes" bson:"scopes"`
+	CreatedAt  time.Time  `json:"createdAt" bson:"created_at"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty" bson:"last_used_at,omitempty"`
+	ExpiresAt  *time.Time `json:"expiresAt,omitempty" bson:"expires_at,omitempty"`
+}
+
+// Session is one sign-in: the JWT it issued names it in the sid claim and
+// stops working once it is deleted.
+type Session struct {
+	ID         primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	UserID     primitive.ObjectID `json:"-" bson:"user_id"`
+	UserAgent  string             `json:"userAgent" bson:"user_agent"`
+	IP         string             `json:"ip" bson:"ip"`
+	CreatedAt  time.Time          `json:"createdAt" bson:"created_at"`
+	LastSeenAt time.Time          `json:"lastSeenAt" bson:"last_seen_at"`
+	// ExpiresAt matches the token's expiry; a TTL index removes the record.
+	ExpiresAt time.Time `json:"expiresAt" bson:"expires_at"`
+}
+
+// Export statuses.
+const (
+	ExportPending = "pending"
+	ExportReady   = "ready"
+	ExportFailed  = "failed"
+)
+
+// Export is a personal data export job. Its ZIP file is stored in chunks
+// next to it, and both are removed by a TTL index at ExpiresAt.
+type Export struct {
+	ID          primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	UserID      primitive.ObjectID `json:"-" bson:"user_id"`
+	Status      string             `json:"status" bson:"status"`
+	Size        int64              `json:"size,omitempty" bson:"size,omitempty"`
+	Chunks      int                `json:"-" bson:"chunks,omitempty"`
+	CreatedAt   time.Time          `json:"createdAt" bson:"created_at"`
+	CompletedAt *time.Time         `json:"completedAt,omitempty" bson:"completed_at,omitempty"`
+	ExpiresAt   time.Time          `json:"expiresAt" bson:"expires_at"`
+}
+
+// SigningKey is a key pair for signing access tokens. It signs from
+// SignFrom until a newer key takes over, and stays published for
+// verification until ExpiresAt, when a TTL index removes it.
+type SigningKey struct {
+	ID        string `json:"kid" bson:"_id"`
+	Algorithm string `json:"alg" bson:"algorithm"`
+	// PrivateKey is PKCS #8, sealed with the JWT secret.
+	PrivateKey string `json:"-" bson:"private_key"`
+	// PublicKey is PKIX.
+	PublicKey []byte    `json:"-" bson:"public_key"`
+	CreatedAt time.Time `json:"createdAt" bson:"created_at"`
+	SignFrom  time.Time `json:"signFrom" bson:"sign_from"`
+	ExpiresAt time.Time `json:"expiresAt" bson:"expires_at"`
 }
 
 type Message struct {
@@ -0,0 +1,115 @@
+package openapi
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/chatappbackend/libs"
+)
+
+// Handler serves the document as JSON.
+func Handler(doc *openapi3.T) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, doc)
+	}
+}
+
+// Validator rejects requests whose parameters or body don't match the
+// document with a 400 naming the offending field. Authentication is left to
+// the JWT middleware, and unmatched routes fall through to gin's 404.
+func Validator(doc *openapi3.T) gin.HandlerFunc {
+	type key struct{ method, path string }
+	routes := map[key]*routers.Route{}
+	for path, item := range doc.Paths.Map() {
+		for method, op := range item.Operations() {
+			ginPath := strings.NewReplacer("{", ":", "}", "").Replace(path)
+			routes[key{method, ginPath}] = &routers.Route{
+				Spec:      doc,
+				Path:      path,
+				PathItem:  item,
+				Method:    method,
+				Operation: op,
+			}
+		}
+	}
+	options := &openapi3filter.Options{AuthenticationFunc: openapi3filter.NoopAuthenticationFunc}
+
+	return func(c *gin.Context) {
+		route := routes[key{c.Request.Method, c.FullPath()}]
+		if route == nil {
+			c.Next()
+			return
+		}
+
+		params := make(map[string]string, len(c.Params))
+		for _, p := range c.Params {
+			params[p.Key] = p.Value
+		}
+		err := openapi3filter.ValidateRequest(c.Request.Context(), &openapi3filter.RequestValidationInput{
+			Request:    c.Request,
+			PathParams: params,
+			Route:      route,
+			Options:    options,
+		})
+		if err != nil {
+			message, fields := describe(err)
+			libs.RespondInvalid(c, message, fields...)
+			return
+		}
+		c.Next()
+	}
+}
+
+// describe turns a validation error into one line a client developer can
+// act on, without the schema dump kin-openapi appends, and the field it
+// is about when there is one.
+func describe(err error) (string, []libs.FieldError) {
+	var reqErr *openapi3filter.RequestError
+	var schemaErr *openapi3.SchemaError
+	switch {
+	case errors.As(err, &reqErr) && reqErr.Parameter != nil:
+		reason, code := reqErr.Reason, libs.FieldInvalid
+		if errors.As(err, &schemaErr) {
+			reason, code = schemaErr.Reason, fieldCode(schemaErr)
+		}
+		field := libs.FieldError{Field: reqErr.Parameter.Name, Code: code, Message: reason}
+		return fmt.Sprintf("invalid request: %s parameter %q: %s", reqErr.Parameter.In, reqErr.Parameter.Name, reason), []libs.FieldError{field}
+	case errors.As(err, &schemaErr):
+		if name := strings.Join(schemaErr.JSONPointer(), "."); name != "" {
+			field := libs.FieldError{Field: name, Code: fieldCode(schemaErr), Message: schemaErr.Reason}
+			return fmt.Sprintf("invalid request: %s: %s", name, schemaErr.Reason), []libs.FieldError{field}
+		}
+		return "invalid request: " + schemaErr.Reason, nil
+	case errors.Is(err, openapi3filter.ErrInvalidRequired):
+		return "invalid request: body is required", nil
+	case errors.As(err, &reqErr) && reqErr.Reason != "":
+		return "invalid request: " + reqErr.Reason, nil
+	}
+	return "invalid request", nil
+}
+
+// fieldCode names the rule err broke as a field error code. Required
+// strings are also given a minimum length of 1, so an empty one counts as
+// missing.
+func fieldCode(err *openapi3.SchemaError) string {
+	switch err.SchemaField {
+	case "required":
+		return libs.FieldRequired
+	case "minLength":
+		if err.Schema != nil && err.Schema.MinLength <= 1 {
+			return libs.FieldRequired
+		}
+		return libs.FieldTooShort
+	case "minItems":
+		return libs.FieldTooShort
+	case "maxLength", "maxItems":
+		return libs.FieldTooLong
+	}
+	return libs.FieldInvalid
+}
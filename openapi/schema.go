@@ -0,0 +1,71 @@
+package openapi
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3gen"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// objectIDPattern matches the hex form IDs take in JSON and URLs.
+const objectIDPattern = "^[0-9a-fA-F]{24}$"
+
+var objectIDType = reflect.TypeOf(primitive.ObjectID{})
+
+// schemaFor generates the JSON schema of v's type from its json tags, with
+// the gin `binding` rules the handlers enforce carried over.
+func schemaFor(v any) (*openapi3.Schema, error) {
+	ref, err := openapi3gen.NewSchemaRefForValue(v, nil, openapi3gen.SchemaCustomizer(customize))
+	if err != nil {
+		return nil, err
+	}
+	return ref.Value, nil
+}
+
+func customize(_ string, t reflect.Type, tag reflect.StructTag, schema *openapi3.Schema) error {
+	if t == objectIDType {
+		*schema = openapi3.Schema{Type: &openapi3.Types{"string"}, Pattern: objectIDPattern}
+		return nil
+	}
+
+	if t.Kind() == reflect.Struct {
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+			if name != "" && name != "-" && hasRule(f.Tag, "required") {
+				schema.Required = append(schema.Required, name)
+			}
+		}
+	}
+
+	for _, rule := range strings.Split(tag.Get("binding"), ",") {
+		key, value, _ := strings.Cut(rule, "=")
+		n, err := strconv.ParseUint(value, 10, 64)
+		if err != nil || !schema.Type.Is("string") {
+			continue
+		}
+		switch key {
+		case "min":
+			schema.MinLength = n
+		case "max":
+			schema.MaxLength = &n
+		}
+	}
+	if hasRule(tag, "required") && schema.Type.Is("string") && schema.MinLength == 0 {
+		// gin's required rejects "" as well as a missing field
+		schema.MinLength = 1
+	}
+	return nil
+}
+
+func hasRule(tag reflect.StructTag, rule string) bool {
+	for _, r := range strings.Split(tag.Get("binding"), ",") {
+		if r == rule {
+			return true
+		}
+	}
+	return false
+}
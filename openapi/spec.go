@@ -0,0 +1,368 @@
+// Package openapi describes the HTTP API as an OpenAPI 3 document built from
+// the handlers' request and response types, serves it, and validates
+// incoming requests against it.
+package openapi
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/chatappbackend/controlers"
+	"github.com/sarwanazhar/chatappbackend/libs"
+	"github.com/sarwanazhar/chatappbackend/repository"
+)
+
+// operation documents one route. Paths use gin syntax (/v1/chats/:id).
+type operation struct {
+	method, path string
+	id, summary  string
+	tag          string
+	auth         bool
+	deprecated   bool
+	// query lists optional string query parameters.
+	query []string
+	// request is a zero value of the JSON body type, nil for no body.
+	request         any
+	requestOptional bool
+	status          int
+	response        any
+	// stream marks a text/event-stream reply instead of JSON.
+	stream bool
+	// file is the media type of a binary reply, e.g. application/zip.
+	file string
+	// errors lists the error statuses besides the 401/429/500 every
+	// operation can return.
+	errors []int
+}
+
+var operations = []operation{
+	{method: "GET", path: "/", id: "health", summary: "Health check", tag: "meta", status: 200, response: map[string]string{}},
+	{method: "GET", path: "/openapi.json", id: "getOpenAPI", summary: "This document", tag: "meta", status: 200},
+	{method: "GET", path: "/.well-known/jwks.json", id: "getJWKS", summary: "Public keys that verify access tokens, by kid", tag: "meta",
+		status: 200, response: libs.JWKSet{}},
+
+	{method: "GET", path: "/v1/auth/challenge", id: "getChallenge", summary: "A proof-of-work challenge for register and login", tag: "auth",
+		status: 200, response: controlers.ChallengeResponse{}},
+	{method: "POST", path: "/v1/auth/register", id: "register", summary: "Create an account", tag: "auth",
+		request: controlers.RegisterRequest{}, status: 201, response: controlers.InfoResponse{}, errors: []int{400, 409, 428}},
+	{method: "POST", path: "/v1/auth/login", id: "login", summary: "Exchange credentials for a token", tag: "auth",
+		request: controlers.LoginRequest{}, status: 200, response: controlers.LoginResponse{}, errors: []int{400, 403, 428}},
+	{method: "POST", path: "/v1/auth/mfa", id: "verifyMFA", summary: "Finish a login with a TOTP or recovery code", tag: "auth",
+		request: controlers.MFALoginRequest{}, status: 200, response: controlers.LoginResponse{}, errors: []int{400, 401, 403}},
+	{method: "POST", path: "/v1/auth/verify-email", id: "verifyEmail", summary: "Confirm an email address with the emailed token", tag: "auth",
+		request: controlers.VerifyEmailRequest{}, status: 200, response: controlers.InfoResponse{}, errors: []int{400}},
+	{method: "POST", path: "/v1/auth/resend-verification", id: "resendVerification", summary: "Email a new verification link (always 202)", tag: "auth",
+		request: controlers.ResendVerificationRequest{}, status: 202, response: controlers.InfoResponse{}, errors: []int{400}},
+	{method: "POST", path: "/v1/auth/forgot-password", id: "forgotPassword", summary: "Email a password reset link (always 202)", tag: "auth",
+		request: controlers.ForgotPasswordRequest{}, status: 202, response: controlers.InfoResponse{}, errors: []int{400}},
+	{method: "POST", path: "/v1/auth/reset-password", id: "resetPassword", summary: "Set a new password with the emailed token and end all sessions", tag: "auth",
+		request: controlers.ResetPasswordRequest{}, status: 200, response: controlers.InfoResponse{}, errors: []int{400}},
+	{method: "POST", path: "/v1/auth/confirm-email", id: "confirmEmailChange", summary: "Switch to a new email address with the emailed token", tag: "auth",
+		request: controlers.VerifyEmailRequest{}, status: 200, response: controlers.InfoResponse{}, errors: []int{400, 409}},
+	{method: "GET", path: "/v1/auth/providers", id: "listProviders", summary: "Identity providers enabled for single sign-on", tag: "auth",
+		status: 200, response: controlers.ProvidersResponse{}},
+	{method: "GET", path: "/v1/auth/sso/:provider", id: "startSSO", summary: "Redirect the browser to the provider's login page", tag: "auth",
+		status: 302, errors: []int{404}},
+	{method: "GET", path: "/v1/auth/sso/:provider/callback", id: "finishSSO", summary: "Provider callback; redirects to the frontend with #token= or #error=", tag: "auth",
+		query: []string{"code", "state", "error"}, status: 302, errors: []int{404}},
+	{method: "GET", path: "/v1/me", id: "getProfile", summary: "The signed-in user", tag: "users", auth: true,
+		status: 200, response: controlers.UserResponse{}, errors: []int{403, 404}},
+	{method: "POST", path: "/v1/me/mfa/totp", id: "enrollTOTP", summary: "Start two-factor setup and get the TOTP secret", tag: "users", auth: true,
+		status: 200, response: controlers.TOTPEnrollmentResponse{}, errors: []int{403, 404, 409}},
+	{method: "POST", path: "/v1/me/mfa/totp/confirm", id: "confirmTOTP", summary: "Turn two-factor on with a first code; returns recovery codes", tag: "users", auth: true,
+		request: controlers.MFACodeRequest{}, status: 200, response: controlers.RecoveryCodesResponse{}, errors: []int{403, 404, 409}},
+	{method: "POST", path: "/v1/me/mfa/recovery-codes", id: "regenerateRecoveryCodes", summary: "Replace the recovery codes (needs a TOTP code)", tag: "users", auth: true,
+		request: controlers.MFACodeRequest{}, status: 200, response: controlers.RecoveryCodesResponse{}, errors: []int{403, 404, 409}},
+	{method: "POST", path: "/v1/me/mfa/disable", id: "disableMFA", summary: "Turn two-factor off (needs a TOTP or recovery code)", tag: "users", auth: true,
+		request: controlers.MFACodeRequest{}, status: 200, response: controlers.InfoResponse{}, errors: []int{403, 404, 409}},
+	{method: "GET", path: "/v1/me/api-keys", id: "listAPIKeys", summary: "List API keys", tag: "users", auth: true,
+		status: 200, response: controlers.APIKeyListResponse{}, errors: []int{403, 404}},
+	{method: "POST", path: "/v1/me/api-keys", id: "createAPIKey", summary: "Create an API key; the key is only returned here", tag: "users", auth: true,
+		request: controlers.CreateAPIKeyRequest{}, status: 201, response: controlers.APIKeyCreatedResponse{}, errors: []int{403, 404, 409}},
+	{method: "DELETE", path: "/v1/me/api-keys/:id", id: "deleteAPIKey", summary: "Revoke an API key", tag: "users", auth: true,
+		status: 200, response: controlers.InfoResponse{}, errors: []int{403, 404}},
+	{method: "GET", path: "/v1/me/sessions", id: "listSessions", summary: "List the devices you're signed in on", tag: "users", auth: true,
+		status: 200, response: controlers.SessionListResponse{}, errors: []int{403, 404}},
+	{method: "DELETE", path: "/v1/me/sessions/:id", id: "deleteSession", summary: "Sign a session out", tag: "users", auth: true,
+		status: 200, response: controlers.InfoResponse{}, errors: []int{400, 403, 404}},
+	{method: "POST", path: "/v1/me/password", id: "changePassword", summary: "Change your password; other sessions are signed out", tag: "users", auth: true,
+		request: controlers.ChangePasswordRequest{}, status: 200, response: controlers.LoginResponse{}, errors: []int{400, 403, 404}},
+	{method: "POST", path: "/v1/me/email", id: "changeEmail", summary: "Email a confirmation link to a new address", tag: "users", auth: true,
+		request: controlers.ChangeEmailRequest{}, status: 202, response: controlers.InfoResponse{}, errors: []int{400, 403, 404, 409}},
+	{method: "POST", path: "/v1/me/deletion", id: "scheduleDeletion", summary: "Delete your account after the grace period", tag: "users", auth: true,
+		request: controlers.DeleteAccountRequest{}, status: 202, response: controlers.AccountDeletionResponse{}, errors: []int{400, 403, 404}},
+	{method: "DELETE", path: "/v1/me/deletion", id: "cancelDeletion", summary: "Cancel a pending account deletion", tag: "users", auth: true,
+		status: 200, response: controlers.InfoResponse{}, errors: []int{403, 404}},
+	{method: "POST", path: "/v1/me/export", id: "requestExport", summary: "Start building a ZIP of all your data", tag: "users", auth: true,
+		status: 202, response: controlers.ExportResponse{}, errors: []int{403, 404}},
+	{method: "GET", path: "/v1/me/exports/:id", id: "getExport", summary: "A data export's status and download link", tag: "users", auth: true,
+		status: 200, response: controlers.ExportResponse{}, errors: []int{403, 404}},
+	{method: "GET", path: "/v1/me/exports/:id/download", id: "downloadOwnExport", summary: "Download one of your ready data exports", tag: "users", auth: true,
+		status: 200, file: "application/zip", errors: []int{400, 403, 404}},
+	{method: "GET", path: "/v1/exports/download", id: "downloadExport", summary: "Download a data export once with the token from its emailed link", tag: "users",
+		query: []string{"token"}, status: 200, file: "application/zip", errors: []int{400, 404}},
+
+	{method: "GET", path: "/v1/admin/users", id: "adminListUsers", summary: "Search users by email", tag: "admin", auth: true,
+		query: []string{"q", "offset", "limit"}, status: 200, response: controlers.AdminUserListResponse{}, errors: []int{400, 403, 404}},
+	{method: "GET", path: "/v1/admin/users/:id", id: "adminGetUser", summary: "One user with their usage", tag: "admin", auth: true,
+		status: 200, response: controlers.AdminUserDetailResponse{}, errors: []int{403, 404}},
+	{method: "POST", path: "/v1/admin/users/:id/disable", id: "adminDisableUser", summary: "Disable an account and end its sessions", tag: "admin", auth: true,
+		status: 200, response: controlers.AdminUserResponse{}, errors: []int{403, 404}},
+	{method: "POST", path: "/v1/admin/users/:id/enable", id: "adminEnableUser", summary: "Re-enable an account", tag: "admin", auth: true,
+		status: 200, response: controlers.AdminUserResponse{}, errors: []int{403, 404}},
+	{method: "PUT", path: "/v1/admin/users/:id/role", id: "adminSetUserRole", summary: "Change a user's role (admins only)", tag: "admin", auth: true,
+		request: controlers.SetRoleRequest{}, status: 200, response: controlers.AdminUserResponse{}, errors: []int{403, 404}},
+	{method: "DELETE", path: "/v1/admin/users/:id", id: "adminDeleteUser", summary: "Delete a user with their chats, API keys, sessions and tokens", tag: "admin", auth: true,
+		status: 200, response: controlers.InfoResponse{}, errors: []int{403, 404}},
+	{method: "GET", path: "/v1/admin/usage", id: "adminGetUsage", summary: "Service-wide usage and the most active users", tag: "admin", auth: true,
+		query: []string{"top"}, status: 200, response: repository.UsageStats{}, errors: []int{400, 403, 404}},
+
+	{method: "GET", path: "/v1/chats", id: "listChats", summary: "List chats, newest first", tag: "chats", auth: true,
+		status: 200, response: controlers.ChatListResponse{}, errors: []int{403, 404}},
+	{method: "POST", path: "/v1/chats", id: "createChat", summary: "Start a chat", tag: "chats", auth: true,
+		request: controlers.CreateChatRequest{}, requestOptional: true, status: 201, response: controlers.ChatCreatedResponse{}, errors: []int{403, 400, 404}},
+	{method: "GET", path: "/v1/chats/:id", id: "getChat", summary: "One chat with its messages", tag: "chats", auth: true,
+		status: 200, response: controlers.ChatResponse{}, errors: []int{403, 400, 404}},
+	{method: "PATCH", path: "/v1/chats/:id", id: "updateChat", summary: "Rename a chat", tag: "chats", auth: true,
+		request: controlers.UpdateChatRequest{}, status: 200, response: controlers.ChatResponse{}, errors: []int{403, 400, 404}},
+	{method: "DELETE", path: "/v1/chats/:id", id: "deleteChat", summary: "Delete a chat", tag: "chats", auth: true,
+		status: 200, response: controlers.InfoResponse{}, errors: []int{403, 400, 404}},
+	{method: "POST", path: "/v1/chats/:id/messages", id: "sendMessage", summary: "Send a prompt and stream the reply", tag: "chats", auth: true,
+		request: controlers.MessageRequest{}, status: 200, stream: true, errors: []int{403, 400, 404, 503}},
+
+	{method: "POST", path: "/auth/register", id: "legacyRegister", summary: "Use POST /v1/auth/register", tag: "legacy", deprecated: true,
+		request: controlers.RegisterRequest{}, status: 201, response: controlers.InfoResponse{}, errors: []int{400, 409, 428}},
+	{method: "POST", path: "/auth/login", id: "legacyLogin", summary: "Use POST /v1/auth/login", tag: "legacy", deprecated: true,
+		request: controlers.LoginRequest{}, status: 200, response: controlers.LoginResponse{}, errors: []int{400, 403, 428}},
+	{method: "GET", path: "/me", id: "legacyGetProfile", summary: "Use GET /v1/me", tag: "legacy", deprecated: true, auth: true,
+		status: 200, response: controlers.UserResponse{}, errors: []int{403, 404}},
+	{method: "POST", path: "/chat/create", id: "legacyCreateChat", summary: "Use POST /v1/chats", tag: "legacy", deprecated: true, auth: true,
+		request: controlers.CreateChatRequest{}, requestOptional: true, status: 201, response: controlers.ChatCreatedResponse{}, errors: []int{403, 400, 404}},
+	{method: "POST", path: "/chat/delete", id: "legacyDeleteChat", summary: "Use DELETE /v1/chats/{id}", tag: "legacy", deprecated: true, auth: true,
+		request: controlers.LegacyDeleteChatRequest{}, status: 200, response: controlers.InfoResponse{}, errors: []int{403, 400, 404}},
+	{method: "GET", path: "/chat/getall", id: "legacyListChats", summary: "Use GET /v1/chats", tag: "legacy", deprecated: true, auth: true,
+		status: 200, response: controlers.ChatListResponse{}, errors: []int{403, 404}},
+	{method: "POST", path: "/chat/message", id: "legacySendMessage", summary: "Use POST /v1/chats/{id}/messages", tag: "legacy", deprecated: true, auth: true,
+		request: controlers.LegacyMessageRequest{}, status: 200, stream: true, errors: []int{403, 400, 404, 503}},
+}
+
+// sseDescription documents the event stream; the data payloads are the
+// DeltaEvent and ErrorResponse component schemas.
+const sseDescription = `Server-sent events. While the reply streams, each unnamed event carries a DeltaEvent:
+
+    data: {"delta":"Paris"}
+
+A failure mid-stream sends ` + "`event: error`" + ` whose data is an ErrorResponse, the same body as
+every JSON error reply:
+
+    event: error
+    data: {"code":"upstream.llm_unavailable","error":"The AI model failed to respond","requestId":"..."}
+
+The stream ends with:
+
+    event: done
+    data: "end"`
+
+// Spec returns the API document. It is built once; an error means the route
+// table or a handler type can't be described and is a programming error.
+var Spec = sync.OnceValues(build)
+
+var ginParam = regexp.MustCompile(`:(\w+)`)
+
+// paramPatterns constrains path parameters by name.
+var paramPatterns = map[string]string{
+	"id":       objectIDPattern,
+	"provider": "^[a-z0-9-]+$",
+}
+
+func build() (*openapi3.T, error) {
+	doc := &openapi3.T{
+		OpenAPI: "3.0.3",
+		Info: &openapi3.Info{
+			Title:       "ChatApp API",
+			Version:     "1.0.0",
+			Description: "Chat backend with streaming Gemini replies. Routes outside /v1 are deprecated aliases.",
+		},
+		Paths: openapi3.NewPaths(),
+		Components: &openapi3.Components{
+			Schemas: openapi3.Schemas{},
+			SecuritySchemes: openapi3.SecuritySchemes{
+				"bearerAuth": &openapi3.SecuritySchemeRef{Value: openapi3.NewJWTSecurityScheme().
+					WithDescription("A JWT from login, or a personal API key (cak_...). API keys are limited to their scopes: " +
+						strings.Join(libs.Scopes, ", ") + ".")},
+			},
+		},
+	}
+
+	for _, v := range []any{libs.ErrorResponse{}, controlers.DeltaEvent{}} {
+		if _, err := component(doc, v); err != nil {
+			return nil, err
+		}
+	}
+	codes := libs.ErrorCodes()
+	sort.Slice(codes, func(i, j int) bool { return codes[i] < codes[j] })
+	codeSchema := doc.Components.Schemas["ErrorResponse"].Value.Properties["code"].Value
+	for _, code := range codes {
+		codeSchema.Enum = append(codeSchema.Enum, string(code))
+	}
+
+	for _, op := range operations {
+		o, err := buildOperation(doc, op)
+		if err != nil {
+			return nil, fmt.Errorf("%s %s: %w", op.method, op.path, err)
+		}
+		path := ginParam.ReplaceAllString(op.path, "{$1}")
+		item := doc.Paths.Value(path)
+		if item == nil {
+			item = &openapi3.PathItem{}
+			doc.Paths.Set(path, item)
+		}
+		item.SetOperation(op.method, o)
+	}
+
+	if err := doc.Validate(context.Background()); err != nil {
+		return nil, fmt.Errorf("invalid OpenAPI document: %w", err)
+	}
+	return doc, nil
+}
+
+func buildOperation(doc *openapi3.T, op operation) (*openapi3.Operation, error) {
+	o := &openapi3.Operation{
+		OperationID: op.id,
+		Summary:     op.summary,
+		Tags:        []string{op.tag},
+		Deprecated:  op.deprecated,
+		Responses:   openapi3.NewResponses(),
+	}
+	// Every status is listed explicitly; drop the empty default NewResponses adds
+	o.Responses.Delete("default")
+	if op.deprecated {
+		o.Description = "Deprecated alias: responses carry `Deprecation` and `Link: <...>; rel=\"successor-version\"` headers."
+	}
+	if op.auth {
+		o.Security = &openapi3.SecurityRequirements{{"bearerAuth": []string{}}}
+	}
+
+	for _, name := range ginParam.FindAllStringSubmatch(op.path, -1) {
+		p := openapi3.NewPathParameter(name[1]).WithSchema(&openapi3.Schema{
+			Type:    &openapi3.Types{"string"},
+			Pattern: paramPatterns[name[1]],
+		})
+		o.AddParameter(p)
+	}
+	for _, name := range op.query {
+		o.AddParameter(openapi3.NewQueryParameter(name).WithSchema(openapi3.NewStringSchema()))
+	}
+
+	if op.request != nil {
+		ref, err := component(doc, op.request)
+		if err != nil {
+			return nil, err
+		}
+		body := openapi3.NewRequestBody().WithJSONSchemaRef(ref)
+		body.Required = !op.requestOptional
+		o.RequestBody = &openapi3.RequestBodyRef{Value: body}
+	}
+
+	success := openapi3.NewResponse().WithDescription(http.StatusText(op.status))
+	switch {
+	case op.status >= 300 && op.status < 400:
+		success.Headers = openapi3.Headers{"Location": &openapi3.HeaderRef{Value: &openapi3.Header{
+			Parameter: openapi3.Parameter{Schema: &openapi3.SchemaRef{Value: openapi3.NewStringSchema()}},
+		}}}
+	case op.stream:
+		success = success.WithDescription(sseDescription)
+		success.Content = openapi3.Content{"text/event-stream": &openapi3.MediaType{
+			Schema: &openapi3.SchemaRef{Value: openapi3.NewStringSchema()},
+		}}
+	case op.file != "":
+		success.Content = openapi3.Content{op.file: &openapi3.MediaType{
+			Schema: &openapi3.SchemaRef{Value: openapi3.NewStringSchema().WithFormat("binary")},
+		}}
+	case op.response != nil:
+		ref, err := component(doc, op.response)
+		if err != nil {
+			return nil, err
+		}
+		success.Content = openapi3.NewContentWithJSONSchemaRef(ref)
+	default:
+		success.Content = openapi3.NewContentWithJSONSchema(openapi3.NewObjectSchema())
+	}
+	o.AddResponse(op.status, success)
+
+	statuses := append([]int{http.StatusTooManyRequests, http.StatusInternalServerError}, op.errors...)
+	if op.auth {
+		statuses = append(statuses, http.StatusUnauthorized)
+	}
+	if op.request != nil || strings.Contains(op.path, ":") {
+		statuses = append(statuses, http.StatusBadRequest)
+	}
+	sort.Ints(statuses)
+	errRef := &openapi3.SchemaRef{
+		Ref:   "#/components/schemas/ErrorResponse",
+		Value: doc.Components.Schemas["ErrorResponse"].Value,
+	}
+	for i, status := range statuses {
+		if i > 0 && statuses[i-1] == status {
+			continue
+		}
+		o.AddResponse(status, openapi3.NewResponse().
+			WithDescription(http.StatusText(status)).
+			WithContent(openapi3.NewContentWithJSONSchemaRef(errRef)))
+	}
+	return o, nil
+}
+
+// component registers v's type under its Go name in components/schemas and
+// returns a reference to it. Anonymous types are inlined.
+func component(doc *openapi3.T, v any) (*openapi3.SchemaRef, error) {
+	schema, err := schemaFor(v)
+	if err != nil {
+		return nil, err
+	}
+	name := reflect.TypeOf(v).Name()
+	if name == "" {
+		return &openapi3.SchemaRef{Value: schema}, nil
+	}
+	doc.Components.Schemas[name] = &openapi3.SchemaRef{Value: schema}
+	return &openapi3.SchemaRef{Ref: "#/components/schemas/" + name, Value: schema}, nil
+}
+
+// CheckRoutes reports routes registered on the engine that the document
+// doesn't describe, and documented operations with no route, so the two
+// can't drift apart unnoticed.
+func CheckRoutes(routes gin.RoutesInfo) error {
+	documented := map[string]bool{}
+	for _, op := range operations {
+		documented[op.method+" "+op.path] = true
+	}
+
+	var problems []string
+	for _, r := range routes {
+		key := r.Method + " " + r.Path
+		if r.Path == "/metrics" {
+			// scraped by Prometheus, not part of the client API
+			continue
+		}
+		if !documented[key] {
+			problems = append(problems, "undocumented route "+key)
+		}
+		delete(documented, key)
+	}
+	for key := range documented {
+		problems = append(problems, "documented operation without a route: "+key)
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return fmt.Errorf("openapi: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sarwanazhar/chatappbackend/model"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// touchInterval limits last_used_at writes to one per key per interval, so
+// a busy script doesn't turn every request into a database write.
+const touchInterval = time.Minute
+
+type APIKeys struct {
+	coll    *mongo.Collection
+	timeout time.Duration
+}
+
+// Create stores key, assigning its ID and creation time.
+func (r *APIKeys) Create(ctx context.Context, key *model.APIKey) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	key.ID = primitive.NewObjectID()
+	key.CreatedAt = time.Now()
+	if _, err := r.coll.InsertOne(ctx, key); err != nil {
+		return fmt.Errorf("failed to create api key: %w", err)
+	}
+	return nil
+}
+
+// ListByUser returns the user's keys, newest first.
+func (r *APIKeys) ListByUser(ctx context.Context, userID primitive.ObjectID) ([]model.APIKey, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	cursor, err := r.coll.Find(ctx, bson.M{"user_id": userID}, options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list api keys: %w", err)
+	}
+	keys := []model.APIKey{}
+	if err := cursor.All(ctx, &keys); err != nil {
+		return nil, fmt.Errorf("failed to decode api keys: %w", err)
+	}
+	return keys, nil
+}
+
+// CountByUser returns how many keys the user has.
+func (r *APIKeys) CountByUser(ctx context.Context, userID primitive.ObjectID) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	n, err := r.coll.CountDocuments(ctx, bson.M{"user_id": userID})
+	if err != nil {
+		return 0, fmt.Errorf("failed to count api keys: %w", err)
+	}
+	return n, nil
+}
+
+func (r *APIKeys) FindByHash(ctx context.Context, hash string) (*model.APIKey, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	var key model.APIKey
+	err := r.coll.FindOne(ctx, bson.M{"hash": hash}).Decode(&key)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, fmt.Errorf("api key %w", ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error finding api key: %w", err)
+	}
+	return &key, nil
+}
+
+// Touch records that the key was just used.
+func (r *APIKeys) Touch(ctx context.Context, id primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	now := time.Now()
+	_, err := r.coll.UpdateOne(ctx,
+		bson.M{"_id": id, "$or": bson.A{
+			bson.M{"last_used_at": bson.M{"$exists": false}},
+			bson.M{"last_used_at": bson.M{"$lt": now.Add(-touchInterval)}},
+		}},
+		bson.M{"$set": bson.M{"last_used_at": now}},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update api key: %w", err)
+	}
+	return nil
+}
+
+// DeleteOwned revokes the key if it belongs to userID.
+func (r *APIKeys) DeleteOwned(ctx context.Context, id, userID primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	res, err := r.coll.DeleteOne(ctx, bson.M{"_id": id, "user_id": userID})
+	if err != nil {
+		return fmt.Errorf("failed to delete api key: %w", err)
+	}
+	if res.DeletedCount == 0 {
+		return fmt.Errorf("api key %w", ErrNotFound)
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// LoginAttempts counts recent failed logins per key (an email address or a
+// client IP). Records expire through a TTL index once forgotten.
+type LoginAttempts struct {
+	coll    *mongo.Collection
+	timeout time.Duration
+}
+
+// LoginAttempt is the failure record of one key.
+type LoginAttempt struct {
+	Key           string    `bson:"_id"`
+	Failures      int       `bson:"failures"`
+	LastFailureAt time.Time `bson:"last_failure_at"`
+	// BlockedUntil is when the key may try again, zero if it may now.
+	BlockedUntil time.Time `bson:"blocked_until,omitempty"`
+	ExpiresAt    time.Time `bson:"expires_at"`
+}
+
+// Get returns the key's record, or an empty one if it has no recent
+// failures.
+func (r *LoginAttempts) Get(ctx context.Context, key string) (*LoginAttempt, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	attempt := &LoginAttempt{Key: key}
+	err := r.coll.FindOne(ctx, bson.M{"_id": key}).Decode(attempt)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return &LoginAttempt{Key: key}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load login attempts: %w", err)
+	}
+	return attempt, nil
+}
+
+// Fail records a failure for key and blocks it for delay(failures), where
+// failures counts this one and those within window before it.
+func (r *LoginAttempts) Fail(ctx context.Context, key string, window time.Duration, delay func(failures int) time.Duration) (*LoginAttempt, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	now := time.Now()
+	// One pipeline update so concurrent failures each count: the counter
+	// restarts at 1 when the previous failure is older than window.
+	var attempt LoginAttempt
+	err := r.coll.FindOneAndUpdate(ctx,
+		bson.M{"_id": key},
+		mongo.Pipeline{{{Key: "$set", Value: bson.M{
+			"failures": bson.M{"$cond": bson.A{
+				bson.M{"$gt": bson.A{"$last_failure_at", now.Add(-window)}},
+				bson.M{"$add": bson.A{"$failures", 1}},
+				1,
+			}},
+			"last_failure_at": now,
+			"expires_at":      now.Add(window),
+		}}}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&attempt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record login failure: %w", err)
+	}
+
+	wait := delay(attempt.Failures)
+	if wait <= 0 {
+		return &attempt, nil
+	}
+	attempt.BlockedUntil = now.Add(wait)
+	set := bson.M{"blocked_until": attempt.BlockedUntil}
+	if attempt.BlockedUntil.After(attempt.ExpiresAt) {
+		// Keep the record at least as long as the block
+		attempt.ExpiresAt = attempt.BlockedUntil
+		set["expires_at"] = attempt.ExpiresAt
+	}
+	if _, err := r.coll.UpdateOne(ctx, bson.M{"_id": key}, bson.M{"$set": set}); err != nil {
+		return nil, fmt.Errorf("failed to block login: %w", err)
+	}
+	return &attempt, nil
+}
+
+// Reset forgets the key's failures, e.g. after a successful login.
+func (r *LoginAttempts) Reset(ctx context.Context, key string) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	if _, err := r.coll.DeleteOne(ctx, bson.M{"_id": key}); err != nil {
+		return fmt.Errorf("failed to reset login attempts: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/sarwanazhar/chatappbackend/model"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+type Chats struct {
+	coll    *mongo.Collection
+	timeout time.Duration
+}
+
+// Create inserts a new, empty chat owned by userID.
+func (r *Chats) Create(ctx context.Context, userID primitive.ObjectID, title string) (*model.Chat, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	chat := newChat(userID, title)
+	if _, err := r.coll.InsertOne(ctx, chat); err != nil {
+		return nil, err
+	}
+	return chat, nil
+}
+
+func newChat(userID primitive.ObjectID, title string) *model.Chat {
+	now := time.Now()
+	return &model.Chat{
+		ID:        primitive.NewObjectID(),
+		UserID:    userID,
+		Title:     title,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+}
+
+// ListByUser returns the user's chats, newest first, each with its messages
+// in chronological order.
+func (r *Chats) ListByUser(ctx context.Context, userID primitive.ObjectID) ([]model.Chat, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.M{"created_at": -1})
+	cursor, err := r.coll.Find(ctx, bson.M{"user_id": userID}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch chats: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var chats []model.Chat
+	if err := cursor.All(ctx, &chats); err != nil {
+		return nil, fmt.Errorf("failed to decode chats: %w", err)
+	}
+
+	for i := range chats {
+		sort.Slice(chats[i].Messages, func(a, b int) bool {
+			return chats[i].Messages[a].CreatedAt.Before(chats[i].Messages[b].CreatedAt)
+		})
+	}
+	return chats, nil
+}
+
+// FindOwned returns the chat only if it belongs to userID.
+func (r *Chats) FindOwned(ctx context.Context, chatID, userID primitive.ObjectID) (*model.Chat, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	var chat model.Chat
+	err := r.coll.FindOne(ctx, ownedFilter(chatID, userID)).Decode(&chat)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, fmt.Errorf("chat %w", ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error finding chat: %w", err)
+	}
+	return &chat, nil
+}
+
+// DeleteOwned deletes the chat if it belongs to userID and returns
+// ErrNotFound otherwise.
+func (r *Chats) DeleteOwned(ctx context.Context, chatID, userID primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	res, err := r.coll.DeleteOne(ctx, ownedFilter(chatID, userID))
+	if err != nil {
+		return fmt.Errorf("failed to delete chat: %w", err)
+	}
+	if res.DeletedCount == 0 {
+		return fmt.Errorf("chat %w", ErrNotFound)
+	}
+	return nil
+}
+
+// AppendMessage pushes msg onto the chat and bumps its updated_at.
+func (r *Chats) AppendMessage(ctx context.Context, chatID, userID primitive.ObjectID, msg model.Message) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	_, err := r.coll.UpdateOne(ctx, ownedFilter(chatID, userID), bson.M{
+		"$push": bson.M{"messages": msg}, "$set": bson.M{"updated_at": time.Now()},
+	})
+	return err
+}
+
+func ownedFilter(chatID, userID primitive.ObjectID) bson.M {
+	return bson.M{"_id": chatID, "user_id": userID}
+}
+
+// Import inserts copies of chats for userID, each under a fresh ID, and
+// returns how many were written.
+func (r *Chats) Import(ctx context.Context, userID primitive.ObjectID, chats []model.Chat) (int, error) {
+	if len(chats) == 0 {
+		return 0, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	docs := make([]any, len(chats))
+	for i, chat := range chats {
+		chat.ID = primitive.NewObjectID()
+		chat.UserID = userID
+		docs[i] = chat
+	}
+	res, err := r.coll.InsertMany(ctx, docs)
+	if err != nil {
+		return 0, fmt.Errorf("failed to import chats: %w", err)
+	}
+	return len(res.InsertedIDs), nil
+}
+
+// Rename sets the chat's title if it belongs to userID and returns the
+// updated chat.
+func (r *Chats) Rename(ctx context.Context, chatID, userID primitive.ObjectID, title string) (*model.Chat, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	var chat model.Chat
+	err := r.coll.FindOneAndUpdate(ctx, ownedFilter(chatID, userID),
+		bson.M{"$set": bson.M{"title": title, "updated_at": time.Now()}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&chat)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, fmt.Errorf("chat %w", ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to rename chat: %w", err)
+	}
+	return &chat, nil
+}
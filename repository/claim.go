@@ -0,0 +1,40 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// ClaimUnverified hands an account whose email was never verified to the
+// owner of that address, who has just proved it some other way, e.g.
+// through an identity provider. Whoever registered the account may not
+// have been them, so everything that let them in goes: the password, the
+// second factor, a pending email change or deletion, every access token,
+// and the API keys, sessions and outstanding link tokens. So does what
+// they left behind, the chats and data exports, which the owner must not
+// inherit. It returns ErrNotFound if the email was verified in the
+// meantime.
+func (r *Repositories) ClaimUnverified(ctx context.Context, id primitive.ObjectID) error {
+	now := time.Now()
+	err := r.Users.updateWhere(ctx, id, bson.M{"email_verified": bson.M{"$ne": true}}, bson.M{
+		"$set":   bson.M{"email_verified": true, "email_verified_at": now, "tokens_revoked_at": now},
+		"$unset": bson.M{"password": "", "mfa": "", "pending_email": "", "delete_at": ""},
+	})
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	for _, coll := range []*mongo.Collection{r.Chats.coll, r.APIKeys.coll, r.Sessions.coll, r.Exports.coll, r.Exports.chunks, r.Tokens.coll} {
+		if _, err := coll.DeleteMany(ctx, bson.M{"user_id": id}); err != nil {
+			return fmt.Errorf("deleting from %s: %w", coll.Name(), err)
+		}
+	}
+	return nil
+}
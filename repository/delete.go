@@ -0,0 +1,73 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// DeleteUser removes the user and everything they own: chats, API keys,
+// sessions, data exports and outstanding link tokens. The user is first
+// marked as purging, which CancelDeletion refuses, and the user document
+// goes last, so a failure part way leaves an account that can be deleted
+// again rather than orphans no one can reach. A user that doesn't exist
+// yields ErrNotFound.
+func (r *Repositories) DeleteUser(ctx context.Context, id primitive.ObjectID) error {
+	return r.deleteUserWhere(ctx, bson.M{"_id": id})
+}
+
+// deleteUserWhere is DeleteUser for the user matching filter, which must
+// include the _id.
+func (r *Repositories) deleteUserWhere(ctx context.Context, filter bson.M) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	// Claimed in the same write that checks filter, so a cancellation
+	// racing the purge either lands first or is refused
+	id := filter["_id"]
+	res, err := r.Users.coll.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"purging": true}})
+	if err != nil {
+		return fmt.Errorf("failed to claim user: %w", err)
+	}
+	if res.MatchedCount == 0 {
+		return fmt.Errorf("user %w", ErrNotFound)
+	}
+
+	for _, coll := range []*mongo.Collection{r.Chats.coll, r.APIKeys.coll, r.Sessions.coll, r.Exports.coll, r.Exports.chunks, r.Tokens.coll} {
+		if _, err := coll.DeleteMany(ctx, bson.M{"user_id": id}); err != nil {
+			return fmt.Errorf("deleting from %s: %w", coll.Name(), err)
+		}
+	}
+	if _, err := r.Users.coll.DeleteOne(ctx, bson.M{"_id": id, "purging": true}); err != nil {
+		return fmt.Errorf("failed to delete user: %w", err)
+	}
+	return nil
+}
+
+// PurgeDeleted removes every user whose deletion time has passed, with
+// everything they own, and returns how many went. A user who cancelled in
+// the meantime is skipped. It stops at the first failure; the rest are
+// picked up by the next run.
+func (r *Repositories) PurgeDeleted(ctx context.Context, now time.Time) (int, error) {
+	ids, err := r.Users.DueForDeletion(ctx, now)
+	if err != nil {
+		return 0, err
+	}
+	purged := 0
+	for _, id := range ids {
+		err := r.deleteUserWhere(ctx, bson.M{"_id": id, "delete_at": bson.M{"$lte": now}})
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return purged, fmt.Errorf("deleting user %s: %w", id.Hex(), err)
+		}
+		purged++
+	}
+	return purged, nil
+}
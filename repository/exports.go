@@ -0,0 +1,201 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/sarwanazhar/chatappbackend/model"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// exportChunkSize keeps each stored piece of an export file well below
+// MongoDB's 16MB document limit.
+const exportChunkSize = 1 << 20
+
+type Exports struct {
+	coll    *mongo.Collection
+	chunks  *mongo.Collection
+	timeout time.Duration
+}
+
+type exportChunk struct {
+	ExportID  primitive.ObjectID `bson:"export_id"`
+	UserID    primitive.ObjectID `bson:"user_id"`
+	N         int                `bson:"n"`
+	Data      []byte             `bson:"data"`
+	ExpiresAt time.Time          `bson:"expires_at"`
+}
+
+// Create stores a pending export, assigning its ID and creation time.
+func (r *Exports) Create(ctx context.Context, export *model.Export) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	export.ID = primitive.NewObjectID()
+	export.CreatedAt = time.Now()
+	export.Status = model.ExportPending
+	if _, err := r.coll.InsertOne(ctx, export); err != nil {
+		return fmt.Errorf("failed to create export: %w", err)
+	}
+	return nil
+}
+
+// FindByID returns the export with id.
+func (r *Exports) FindByID(ctx context.Context, id primitive.ObjectID) (*model.Export, error) {
+	return r.findOne(ctx, bson.M{"_id": id})
+}
+
+// FindOwned returns the export if it belongs to userID.
+func (r *Exports) FindOwned(ctx context.Context, id, userID primitive.ObjectID) (*model.Export, error) {
+	return r.findOne(ctx, bson.M{"_id": id, "user_id": userID})
+}
+
+// FindPending returns the user's pending export started after since, the
+// one still being built.
+func (r *Exports) FindPending(ctx context.Context, userID primitive.ObjectID, since time.Time) (*model.Export, error) {
+	return r.findOne(ctx, bson.M{"user_id": userID, "status": model.ExportPending, "created_at": bson.M{"$gt": since}})
+}
+
+func (r *Exports) findOne(ctx context.Context, filter bson.M) (*model.Export, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	var export model.Export
+	err := r.coll.FindOne(ctx, filter, options.FindOne().SetSort(bson.D{{Key: "created_at", Value: -1}})).Decode(&export)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, fmt.Errorf("export %w", ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error finding export: %w", err)
+	}
+	return &export, nil
+}
+
+// ExportFile stores an export's file as it is written, a chunk at a time,
+// so the whole file is never held in memory. Complete marks the export
+// ready once everything is written.
+type ExportFile struct {
+	r         *Exports
+	ctx       context.Context
+	export    *model.Export
+	expiresAt time.Time
+	buf       []byte
+	chunks    int
+	size      int64
+}
+
+// NewFile starts the file of export, kept until expiresAt.
+func (r *Exports) NewFile(ctx context.Context, export *model.Export, expiresAt time.Time) *ExportFile {
+	return &ExportFile{r: r, ctx: ctx, export: export, expiresAt: expiresAt, buf: make([]byte, 0, exportChunkSize)}
+}
+
+func (f *ExportFile) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n := min(len(p), exportChunkSize-len(f.buf))
+		f.buf = append(f.buf, p[:n]...)
+		p = p[n:]
+		written += n
+		if len(f.buf) == exportChunkSize {
+			if err := f.flush(); err != nil {
+				return written, err
+			}
+		}
+	}
+	return written, nil
+}
+
+// flush stores what is buffered as the next chunk.
+func (f *ExportFile) flush() error {
+	if len(f.buf) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(f.ctx, f.r.timeout)
+	defer cancel()
+
+	_, err := f.r.chunks.InsertOne(ctx, exportChunk{
+		ExportID:  f.export.ID,
+		UserID:    f.export.UserID,
+		N:         f.chunks,
+		Data:      f.buf,
+		ExpiresAt: f.expiresAt,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to store export file: %w", err)
+	}
+	f.chunks++
+	f.size += int64(len(f.buf))
+	f.buf = f.buf[:0]
+	return nil
+}
+
+// Complete stores the rest of the file and marks the export ready until
+// the file expires.
+func (f *ExportFile) Complete() error {
+	if err := f.flush(); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(f.ctx, f.r.timeout)
+	defer cancel()
+
+	now := time.Now()
+	_, err := f.r.coll.UpdateOne(ctx, bson.M{"_id": f.export.ID}, bson.M{"$set": bson.M{
+		"status":       model.ExportReady,
+		"size":         f.size,
+		"chunks":       f.chunks,
+		"completed_at": now,
+		"expires_at":   f.expiresAt,
+	}})
+	if err != nil {
+		return fmt.Errorf("failed to complete export: %w", err)
+	}
+	export := f.export
+	export.Status = model.ExportReady
+	export.Size = f.size
+	export.Chunks = f.chunks
+	export.CompletedAt = &now
+	export.ExpiresAt = f.expiresAt
+	return nil
+}
+
+// Fail marks the export as failed and drops any part of its file that was
+// already stored.
+func (r *Exports) Fail(ctx context.Context, id primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	if _, err := r.coll.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"status": model.ExportFailed}}); err != nil {
+		return fmt.Errorf("failed to update export: %w", err)
+	}
+	if _, err := r.chunks.DeleteMany(ctx, bson.M{"export_id": id}); err != nil {
+		return fmt.Errorf("failed to delete export file: %w", err)
+	}
+	return nil
+}
+
+// WriteFile copies a ready export's file to w one chunk at a time, so a
+// slow download never holds a query open for long.
+func (r *Exports) WriteFile(ctx context.Context, export *model.Export, w io.Writer) error {
+	for n := range export.Chunks {
+		var chunk exportChunk
+		qctx, cancel := context.WithTimeout(ctx, r.timeout)
+		err := r.chunks.FindOne(qctx, bson.M{"export_id": export.ID, "n": n}).Decode(&chunk)
+		cancel()
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return fmt.Errorf("export chunk %d %w", n, ErrNotFound)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read export file: %w", err)
+		}
+		if _, err := w.Write(chunk.Data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/sarwanazhar/chatappbackend/model"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// mfaNotEnabled matches users whose second factor isn't switched on yet.
+var mfaNotEnabled = bson.M{"mfa.enabled": bson.M{"$ne": true}}
+
+// StartMFAEnrollment stores a new, unconfirmed TOTP secret, replacing any
+// earlier unconfirmed one. It returns ErrNotFound if MFA is already enabled.
+func (r *Users) StartMFAEnrollment(ctx context.Context, id primitive.ObjectID, sealedSecret string) error {
+	return r.updateWhere(ctx, id, mfaNotEnabled, bson.M{"$set": bson.M{"mfa": model.MFA{Secret: sealedSecret}}})
+}
+
+// EnableMFA switches on the enrolled secret. step is the TOTP step of the
+// confirming code, which can't be used again.
+func (r *Users) EnableMFA(ctx context.Context, id primitive.ObjectID, recoveryHashes []string, step int64) error {
+	filter := bson.M{"mfa.secret": bson.M{"$exists": true}, "mfa.enabled": bson.M{"$ne": true}}
+	return r.updateWhere(ctx, id, filter, bson.M{"$set": bson.M{
+		"mfa.enabled":        true,
+		"mfa.enabled_at":     time.Now(),
+		"mfa.recovery_codes": recoveryHashes,
+		"mfa.last_step":      step,
+	}})
+}
+
+// UseTOTPStep records step as used. It returns ErrNotFound when a code from
+// that step or a later one was already accepted, i.e. on replay.
+func (r *Users) UseTOTPStep(ctx context.Context, id primitive.ObjectID, step int64) error {
+	return r.updateWhere(ctx, id, bson.M{"mfa.last_step": bson.M{"$lt": step}}, bson.M{"$set": bson.M{"mfa.last_step": step}})
+}
+
+// UseRecoveryCode removes the code with hash so it works only once. It
+// returns ErrNotFound when the user has no such unused code.
+func (r *Users) UseRecoveryCode(ctx context.Context, id primitive.ObjectID, hash string) error {
+	return r.updateWhere(ctx, id, bson.M{"mfa.recovery_codes": hash}, bson.M{"$pull": bson.M{"mfa.recovery_codes": hash}})
+}
+
+// SetRecoveryCodes replaces every recovery code.
+func (r *Users) SetRecoveryCodes(ctx context.Context, id primitive.ObjectID, hashes []string) error {
+	return r.update(ctx, id, bson.M{"mfa.recovery_codes": hashes})
+}
+
+// DisableMFA removes the second factor and any enrollment in progress.
+func (r *Users) DisableMFA(ctx context.Context, id primitive.ObjectID) error {
+	return r.updateWhere(ctx, id, nil, bson.M{"$unset": bson.M{"mfa": ""}})
+}
@@ -0,0 +1,118 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sarwanazhar/chatappbackend/model"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// DefaultChatTitle names the chat every new account starts with.
+const DefaultChatTitle = "Chat"
+
+// Registration is what Register created for a new account.
+type Registration struct {
+	User *model.User
+	Chat *model.Chat
+}
+
+// insert is one document written as part of a multi-document operation,
+// with enough information to delete it again.
+type insert struct {
+	coll *mongo.Collection
+	id   any
+	doc  any
+}
+
+// Register creates user together with the documents every account needs
+// (currently the default chat) as one unit: either all of them exist
+// afterwards or none do. On a replica set or sharded cluster this is a
+// transaction; a standalone server doesn't support those, so the inserts run
+// one by one and earlier ones are deleted again if a later one fails.
+//
+// A user whose email is already registered yields ErrDuplicate.
+func (r *Repositories) Register(ctx context.Context, user *model.User) (*Registration, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	prepareUser(user)
+	chat := newChat(user.ID, DefaultChatTitle)
+	inserts := []insert{
+		{coll: r.Users.coll, id: user.ID, doc: user},
+		{coll: r.Chats.coll, id: chat.ID, doc: chat},
+	}
+
+	err := errTransactionsUnsupported
+	if !r.standalone.Load() {
+		err = r.insertInTransaction(ctx, inserts)
+		if errors.Is(err, errTransactionsUnsupported) {
+			r.standalone.Store(true)
+		}
+	}
+	if errors.Is(err, errTransactionsUnsupported) {
+		err = insertWithCompensation(ctx, inserts)
+	}
+
+	if mongo.IsDuplicateKeyError(err) {
+		return nil, fmt.Errorf("user %w", ErrDuplicate)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("registering user: %w", err)
+	}
+	return &Registration{User: user, Chat: chat}, nil
+}
+
+var errTransactionsUnsupported = errors.New("transactions are not supported by this deployment")
+
+func (r *Repositories) insertInTransaction(ctx context.Context, inserts []insert) error {
+	session, err := r.db.Client().StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(context.Background())
+
+	_, err = session.WithTransaction(ctx, func(ctx context.Context) (any, error) {
+		for _, in := range inserts {
+			if _, err := in.coll.InsertOne(ctx, in.doc); err != nil {
+				return nil, err
+			}
+		}
+		return nil, nil
+	})
+
+	var srvErr mongo.ServerError
+	// 20 is IllegalOperation: "Transaction numbers are only allowed on a
+	// replica set member or mongos".
+	if errors.As(err, &srvErr) && srvErr.HasErrorCode(20) {
+		return errTransactionsUnsupported
+	}
+	return err
+}
+
+// compensationTimeout bounds the cleanup after a failed standalone insert.
+const compensationTimeout = 10 * time.Second
+
+// insertWithCompensation is the standalone fallback. Unlike a transaction it
+// can't survive the process dying between two inserts, but any insert error
+// removes the documents written before it.
+func insertWithCompensation(ctx context.Context, inserts []insert) error {
+	for i, in := range inserts {
+		if _, err := in.coll.InsertOne(ctx, in.doc); err != nil {
+			// Undo with a fresh context: ctx may be the reason we failed.
+			undoCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), compensationTimeout)
+			defer cancel()
+			var undoErrs []error
+			for j := i - 1; j >= 0; j-- {
+				if _, delErr := inserts[j].coll.DeleteOne(undoCtx, bson.M{"_id": inserts[j].id}); delErr != nil {
+					undoErrs = append(undoErrs, fmt.Errorf("undoing insert into %s: %w", inserts[j].coll.Name(), delErr))
+				}
+			}
+			return errors.Join(append([]error{err}, undoErrs...)...)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package repository
+
+import (
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// ErrNotFound is returned when a lookup matches no document.
+var ErrNotFound = errors.New("not found")
+
+// ErrDuplicate is returned when an insert collides with a unique index,
+// e.g. registering an email that is already taken.
+var ErrDuplicate = errors.New("already exists")
+
+const (
+	UsersCollection    = "users"
+	ChatsCollection    = "chat"
+	TokensCollection   = "tokens"
+	APIKeysCollection  = "api_keys"
+	SessionsCollection = "sessions"
+	ExportsCollection  = "exports"
+	// ExportChunksCollection holds export files in pieces below the
+	// document size limit.
+	ExportChunksCollection = "export_chunks"
+	SigningKeysCollection  = "signing_keys"
+
+	LoginAttemptsCollection = "login_attempts"
+)
+
+// Repositories groups every collection wrapper backed by one database.
+type Repositories struct {
+	Users   *Users
+	Chats   *Chats
+	Tokens  *Tokens
+	APIKeys *APIKeys
+	// Sessions are the sign-ins a user can see and revoke.
+	Sessions *Sessions
+	// Exports are personal data export jobs and their files.
+	Exports *Exports
+	// SigningKeys are the key pairs that sign access tokens.
+	SigningKeys *SigningKeys
+	// LoginAttempts counts failed logins for brute-force protection.
+	LoginAttempts *LoginAttempts
+
+	db      *mongo.Database
+	timeout time.Duration
+	// standalone is set once the server rejects transactions, so later
+	// registrations skip straight to the compensating path.
+	standalone atomic.Bool
+}
+
+// New wires the repositories to db. timeout bounds each individual query.
+func New(db *mongo.Database, timeout time.Duration) *Repositories {
+	return &Repositories{
+		Users:   &Users{coll: db.Collection(UsersCollection), timeout: timeout},
+		Chats:   &Chats{coll: db.Collection(ChatsCollection), timeout: timeout},
+		Tokens:  &Tokens{coll: db.Collection(TokensCollection), timeout: timeout},
+		APIKeys: &APIKeys{coll: db.Collection(APIKeysCollection), timeout: timeout},
+
+		Sessions: &Sessions{coll: db.Collection(SessionsCollection), timeout: timeout},
+		Exports:  &Exports{coll: db.Collection(ExportsCollection), chunks: db.Collection(ExportChunksCollection), timeout: timeout},
+
+		SigningKeys: &SigningKeys{coll: db.Collection(SigningKeysCollection), timeout: timeout},
+
+		LoginAttempts: &LoginAttempts{coll: db.Collection(LoginAttemptsCollection), timeout: timeout},
+
+		db:      db,
+		timeout: timeout,
+	}
+}
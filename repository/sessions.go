@@ -0,0 +1,104 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sarwanazhar/chatappbackend/model"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+type Sessions struct {
+	coll    *mongo.Collection
+	timeout time.Duration
+}
+
+// Create stores session, assigning its ID and creation time.
+func (r *Sessions) Create(ctx context.Context, session *model.Session) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	session.ID = primitive.NewObjectID()
+	session.CreatedAt = time.Now()
+	session.LastSeenAt = session.CreatedAt
+	if _, err := r.coll.InsertOne(ctx, session); err != nil {
+		return fmt.Errorf("failed to create session: %w", err)
+	}
+	return nil
+}
+
+// FindOwned returns the session if it belongs to userID.
+func (r *Sessions) FindOwned(ctx context.Context, id, userID primitive.ObjectID) (*model.Session, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	var session model.Session
+	err := r.coll.FindOne(ctx, bson.M{"_id": id, "user_id": userID}).Decode(&session)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, fmt.Errorf("session %w", ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error finding session: %w", err)
+	}
+	return &session, nil
+}
+
+// ListByUser returns the user's unexpired sessions started at or after
+// since, most recently used first. Older ones were ended wholesale, e.g. by
+// a password reset, and are left for the TTL index.
+func (r *Sessions) ListByUser(ctx context.Context, userID primitive.ObjectID, since time.Time) ([]model.Session, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	filter := bson.M{
+		"user_id":    userID,
+		"created_at": bson.M{"$gte": since},
+		"expires_at": bson.M{"$gt": time.Now()},
+	}
+	cursor, err := r.coll.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "last_seen_at", Value: -1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+	sessions := []model.Session{}
+	if err := cursor.All(ctx, &sessions); err != nil {
+		return nil, fmt.Errorf("failed to decode sessions: %w", err)
+	}
+	return sessions, nil
+}
+
+// Touch records that the session was just used, at most once per
+// touchInterval.
+func (r *Sessions) Touch(ctx context.Context, id primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	now := time.Now()
+	_, err := r.coll.UpdateOne(ctx,
+		bson.M{"_id": id, "last_seen_at": bson.M{"$lt": now.Add(-touchInterval)}},
+		bson.M{"$set": bson.M{"last_seen_at": now}},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update session: %w", err)
+	}
+	return nil
+}
+
+// DeleteOwned revokes the session if it belongs to userID.
+func (r *Sessions) DeleteOwned(ctx context.Context, id, userID primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	res, err := r.coll.DeleteOne(ctx, bson.M{"_id": id, "user_id": userID})
+	if err != nil {
+		return fmt.Errorf("failed to delete session: %w", err)
+	}
+	if res.DeletedCount == 0 {
+		return fmt.Errorf("session %w", ErrNotFound)
+	}
+	return nil
+}
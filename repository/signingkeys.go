@@ -0,0 +1,52 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sarwanazhar/chatappbackend/model"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+type SigningKeys struct {
+	coll    *mongo.Collection
+	timeout time.Duration
+}
+
+// Create stores key. Another key scheduled for the same SignFrom, made by
+// a server instance that got there first, is reported as ErrDuplicate.
+func (r *SigningKeys) Create(ctx context.Context, key *model.SigningKey) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	key.CreatedAt = time.Now()
+	_, err := r.coll.InsertOne(ctx, key)
+	if mongo.IsDuplicateKeyError(err) {
+		return fmt.Errorf("signing key %w", ErrDuplicate)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create signing key: %w", err)
+	}
+	return nil
+}
+
+// ListCurrent returns the keys not yet expired at now, the one that signs
+// last first.
+func (r *SigningKeys) ListCurrent(ctx context.Context, now time.Time) ([]model.SigningKey, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "sign_from", Value: -1}})
+	cursor, err := r.coll.Find(ctx, bson.M{"expires_at": bson.M{"$gt": now}}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("error listing signing keys: %w", err)
+	}
+	var keys []model.SigningKey
+	if err := cursor.All(ctx, &keys); err != nil {
+		return nil, fmt.Errorf("error decoding signing keys: %w", err)
+	}
+	return keys, nil
+}
@@ -0,0 +1,125 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// UsageStats is a point-in-time summary of how the service is used.
+type UsageStats struct {
+	Users          int64       `json:"users"`
+	DisabledUsers  int64       `json:"disabledUsers"`
+	NewUsers7d     int64       `json:"newUsers7d"`
+	Chats          int64       `json:"chats"`
+	Messages       int64       `json:"messages"`
+	ActiveChats24h int64       `json:"activeChats24h"`
+	TopUsers       []UserUsage `json:"topUsers"`
+}
+
+// UserUsage is one user's share of the stored messages.
+type UserUsage struct {
+	UserID   primitive.ObjectID `json:"userId" bson:"_id"`
+	Chats    int64              `json:"chats" bson:"chats"`
+	Messages int64              `json:"messages" bson:"messages"`
+}
+
+// usageByUser groups chats into one UserUsage per owner.
+var usageByUser = bson.D{{Key: "$group", Value: bson.M{
+	"_id":      "$user_id",
+	"chats":    bson.M{"$sum": 1},
+	"messages": bson.M{"$sum": bson.M{"$size": bson.M{"$ifNull": bson.A{"$messages", bson.A{}}}}},
+}}}
+
+// Usage collects UsageStats, listing the top users by message count.
+// It scans the chat collection, so keep it to admin tooling.
+func (r *Repositories) Usage(ctx context.Context, top int) (*UsageStats, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	users, chats := r.Users.coll, r.Chats.coll
+	stats := &UsageStats{}
+	counts := []struct {
+		coll   *mongo.Collection
+		filter bson.M
+		into   *int64
+	}{
+		{users, bson.M{}, &stats.Users},
+		{users, bson.M{"disabled": true}, &stats.DisabledUsers},
+		{users, bson.M{"created_at": bson.M{"$gte": time.Now().Add(-7 * 24 * time.Hour)}}, &stats.NewUsers7d},
+		{chats, bson.M{}, &stats.Chats},
+		{chats, bson.M{"updated_at": bson.M{"$gte": time.Now().Add(-24 * time.Hour)}}, &stats.ActiveChats24h},
+	}
+	for _, c := range counts {
+		n, err := c.coll.CountDocuments(ctx, c.filter)
+		if err != nil {
+			return nil, fmt.Errorf("counting %s: %w", c.coll.Name(), err)
+		}
+		*c.into = n
+	}
+
+	cursor, err := chats.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$group", Value: bson.M{
+			"_id":      nil,
+			"messages": bson.M{"$sum": bson.M{"$size": bson.M{"$ifNull": bson.A{"$messages", bson.A{}}}}},
+		}}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("counting messages: %w", err)
+	}
+	var total []struct {
+		Messages int64 `bson:"messages"`
+	}
+	if err := cursor.All(ctx, &total); err != nil {
+		return nil, fmt.Errorf("decoding message count: %w", err)
+	}
+	if len(total) > 0 {
+		stats.Messages = total[0].Messages
+	}
+
+	stats.TopUsers = []UserUsage{}
+	if top < 1 {
+		return stats, nil
+	}
+	// The $limit right after $sort lets the server keep only the top
+	// users while sorting instead of every user
+	cursor, err = chats.Aggregate(ctx, mongo.Pipeline{
+		usageByUser,
+		{{Key: "$sort", Value: bson.D{{Key: "messages", Value: -1}}}},
+		{{Key: "$limit", Value: top}},
+	}, options.Aggregate().SetAllowDiskUse(true))
+	if err != nil {
+		return nil, fmt.Errorf("aggregating usage: %w", err)
+	}
+	if err := cursor.All(ctx, &stats.TopUsers); err != nil {
+		return nil, fmt.Errorf("decoding usage: %w", err)
+	}
+	return stats, nil
+}
+
+// UsageOf returns one user's chat and message counts.
+func (r *Repositories) UsageOf(ctx context.Context, userID primitive.ObjectID) (*UserUsage, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	cursor, err := r.Chats.coll.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"user_id": userID}}},
+		usageByUser,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("aggregating usage: %w", err)
+	}
+	var usage []UserUsage
+	if err := cursor.All(ctx, &usage); err != nil {
+		return nil, fmt.Errorf("decoding usage: %w", err)
+	}
+	if len(usage) == 0 {
+		return &UserUsage{UserID: userID}, nil
+	}
+	return &usage[0], nil
+}
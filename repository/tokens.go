@@ -0,0 +1,128 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// Tokens tracks emailed link tokens so each can be used once. Documents are
+// keyed by the hash of the token's nonce and removed by a TTL index after
+// they expire.
+type Tokens struct {
+	coll    *mongo.Collection
+	timeout time.Duration
+}
+
+type tokenRecord struct {
+	ID        string             `bson:"_id"`
+	Purpose   string             `bson:"purpose"`
+	UserID    primitive.ObjectID `bson:"user_id"`
+	CreatedAt time.Time          `bson:"created_at"`
+	ExpiresAt time.Time          `bson:"expires_at"`
+	UsedAt    *time.Time         `bson:"used_at,omitempty"`
+}
+
+// Issue records a freshly signed token.
+func (r *Tokens) Issue(ctx context.Context, hash, purpose string, userID primitive.ObjectID, expiresAt time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	_, err := r.coll.InsertOne(ctx, tokenRecord{
+		ID:        hash,
+		Purpose:   purpose,
+		UserID:    userID,
+		CreatedAt: time.Now(),
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to store token: %w", err)
+	}
+	return nil
+}
+
+// Redeem records a token that was never issued through Issue, such as a
+// solved proof-of-work challenge, as used. Redeeming it again yields
+// ErrDuplicate.
+func (r *Tokens) Redeem(ctx context.Context, hash, purpose string, expiresAt time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	now := time.Now()
+	_, err := r.coll.InsertOne(ctx, tokenRecord{
+		ID:        hash,
+		Purpose:   purpose,
+		CreatedAt: now,
+		ExpiresAt: expiresAt,
+		UsedAt:    &now,
+	})
+	if mongo.IsDuplicateKeyError(err) {
+		return fmt.Errorf("token %w", ErrDuplicate)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to redeem token: %w", err)
+	}
+	return nil
+}
+
+// Consume marks the token used and returns its user. A token that was never
+// issued, was already used, or was revoked yields ErrNotFound.
+func (r *Tokens) Consume(ctx context.Context, hash, purpose string) (primitive.ObjectID, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	var rec tokenRecord
+	err := r.coll.FindOneAndUpdate(ctx,
+		bson.M{"_id": hash, "purpose": purpose, "used_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"used_at": time.Now()}},
+	).Decode(&rec)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return primitive.NilObjectID, fmt.Errorf("token %w", ErrNotFound)
+	}
+	if err != nil {
+		return primitive.NilObjectID, fmt.Errorf("failed to consume token: %w", err)
+	}
+	return rec.UserID, nil
+}
+
+// RevokeAll invalidates the user's outstanding tokens for purpose, e.g. so
+// only the most recently emailed link works.
+func (r *Tokens) RevokeAll(ctx context.Context, userID primitive.ObjectID, purpose string) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	_, err := r.coll.UpdateMany(ctx,
+		bson.M{"user_id": userID, "purpose": purpose, "used_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"used_at": time.Now()}},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to revoke tokens: %w", err)
+	}
+	return nil
+}
+
+// LatestIssuedAt returns when the user was last sent a token for purpose,
+// or the zero time if never.
+func (r *Tokens) LatestIssuedAt(ctx context.Context, userID primitive.ObjectID, purpose string) (time.Time, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	var rec tokenRecord
+	err := r.coll.FindOne(ctx,
+		bson.M{"user_id": userID, "purpose": purpose},
+		options.FindOne().SetSort(bson.D{{Key: "created_at", Value: -1}}),
+	).Decode(&rec)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to look up tokens: %w", err)
+	}
+	return rec.CreatedAt, nil
+}
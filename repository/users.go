@@ -0,0 +1,338 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/sarwanazhar/chatappbackend/model"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+type Users struct {
+	coll    *mongo.Collection
+	timeout time.Duration
+}
+
+// prepareUser assigns the user an ID and timestamps before insertion.
+func prepareUser(user *model.User) {
+	now := time.Now()
+	user.ID = primitive.NewObjectID()
+	if user.EmailKey == "" {
+		user.EmailKey = user.Email
+	}
+	user.CreatedAt = now
+	user.UpdatedAt = now
+}
+
+// EmailExists reports whether a user is registered under the email key
+// (libs.EmailKey).
+func (r *Users) EmailExists(ctx context.Context, key string) (bool, error) {
+	_, err := r.FindByEmail(ctx, key)
+	switch {
+	case err == nil:
+		return true, nil
+	case errors.Is(err, ErrNotFound):
+		return false, nil
+	default:
+		return false, fmt.Errorf("database error during email search: %w", err)
+	}
+}
+
+// FindByEmail returns the user registered under the email key
+// (libs.EmailKey).
+func (r *Users) FindByEmail(ctx context.Context, key string) (*model.User, error) {
+	return r.findOne(ctx, bson.M{"email_key": key})
+}
+
+// FindByStoredEmail returns the user whose stored address is exactly email,
+// for addresses normalization rejects.
+func (r *Users) FindByStoredEmail(ctx context.Context, email string) (*model.User, error) {
+	return r.findOne(ctx, bson.M{"email": email})
+}
+
+// FindByIdentity returns the user linked to subject at provider.
+func (r *Users) FindByIdentity(ctx context.Context, provider, subject string) (*model.User, error) {
+	return r.findOne(ctx, bson.M{"identities": bson.M{"$elemMatch": bson.M{"provider": provider, "subject": subject}}})
+}
+
+func (r *Users) FindByID(ctx context.Context, id string) (*model.User, error) {
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user id format")
+	}
+	return r.findOne(ctx, bson.M{"_id": objID})
+}
+
+func (r *Users) findOne(ctx context.Context, filter bson.M) (*model.User, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	var user model.User
+	err := r.coll.FindOne(ctx, filter).Decode(&user)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, fmt.Errorf("user %w", ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error finding user: %w", err)
+	}
+	return &user, nil
+}
+
+// SetDisabled blocks or re-enables logins for the user. Disabling also
+// revokes every access token, so re-enabling doesn't revive old sessions.
+func (r *Users) SetDisabled(ctx context.Context, id primitive.ObjectID, disabled bool) error {
+	set := bson.M{"disabled": disabled}
+	if disabled {
+		set["tokens_revoked_at"] = time.Now()
+	}
+	return r.update(ctx, id, set)
+}
+
+// SetRole changes the user's role; model.RoleUser clears it.
+func (r *Users) SetRole(ctx context.Context, id primitive.ObjectID, role string) error {
+	if role == model.RoleUser {
+		return r.updateWhere(ctx, id, nil, bson.M{"$unset": bson.M{"role": ""}})
+	}
+	return r.update(ctx, id, bson.M{"role": role})
+}
+
+// Search returns a page of users whose email contains query (any case),
+// newest first, and how many match in total.
+func (r *Users) Search(ctx context.Context, query string, offset, limit int64) ([]model.User, int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	filter := bson.M{}
+	if query != "" {
+		filter["email"] = bson.M{"$regex": regexp.QuoteMeta(query), "$options": "i"}
+	}
+	total, err := r.coll.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count users: %w", err)
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}).
+		SetSkip(offset).
+		SetLimit(limit)
+	cursor, err := r.coll.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to search users: %w", err)
+	}
+	users := []model.User{}
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, 0, fmt.Errorf("failed to decode users: %w", err)
+	}
+	return users, total, nil
+}
+
+// SetPassword replaces the user's password hash and revokes every access
+// token issued before now, signing the user out everywhere.
+func (r *Users) SetPassword(ctx context.Context, id primitive.ObjectID, hash string) error {
+	return r.update(ctx, id, bson.M{"password": hash, "tokens_revoked_at": time.Now()})
+}
+
+// RehashPassword replaces the user's password hash with newHash, a stronger
+// hash of the same password, unless the password changed since oldHash was
+// read. Sessions are left alone.
+func (r *Users) RehashPassword(ctx context.Context, id primitive.ObjectID, oldHash, newHash string) error {
+	return r.updateWhere(ctx, id, bson.M{"password": oldHash}, bson.M{"$set": bson.M{"password": newHash}})
+}
+
+func (r *Users) update(ctx context.Context, id primitive.ObjectID, set bson.M) error {
+	return r.updateWhere(ctx, id, nil, bson.M{"$set": set})
+}
+
+// updateWhere applies update to the user if it also matches filter, and
+// returns ErrNotFound when it doesn't.
+func (r *Users) updateWhere(ctx context.Context, id primitive.ObjectID, filter bson.M, update bson.M) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	f := bson.M{"_id": id}
+	for k, v := range filter {
+		f[k] = v
+	}
+	set, _ := update["$set"].(bson.M)
+	if set == nil {
+		set = bson.M{}
+		update["$set"] = set
+	}
+	set["updated_at"] = time.Now()
+
+	res, err := r.coll.UpdateOne(ctx, f, update)
+	if err != nil {
+		return fmt.Errorf("failed to update user: %w", err)
+	}
+	if res.MatchedCount == 0 {
+		return fmt.Errorf("user %w", ErrNotFound)
+	}
+	return nil
+}
+
+// LinkIdentity lets identity sign in as the user. A user has at most one
+// identity per provider; linking a second returns ErrDuplicate.
+func (r *Users) LinkIdentity(ctx context.Context, id primitive.ObjectID, identity model.Identity) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	res, err := r.coll.UpdateOne(ctx,
+		bson.M{"_id": id, "identities.provider": bson.M{"$ne": identity.Provider}},
+		bson.M{
+			"$push": bson.M{"identities": identity},
+			"$set":  bson.M{"updated_at": time.Now()},
+		},
+	)
+	if mongo.IsDuplicateKeyError(err) {
+		return fmt.Errorf("identity %w", ErrDuplicate)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to link identity: %w", err)
+	}
+	if res.MatchedCount == 0 {
+		return fmt.Errorf("%s identity %w", identity.Provider, ErrDuplicate)
+	}
+	return nil
+}
+
+// SetPendingEmail records the address the user asked to change to.
+func (r *Users) SetPendingEmail(ctx context.Context, id primitive.ObjectID, email string) error {
+	return r.update(ctx, id, bson.M{"pending_email": email})
+}
+
+// ChangeEmail makes email, which must be the user's pending address, their
+// verified address, registered under key. It returns ErrNotFound when email
+// is no longer pending and ErrDuplicate when another account took it in the
+// meantime.
+func (r *Users) ChangeEmail(ctx context.Context, id primitive.ObjectID, email, key string) error {
+	err := r.updateWhere(ctx, id, bson.M{"pending_email": email}, bson.M{
+		"$set":   bson.M{"email": email, "email_key": key, "email_verified": true, "email_verified_at": time.Now()},
+		"$unset": bson.M{"pending_email": ""},
+	})
+	if mongo.IsDuplicateKeyError(err) {
+		return fmt.Errorf("email %w", ErrDuplicate)
+	}
+	return err
+}
+
+// ScheduleDeletion marks the user for removal at at; nil cancels a pending
+// deletion. Cancelling returns ErrNotFound once the purge has started.
+func (r *Users) ScheduleDeletion(ctx context.Context, id primitive.ObjectID, at *time.Time) error {
+	if at == nil {
+		return r.updateWhere(ctx, id, bson.M{"purging": bson.M{"$ne": true}}, bson.M{"$unset": bson.M{"delete_at": ""}})
+	}
+	return r.update(ctx, id, bson.M{"delete_at": *at})
+}
+
+// DueForDeletion returns the IDs of users whose deletion time has passed.
+func (r *Users) DueForDeletion(ctx context.Context, now time.Time) ([]primitive.ObjectID, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	cursor, err := r.coll.Find(ctx, bson.M{"delete_at": bson.M{"$lte": now}}, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find deleted users: %w", err)
+	}
+	var docs []struct {
+		ID primitive.ObjectID `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, fmt.Errorf("failed to decode deleted users: %w", err)
+	}
+	ids := make([]primitive.ObjectID, len(docs))
+	for i, doc := range docs {
+		ids[i] = doc.ID
+	}
+	return ids, nil
+}
+
+// MarkEmailVerified records that the user proved they own their address.
+func (r *Users) MarkEmailVerified(ctx context.Context, id primitive.ObjectID) error {
+	return r.update(ctx, id, bson.M{"email_verified": true, "email_verified_at": time.Now()})
+}
+
+// SetVerificationSentAt records when the last verification email went out.
+func (r *Users) SetVerificationSentAt(ctx context.Context, id primitive.ObjectID, at time.Time) error {
+	return r.update(ctx, id, bson.M{"verification_sent_at": at})
+}
+
+// EmailReport is what NormalizeEmails did.
+type EmailReport struct {
+	Changed int
+	// Conflicts are users left as they were because another user already
+	// has their normalized address or key.
+	Conflicts []primitive.ObjectID
+	// Invalid are users whose stored address normalize rejected.
+	Invalid []primitive.ObjectID
+}
+
+// NormalizeEmails rewrites every stored and pending address that normalize
+// changes, and sets each user's email key to what key makes of their
+// address. Users it can't rewrite, because normalize rejects their address
+// or another user already has the normalized one or its key, are left as
+// they are and reported to be resolved by hand.
+func (r *Users) NormalizeEmails(ctx context.Context, normalize func(string) (string, error), key func(string) string) (EmailReport, error) {
+	var report EmailReport
+	// The scan may outlast r.timeout on a large collection; each write
+	// still gets its own
+	cursor, err := r.coll.Find(ctx, bson.M{}, options.Find().SetProjection(bson.M{"email": 1, "email_key": 1, "pending_email": 1}))
+	if err != nil {
+		return report, fmt.Errorf("failed to list user emails: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var doc struct {
+			ID           primitive.ObjectID `bson:"_id"`
+			Email        string             `bson:"email"`
+			EmailKey     string             `bson:"email_key"`
+			PendingEmail string             `bson:"pending_email"`
+		}
+		if err := cursor.Decode(&doc); err != nil {
+			return report, fmt.Errorf("failed to decode user email: %w", err)
+		}
+		set := bson.M{}
+		email, err := normalize(doc.Email)
+		if err != nil {
+			report.Invalid = append(report.Invalid, doc.ID)
+		} else {
+			if email != doc.Email {
+				set["email"] = email
+			}
+			if k := key(email); k != doc.EmailKey {
+				set["email_key"] = k
+			}
+		}
+		// A pending address was checked when it was asked for; one that no
+		// longer passes simply won't be confirmed
+		if pending, err := normalize(doc.PendingEmail); err == nil && pending != doc.PendingEmail {
+			set["pending_email"] = pending
+		}
+		if len(set) == 0 {
+			continue
+		}
+
+		err = r.update(ctx, doc.ID, set)
+		switch {
+		case mongo.IsDuplicateKeyError(err):
+			report.Conflicts = append(report.Conflicts, doc.ID)
+			continue
+		case errors.Is(err, ErrNotFound):
+			// Deleted since the scan read it
+			continue
+		case err != nil:
+			return report, err
+		}
+		report.Changed++
+	}
+	if err := cursor.Err(); err != nil {
+		return report, fmt.Errorf("failed to list user emails: %w", err)
+	}
+	return report, nil
+}
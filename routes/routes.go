@@ -1,39 +1,195 @@
 package routes
 
 import (
+	"fmt"
+	"net/http"
+	"time"
+
 	"github.com/gin-gonic/gin"
 	"github.com/sarwanazhar/chatappbackend/controlers"
 	"github.com/sarwanazhar/chatappbackend/libs"
+	"github.com/sarwanazhar/chatappbackend/logging"
+	"github.com/sarwanazhar/chatappbackend/metrics"
+	"github.com/sarwanazhar/chatappbackend/openapi"
+	"github.com/sarwanazhar/chatappbackend/tracing"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 )
 
-func InitRoutes(router *gin.Engine) {
+// New builds the HTTP engine for app: middleware, rate limiting and routes.
+func New(app *controlers.App) *gin.Engine {
+	router := gin.New()
+	// ClientIP (rate limits, failed login counts, access logs) only
+	// believes X-Forwarded-For from these
+	if err := router.SetTrustedProxies(app.Config.Server.TrustedProxies); err != nil {
+		panic(err)
+	}
+	router.Use(otelgin.Middleware(tracing.ServiceName, otelgin.WithFilter(func(r *http.Request) bool {
+		return r.URL.Path != "/metrics"
+	})))
+	router.Use(logging.RequestID(app.Logger))
+	router.Use(logging.AccessLog())
+	router.Use(logging.Recovery())
+	router.Use(metrics.Middleware())
+
+	// Prometheus scrapes are registered before the limiter so they never eat into it
+	router.GET("/metrics", gin.WrapH(metrics.Handler()))
+	// So are key fetches: other services verify access tokens with these
+	// keys, and many of them may sit behind one IP
+	router.GET("/.well-known/jwks.json", app.GetJWKS)
+
+	// --- RATE LIMITER SETUP ---
+	limiter := libs.NewRateLimiter(app.Config.RateLimit.Requests, app.Config.RateLimit.Window)
+
+	// Keyed by client IP: this runs before authentication, so there is no
+	// user ID to go by yet
+	router.Use(func(ctx *gin.Context) {
+		if !limiter.Allow(ctx.ClientIP()) {
+			libs.RespondError(ctx, libs.CodeQuotaExceeded, "Rate limit exceeded")
+			return
+		}
+		ctx.Next()
+	})
+
+	router.HandleMethodNotAllowed = true
+	router.NoRoute(func(ctx *gin.Context) {
+		libs.RespondError(ctx, libs.CodeRouteNotFound, "No route for "+ctx.Request.Method+" "+ctx.Request.URL.Path)
+	})
+	router.NoMethod(func(ctx *gin.Context) {
+		libs.RespondError(ctx, libs.CodeMethodNotAllowed, ctx.Request.Method+" is not allowed on "+ctx.Request.URL.Path)
+	})
+
+	doc, err := openapi.Spec()
+	if err != nil {
+		panic(err)
+	}
+	router.GET("/openapi.json", openapi.Handler(doc))
+	router.Use(openapi.Validator(doc))
+
+	InitRoutes(router, app)
+	if err := openapi.CheckRoutes(router.Routes()); err != nil {
+		panic(err)
+	}
+	return router
+}
+
+// legacyDeprecatedAt is when the unversioned routes were superseded by /v1,
+// announced in the Deprecation header (RFC 9745) as a Unix timestamp.
+var legacyDeprecatedAt = time.Date(2026, time.October, 18, 0, 0, 0, 0, time.UTC)
+
+func InitRoutes(router *gin.Engine, app *controlers.App) {
 	router.GET("/", func(ctx *gin.Context) {
 		ctx.JSON(200, gin.H{
 			"test": "test",
 		})
 	})
-	Auth(router)
-	auth := router.Group("/")
-	auth.Use(libs.JWTMiddleware())
+	v1 := router.Group("/v1")
+	Auth(v1, app)
+	// The download link carries its own token so it opens from an email
+	v1.GET("/exports/download", app.DownloadExport)
+	authed := v1.Group("/")
+	authed.Use(libs.JWTMiddleware(app.Config.Auth, app.Keys, app))
 	{
-		User(auth)
-		Chat(auth)
+		User(authed, app)
+		Admin(authed.Group("/admin"), app)
 
+		chats := authed.Group("/")
+		chats.Use(app.RequireVerifiedEmail())
+		Chat(chats, app)
 	}
+
+	Legacy(router, app)
 }
 
-func Auth(router *gin.Engine) {
-	router.POST("/auth/register", controlers.CreateUser)
-	router.POST("/auth/login", controlers.LoginUser)
+func Auth(router *gin.RouterGroup, app *controlers.App) {
+	router.POST("/auth/register", app.CreateUser)
+	router.POST("/auth/login", app.LoginUser)
+	router.GET("/auth/challenge", app.GetChallenge)
+	router.POST("/auth/verify-email", app.VerifyEmail)
+	router.POST("/auth/mfa", app.VerifyMFA)
+	router.POST("/auth/resend-verification", app.ResendVerification)
+	router.POST("/auth/forgot-password", app.ForgotPassword)
+	router.POST("/auth/reset-password", app.ResetPassword)
+	router.POST("/auth/confirm-email", app.ConfirmEmailChange)
+	router.GET("/auth/providers", app.ListProviders)
+	router.GET("/auth/sso/:provider", app.StartSSO)
+	router.GET("/auth/sso/:provider/callback", app.FinishSSO)
+}
+
+func User(router *gin.RouterGroup, app *controlers.App) {
+	router.GET("/me", libs.RequireScope(libs.ScopeProfileRead), app.GetProfiles)
+
+	// Managing credentials needs a login; an API key can't mint more keys
+	account := router.Group("/me")
+	account.Use(libs.RequireSession())
+	account.POST("/mfa/totp", app.EnrollTOTP)
+	account.POST("/mfa/totp/confirm", app.ConfirmTOTP)
+	account.POST("/mfa/recovery-codes", app.RegenerateRecoveryCodes)
+	account.POST("/mfa/disable", app.DisableMFA)
+	account.GET("/api-keys", app.ListAPIKeys)
+	account.POST("/api-keys", app.CreateAPIKey)
+	account.DELETE("/api-keys/:id", app.DeleteAPIKey)
+	account.GET("/sessions", app.ListSessions)
+	account.DELETE("/sessions/:id", app.DeleteSession)
+	account.POST("/password", app.ChangePassword)
+	account.POST("/email", app.ChangeEmail)
+	account.POST("/deletion", app.ScheduleDeletion)
+	account.DELETE("/deletion", app.CancelDeletion)
+	account.POST("/export", app.RequestExport)
+	account.GET("/exports/:id", app.GetExport)
+	account.GET("/exports/:id/download", app.DownloadOwnExport)
 }
 
-func User(router *gin.RouterGroup) {
-	router.GET("/me", controlers.GetProfiles)
+// Admin is the staff API. Each route checks a permission of the caller's
+// role; API keys are never accepted.
+func Admin(router *gin.RouterGroup, app *controlers.App) {
+	router.Use(libs.RequireSession())
+	can := app.RequirePermission
+	router.GET("/users", can(libs.PermUsersRead), app.ListUsers)
+	router.GET("/users/:id", can(libs.PermUsersRead), app.GetUser)
+	router.POST("/users/:id/disable", can(libs.PermUsersDisable), app.SetUserDisabled(true))
+	router.POST("/users/:id/enable", can(libs.PermUsersDisable), app.SetUserDisabled(false))
+	router.PUT("/users/:id/role", can(libs.PermUsersRole), app.SetUserRole)
+	router.DELETE("/users/:id", can(libs.PermUsersDelete), app.DeleteUser)
+	router.GET("/usage", can(libs.PermUsageRead), app.GetUsage)
 }
 
-func Chat(router *gin.RouterGroup) {
-	router.POST("/chat/create", controlers.CreateChat)
-	router.POST("/chat/delete", controlers.DeleteChat)
-	router.GET("/chat/getall", controlers.GetChat)
-	router.POST("/chat/message", controlers.CreateMessage)
+func Chat(router *gin.RouterGroup, app *controlers.App) {
+	read := libs.RequireScope(libs.ScopeChatsRead)
+	write := libs.RequireScope(libs.ScopeChatsWrite)
+	router.GET("/chats", read, app.GetChat)
+	router.POST("/chats", write, app.CreateChat)
+	router.GET("/chats/:id", read, app.GetChatByID)
+	router.PATCH("/chats/:id", write, app.UpdateChat)
+	router.DELETE("/chats/:id", write, app.DeleteChat)
+	router.POST("/chats/:id/messages", libs.RequireScope(libs.ScopeMessagesWrite), app.CreateMessage)
+}
+
+// Legacy keeps the original unversioned routes working for shipped clients.
+// They run the same handlers as /v1 and announce their replacement.
+func Legacy(router *gin.Engine, app *controlers.App) {
+	router.POST("/auth/register", deprecated("/v1/auth/register"), app.CreateUser)
+	router.POST("/auth/login", deprecated("/v1/auth/login"), app.LoginUser)
+
+	// The header goes on before auth so rejected requests still see it
+	jwt := libs.JWTMiddleware(app.Config.Auth, app.Keys, app)
+	verified := app.RequireVerifiedEmail()
+	scope := libs.RequireScope
+	router.GET("/me", deprecated("/v1/me"), jwt, scope(libs.ScopeProfileRead), app.GetProfiles)
+	router.POST("/chat/create", deprecated("/v1/chats"), jwt, scope(libs.ScopeChatsWrite), verified, app.CreateChat)
+	router.POST("/chat/delete", deprecated("/v1/chats/{id}"), jwt, scope(libs.ScopeChatsWrite), verified, app.DeleteChat)
+	router.GET("/chat/getall", deprecated("/v1/chats"), jwt, scope(libs.ScopeChatsRead), verified, app.GetChat)
+	router.POST("/chat/message", deprecated("/v1/chats/{id}/messages"), jwt, scope(libs.ScopeMessagesWrite), verified, app.CreateMessage)
+}
+
+// deprecated marks a legacy route with a Deprecation header and a Link to
+// its /v1 successor. Legacy routes take the chat ID in the body, so a
+// successor that needs one in the path names it as {id}.
+func deprecated(successor string) gin.HandlerFunc {
+	deprecation := fmt.Sprintf("@%d", legacyDeprecatedAt.Unix())
+	link := fmt.Sprintf("<%s>; rel=\"successor-version\"", successor)
+	return func(c *gin.Context) {
+		c.Header("Deprecation", deprecation)
+		c.Header("Link", link)
+		c.Next()
+	}
 }
@@ -0,0 +1,119 @@
+package sso
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+// openID is a provider found through OpenID Connect discovery.
+type openID struct {
+	name   string
+	issuer string
+	client *http.Client
+	oauth  oauth2.Config
+
+	mu       sync.Mutex
+	provider *oidc.Provider
+}
+
+func newOIDC(name, issuer, clientID, clientSecret, redirectURL string, client *http.Client) *openID {
+	return &openID{
+		name:   name,
+		issuer: issuer,
+		client: client,
+		oauth: oauth2.Config{
+			ClientID:     clientID,
+			ClientSecret: clientSecret,
+			RedirectURL:  redirectURL,
+			Scopes:       []string{oidc.ScopeOpenID, "email", "profile"},
+		},
+	}
+}
+
+// discover fetches the issuer's metadata once. A failure isn't cached so a
+// provider outage at the first login doesn't last until restart.
+func (p *openID) discover(ctx context.Context) (*oidc.Provider, oauth2.Config, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.provider == nil {
+		// The provider keeps this context for fetching signing keys later,
+		// so it must outlive the request
+		provider, err := oidc.NewProvider(withClient(context.WithoutCancel(ctx), p.client), p.issuer)
+		if err != nil {
+			return nil, oauth2.Config{}, fmt.Errorf("discovering %s: %w", p.issuer, err)
+		}
+		p.provider = provider
+	}
+	conf := p.oauth
+	conf.Endpoint = p.provider.Endpoint()
+	return p.provider, conf, nil
+}
+
+func (p *openID) AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	_, conf, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	return conf.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier)), nil
+}
+
+func (p *openID) Exchange(ctx context.Context, code, nonce, verifier string) (*Identity, error) {
+	provider, conf, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ctx = withClient(ctx, p.client)
+
+	token, err := conf.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return nil, fmt.Errorf("exchanging code: %w", err)
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, errors.New("token response has no id_token")
+	}
+	idToken, err := provider.Verifier(&oidc.Config{ClientID: conf.ClientID}).Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, fmt.Errorf("verifying id_token: %w", err)
+	}
+	if idToken.Nonce != nonce {
+		return nil, errors.New("id_token nonce mismatch")
+	}
+
+	var claims struct {
+		Email         string `json:"email"`
+		EmailVerified any    `json:"email_verified"`
+	}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("reading id_token claims: %w", err)
+	}
+	if claims.Email == "" {
+		return nil, ErrNoEmail
+	}
+	return &Identity{
+		Provider:      p.name,
+		Subject:       idToken.Subject,
+		Email:         claims.Email,
+		EmailVerified: isTrue(claims.EmailVerified),
+	}, nil
+}
+
+// isTrue reads email_verified, which some providers send as a string.
+func isTrue(v any) bool {
+	switch v := v.(type) {
+	case bool:
+		return v
+	case string:
+		b, _ := strconv.ParseBool(v)
+		return b
+	default:
+		return false
+	}
+}
@@ -0,0 +1,214 @@
+package sso
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// mockIssuer is an OpenID Connect provider that signs in whoever the test
+// says, issuing an id_token with its claims for any code whose PKCE
+// verifier matches the challenge it was given.
+type mockIssuer struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+
+	mu        sync.Mutex
+	challenge string
+	// claims go into the next id_token; signWith, when set, signs it in
+	// place of the published key.
+	claims   jwt.MapClaims
+	signWith *rsa.PrivateKey
+}
+
+const mockClientID = "chatapp"
+
+func newMockIssuer(t *testing.T) *mockIssuer {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &mockIssuer{key: key}
+	mux := http.NewServeMux()
+	m.Server = httptest.NewServer(mux)
+	t.Cleanup(m.Close)
+
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]any{
+			"issuer":                                m.URL,
+			"authorization_endpoint":                m.URL + "/authorize",
+			"token_endpoint":                        m.URL + "/token",
+			"jwks_uri":                              m.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]any{"keys": []map[string]string{{
+			"kty": "RSA", "use": "sig", "alg": "RS256", "kid": "k1",
+			"n": base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		sum := sha256.Sum256([]byte(r.FormValue("code_verifier")))
+		if r.FormValue("code") != "good-code" || base64.RawURLEncoding.EncodeToString(sum[:]) != m.challenge {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":"invalid_grant"}`))
+			return
+		}
+		signer := m.key
+		if m.signWith != nil {
+			signer = m.signWith
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, m.claims)
+		token.Header["kid"] = "k1"
+		idToken, err := token.SignedString(signer)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, map[string]any{"access_token": "at", "token_type": "Bearer", "expires_in": 3600, "id_token": idToken})
+	})
+	return m
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// signIn runs a whole login against m with claims in the id_token.
+func (m *mockIssuer) signIn(t *testing.T, claims jwt.MapClaims, signWith *rsa.PrivateKey, code, nonce string) (*Identity, error) {
+	t.Helper()
+	p := newOIDC("mock", m.URL, mockClientID, "secret", "http://localhost:8080/v1/auth/sso/mock/callback", m.Client())
+	ctx := context.Background()
+	verifier := NewVerifier()
+
+	authURL, err := p.AuthCodeURL(ctx, "state", "the-nonce", verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	if q.Get("code_challenge_method") != "S256" || q.Get("nonce") != "the-nonce" || q.Get("client_id") != mockClientID {
+		t.Fatalf("authorization URL %s lacks PKCE, the nonce or the client ID", authURL)
+	}
+
+	m.mu.Lock()
+	m.challenge, m.claims, m.signWith = q.Get("code_challenge"), claims, signWith
+	m.mu.Unlock()
+	return p.Exchange(ctx, code, nonce, verifier)
+}
+
+func TestOpenIDExchange(t *testing.T) {
+	m := newMockIssuer(t)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	claims := func(extra jwt.MapClaims) jwt.MapClaims {
+		c := jwt.MapClaims{
+			"iss":   m.URL,
+			"aud":   mockClientID,
+			"sub":   "subject-1",
+			"iat":   now.Unix(),
+			"exp":   now.Add(time.Hour).Unix(),
+			"nonce": "the-nonce",
+			"email": "Jane@Example.com",
+		}
+		for k, v := range extra {
+			if v == nil {
+				delete(c, k)
+			} else {
+				c[k] = v
+			}
+		}
+		return c
+	}
+
+	tests := []struct {
+		name     string
+		claims   jwt.MapClaims
+		signWith *rsa.PrivateKey
+		code     string
+		nonce    string
+		want     *Identity
+		wantErr  error
+	}{
+		{
+			name:   "verified email",
+			claims: claims(jwt.MapClaims{"email_verified": true}),
+			want:   &Identity{Provider: "mock", Subject: "subject-1", Email: "Jane@Example.com", EmailVerified: true},
+		},
+		{
+			name:   "verified as a string",
+			claims: claims(jwt.MapClaims{"email_verified": "true"}),
+			want:   &Identity{Provider: "mock", Subject: "subject-1", Email: "Jane@Example.com", EmailVerified: true},
+		},
+		{
+			name:   "unverified email",
+			claims: claims(jwt.MapClaims{"email_verified": false}),
+			want:   &Identity{Provider: "mock", Subject: "subject-1", Email: "Jane@Example.com"},
+		},
+		{
+			name:   "no email_verified claim",
+			claims: claims(nil),
+			want:   &Identity{Provider: "mock", Subject: "subject-1", Email: "Jane@Example.com"},
+		},
+		{name: "no email", claims: claims(jwt.MapClaims{"email": nil}), wantErr: ErrNoEmail},
+		{name: "nonce mismatch", claims: claims(nil), nonce: "another-nonce"},
+		{name: "another audience", claims: claims(jwt.MapClaims{"aud": "someone-else"})},
+		{name: "another issuer", claims: claims(jwt.MapClaims{"iss": "https://evil.example.com"})},
+		{name: "expired", claims: claims(jwt.MapClaims{"exp": now.Add(-time.Minute).Unix()})},
+		{name: "unpublished key", claims: claims(nil), signWith: otherKey},
+		{name: "code refused", claims: claims(nil), code: "bad-code"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, nonce := "good-code", "the-nonce"
+			if tt.code != "" {
+				code = tt.code
+			}
+			if tt.nonce != "" {
+				nonce = tt.nonce
+			}
+			got, err := m.signIn(t, tt.claims, tt.signWith, code, nonce)
+			if tt.want == nil {
+				if err == nil {
+					t.Fatalf("Exchange = %+v, want an error", got)
+				}
+				if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+					t.Errorf("Exchange error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *got != *tt.want {
+				t.Errorf("Exchange = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}